@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+)
+
+// basePaths returns the Dropbox paths of the items in b, for --base. Items
+// without a Path, as this tool writes them, are located by their key (the
+// Dropbox file ID or path hash) among entries, the current listing; those not
+// found there are only counted in unresolved.
+func basePaths(b *backup.Backup, entries []dropbox.Entry) (paths []string, unresolved int) {
+	var byKey map[string]string
+	for _, it := range b.Items {
+		if it.Path != "" {
+			paths = append(paths, it.RemotePath())
+			continue
+		}
+		if byKey == nil {
+			byKey = make(map[string]string, len(entries))
+			for _, e := range entries {
+				if key := backup.ItemKey(e); key != "" {
+					byKey[key] = e.PathDisplay
+				}
+			}
+		}
+		if p, ok := byKey[it.Key]; ok && it.Key != "" {
+			paths = append(paths, p)
+			continue
+		}
+		unresolved++
+	}
+	return paths, unresolved
+}
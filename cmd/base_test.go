@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox/dropboxtest"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestBasePaths(t *testing.T) {
+	t.Parallel()
+
+	entries := []dropbox.Entry{
+		dropboxtest.File("id:b", "/Music/Old/b.mp3"),
+		dropboxtest.File("", "/Music/Old/d.mp3"),
+	}
+	b := &backup.Backup{Items: []backup.Item{
+		{Path: "/Music/Old", Name: "a.mp3"},
+		{Key: "id:b", Name: "b.mp3"},
+		{Path: "/Music/Old/", Name: "c.flac"},
+		{Key: backup.ItemKey(entries[1]), Name: "d.mp3"},
+		{Key: "id:gone", Name: "gone.mp3"},
+		{Name: "keyless.mp3"},
+	}}
+	paths, unresolved := basePaths(b, entries)
+
+	assert.Equal(t, []string{"/Music/Old/a.mp3", "/Music/Old/b.mp3", "/Music/Old/c.flac", "/Music/Old/d.mp3"}, paths)
+	assert.Equal(t, 2, unresolved)
+}
+
+func TestBasePaths_OwnBackup(t *testing.T) {
+	t.Parallel()
+
+	entries := []dropbox.Entry{
+		dropboxtest.File("id:1", "/Music/Album/01.mp3"),
+		dropboxtest.File("id:2", "/Music/Album/02.mp3"),
+	}
+	var items []backup.Item
+	for _, e := range entries {
+		items = append(items, backup.NewItem("dbid:1", e, tags.AudioMeta{Title: e.Name}, backup.ItemOptions{}))
+	}
+	path := filepath.Join(t.TempDir(), "old.cbbackup")
+	require.NoError(t, backup.Write(path, &backup.Backup{Items: items, Playlists: []backup.Playlist{}}, backup.WriteOptions{}))
+
+	base, err := backup.Read(path)
+	require.NoError(t, err)
+	paths, unresolved := basePaths(base, entries)
+	assert.Zero(t, unresolved)
+
+	// The next run lists one more file; only that one is left to process
+	entries = append(entries, dropboxtest.File("id:3", "/Music/Album/03.mp3"))
+	result := matcher.ScanResult{}
+	for _, e := range entries {
+		result.Matched = append(result.Matched, matcher.MatchedFile{LocalPath: "/local" + e.PathDisplay, Entry: e})
+	}
+	result.SkipPaths(paths)
+	require.Len(t, result.Matched, 1)
+	assert.Equal(t, "id:3", result.Matched[0].Entry.ID)
+	assert.Len(t, result.InBase, 2)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// folderCaseMismatch reports whether the --local folder's name and the name
+// Dropbox stores for the matching folder differ only in case, e.g. "music"
+// and "Music". Matching compares lowercased paths, so this is harmless, but it
+// explains why Dropbox shows the folder differently. It returns the local name.
+func folderCaseMismatch(localDir, remoteName string) (string, bool) {
+	local := norm.NFC.String(filepath.Base(localDir))
+	remote := norm.NFC.String(remoteName)
+	return local, local != remote && strings.EqualFold(local, remote)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFolderCaseMismatch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		localDir   string
+		remoteName string
+		want       bool
+	}{
+		{"same case", "/Users/me/Dropbox/Music", "Music", false},
+		{"case only", "/Users/me/Dropbox/music", "Music", true},
+		{"mixed case only", "/Users/me/Dropbox/Hip-hop", "Hip-Hop", true},
+		{"different names", "/Users/me/Dropbox/Songs", "Music", false},
+		{"decomposed accents are not a case difference", "/Users/me/Dropbox/Mus\u0301ic", "Mu\u015bic", false},
+		{"accented case only", "/Users/me/Dropbox/e\u0301cole", "\u00c9cole", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, got := folderCaseMismatch(test.localDir, test.remoteName)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
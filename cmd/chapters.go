@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// chapterExtensions are the containers that can carry chapters.
+var chapterExtensions = map[string]bool{".m4b": true, ".m4a": true}
+
+// applyChapters looks for chapters in each item's local file, read with
+// readChapters (tags.ReadChapters outside tests). With split, each
+// chaptered item becomes one item per chapter; otherwise chaptered files are
+// only reported, as the format cannot address part of a file. Items must be
+// deduplicated already, since chapter items share their file's Key.
+func applyChapters(items []backup.Item, matched []matcher.MatchedFile, split bool,
+	readChapters func(path string) ([]tags.Chapter, error), logger zerolog.Logger,
+) []backup.Item {
+	localPaths := make(map[string]string, len(matched))
+	for _, mf := range matched {
+		if chapterExtensions[strings.ToLower(filepath.Ext(mf.LocalPath))] {
+			localPaths[backup.ItemKey(mf.Entry)] = mf.LocalPath
+		}
+	}
+
+	out := make([]backup.Item, 0, len(items))
+	for _, it := range items {
+		path, ok := localPaths[it.Key]
+		if !ok {
+			out = append(out, it)
+			continue
+		}
+
+		chapters, err := readChapters(path)
+		switch {
+		case errors.Is(err, tags.ErrChapterTrack):
+			logger.Warn().Str("file", path).Msg("chapters are in a chapter track, which cannot be read yet; kept as one track")
+		case err != nil:
+			logger.Warn().Err(err).Str("file", path).Msg("reading chapters")
+		case len(chapters) > 1 && split:
+			parts := backup.SplitChapters(it, chapters)
+			logger.Debug().Str("file", path).Int("chapters", len(parts)).Msg("split into chapters")
+			out = append(out, parts...)
+			continue
+		case len(chapters) > 1:
+			logger.Warn().Str("file", path).Int("chapters", len(chapters)).
+				Msg("chaptered file kept as one track; only --format itunes can split chapters")
+		}
+		out = append(out, it)
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestApplyChapters(t *testing.T) {
+	t.Parallel()
+
+	var read []string
+	readChapters := func(path string) ([]tags.Chapter, error) {
+		read = append(read, path)
+		switch path {
+		case "/books/Novel.m4b":
+			return []tags.Chapter{{Title: "One", Start: 0}, {Title: "Two", Start: time.Minute}}, nil
+		case "/books/Tracked.m4b":
+			return nil, tags.ErrChapterTrack
+		default:
+			return nil, errors.New("unexpected read")
+		}
+	}
+
+	matched := []matcher.MatchedFile{
+		{LocalPath: "/books/Novel.m4b", Entry: dropbox.Entry{ID: "id:novel"}},
+		{LocalPath: "/books/Tracked.m4b", Entry: dropbox.Entry{ID: "id:tracked"}},
+		{LocalPath: "/music/Song.mp3", Entry: dropbox.Entry{ID: "id:song"}},
+	}
+	items := []backup.Item{
+		{Key: "id:novel", TagName: "Novel", Duration: 120},
+		{Key: "id:tracked", TagName: "Tracked"},
+		{Key: "id:song", TagName: "Song"},
+	}
+
+	got := applyChapters(items, matched, true, readChapters, zerolog.Nop())
+	require.Len(t, got, 4)
+	assert.Equal(t, "One", got[0].TagName)
+	assert.Equal(t, "Two", got[1].TagName)
+	assert.Equal(t, "Tracked", got[2].TagName)
+	assert.Equal(t, "Song", got[3].TagName)
+	assert.Equal(t, []string{"/books/Novel.m4b", "/books/Tracked.m4b"}, read, "only chapter containers are opened")
+
+	kept := applyChapters(items, matched, false, readChapters, zerolog.Nop())
+	assert.Equal(t, items, kept, "without splitting, chaptered files stay whole")
+}
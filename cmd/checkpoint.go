@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// checkpointFlushEvery is how many tagged files are buffered before the
+// checkpoint is written out, bounding the work lost to a crash.
+const checkpointFlushEvery = 50
+
+// checkpointRecord is one line of a checkpoint file. Size and ModTime are the
+// file's when it was read, as in the tag cache, so a file changed since then
+// is read again.
+type checkpointRecord struct {
+	Path    string         `json:"path"`
+	Size    int64          `json:"size"`
+	ModTime int64          `json:"mod_time"` // UnixNano
+	Meta    tags.AudioMeta `json:"meta"`
+}
+
+// checkpoint records the tags read so far in a run, one JSON line per file, so
+// that a run killed before it could save the tag cache resumes where it
+// stopped. Files are keyed by local path: the order of matched files can change
+// between runs. A nil *checkpoint records and finds nothing.
+type checkpoint struct {
+	path       string
+	flushEvery int
+	done       map[string]checkpointRecord
+
+	mu      sync.Mutex
+	f       *os.File
+	w       *bufio.Writer
+	pending int
+	err     error
+}
+
+// checkpointPath is where the checkpoint of a run writing output is kept.
+func checkpointPath(output string) string {
+	return output + ".checkpoint"
+}
+
+// openCheckpoint loads the files recorded at path by an earlier run, if any,
+// and opens it to record more. A line cut short by a crash ends the loaded
+// records and is dropped from the file.
+func openCheckpoint(path string) (*checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening checkpoint: %w", err)
+	}
+
+	done := make(map[string]checkpointRecord)
+	r := bufio.NewReader(f)
+	var valid int64
+	for {
+		line, err := r.ReadBytes('\n')
+		var rec checkpointRecord
+		if err != nil || json.Unmarshal(line, &rec) != nil {
+			break
+		}
+		done[rec.Path] = rec
+		valid += int64(len(line))
+	}
+	if err := f.Truncate(valid); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("truncating checkpoint: %w", err)
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("seeking checkpoint: %w", err)
+	}
+
+	return &checkpoint{
+		path:       path,
+		flushEvery: checkpointFlushEvery,
+		done:       done,
+		f:          f,
+		w:          bufio.NewWriter(f),
+	}, nil
+}
+
+// Len returns how many files an earlier run recorded.
+func (c *checkpoint) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.done)
+}
+
+// Lookup returns the tags an earlier run recorded for path, if the file still
+// has the size and modification time it had then.
+func (c *checkpoint) Lookup(path string) (tags.AudioMeta, bool) {
+	if c == nil {
+		return tags.AudioMeta{}, false
+	}
+	rec, ok := c.done[path]
+	if !ok {
+		return tags.AudioMeta{}, false
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != rec.Size || info.ModTime().UnixNano() != rec.ModTime {
+		return tags.AudioMeta{}, false
+	}
+	return rec.Meta, true
+}
+
+// Record adds the tags read from path, unless the file can no longer be
+// found. It is safe for concurrent use. After a write error, recording stops;
+// Err reports it.
+func (c *checkpoint) Record(path string, meta tags.AudioMeta) {
+	if c == nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+
+	line, err := json.Marshal(checkpointRecord{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Meta:    meta,
+	})
+	if err == nil {
+		_, err = c.w.Write(append(line, '\n'))
+	}
+	c.pending++
+	if err == nil && c.pending >= c.flushEvery {
+		err = c.w.Flush()
+		c.pending = 0
+	}
+	c.err = err
+}
+
+// Err returns the error that stopped recording, if any.
+func (c *checkpoint) Err() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close writes out buffered records and closes the file, keeping it for the
+// next run to resume from.
+func (c *checkpoint) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	err := c.err
+	if err == nil {
+		err = c.w.Flush()
+	}
+	return errors.Join(err, c.f.Close())
+}
+
+// Remove closes and deletes the checkpoint once every file has been read and
+// the tag cache holds them.
+func (c *checkpoint) Remove() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return errors.Join(c.f.Close(), os.Remove(c.path))
+}
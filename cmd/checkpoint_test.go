@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestCheckpoint_InterruptAndResume(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := checkpointPath(filepath.Join(dir, "lib.cbbackup"))
+	var files []string
+	for _, name := range []string{"a.mp3", "b.mp3", "c.mp3", "d.mp3"} {
+		file := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(file, []byte("audio"), 0o644))
+		files = append(files, file)
+	}
+	meta := func(file string) tags.AudioMeta {
+		return tags.AudioMeta{Title: filepath.Base(file), Artist: "Band", TrackNumber: 1}
+	}
+
+	// First run: a fresh checkpoint, killed after three files, with the
+	// third only partly written out
+	first, err := openCheckpoint(path)
+	require.NoError(t, err)
+	assert.Zero(t, first.Len())
+	first.flushEvery = 1
+	first.Record(files[0], meta(files[0]))
+	first.Record(files[1], meta(files[1]))
+	require.NoError(t, first.Err())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"path":"` + filepath.ToSlash(files[2]) + `","meta":{"Tit`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	// Second run: resumes with the two complete records, re-reads the rest
+	second, err := openCheckpoint(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Len())
+	for _, file := range files[:2] {
+		got, ok := second.Lookup(file)
+		assert.True(t, ok, file)
+		assert.Equal(t, meta(file), got)
+	}
+	_, ok := second.Lookup(files[2])
+	assert.False(t, ok, "a truncated record is not trusted")
+	truncated, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, data, truncated, "the truncated line is dropped")
+
+	var wg sync.WaitGroup
+	for _, file := range files[2:] {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			second.Record(file, meta(file))
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, second.Close())
+
+	// Third run: everything is recorded; a complete run removes the checkpoint
+	third, err := openCheckpoint(path)
+	require.NoError(t, err)
+	assert.Equal(t, 4, third.Len())
+	require.NoError(t, third.Remove())
+	assert.NoFileExists(t, path)
+}
+
+func TestCheckpoint_ChangedFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := checkpointPath(filepath.Join(dir, "lib.cbbackup"))
+	retagged := filepath.Join(dir, "retagged.mp3")
+	removed := filepath.Join(dir, "removed.mp3")
+	for _, file := range []string{retagged, removed} {
+		require.NoError(t, os.WriteFile(file, []byte("audio"), 0o644))
+	}
+
+	first, err := openCheckpoint(path)
+	require.NoError(t, err)
+	first.Record(retagged, tags.AudioMeta{Title: "Old"})
+	first.Record(removed, tags.AudioMeta{Title: "Gone"})
+	first.Record(filepath.Join(dir, "missing.mp3"), tags.AudioMeta{Title: "Missing"})
+	require.NoError(t, first.Close())
+
+	// Retagged between the runs: same name, new size and modification time
+	require.NoError(t, os.WriteFile(retagged, []byte("retagged audio"), 0o644))
+	require.NoError(t, os.Chtimes(retagged, time.Now(), time.Now().Add(time.Hour)))
+	require.NoError(t, os.Remove(removed))
+
+	second, err := openCheckpoint(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = second.Close() })
+	assert.Equal(t, 2, second.Len(), "a file gone before it was recorded is left out")
+	_, ok := second.Lookup(retagged)
+	assert.False(t, ok, "a changed file is read again")
+	_, ok = second.Lookup(removed)
+	assert.False(t, ok)
+}
+
+func TestCheckpoint_Nil(t *testing.T) {
+	t.Parallel()
+
+	var c *checkpoint
+	c.Record("/music/a.mp3", tags.AudioMeta{})
+	_, ok := c.Lookup("/music/a.mp3")
+	assert.False(t, ok)
+	assert.Zero(t, c.Len())
+	assert.NoError(t, c.Err())
+	assert.NoError(t, c.Close())
+	assert.NoError(t, c.Remove())
+}
+
+func TestCheckpoint_UnwritableDir(t *testing.T) {
+	t.Parallel()
+
+	_, err := openCheckpoint(filepath.Join(t.TempDir(), "missing", "lib.cbbackup.checkpoint"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+)
+
+// printDiff writes a concise human-readable summary of d to w.
+func printDiff(w io.Writer, oldPath string, d backup.DiffResult) {
+	fmt.Fprintf(w, "\n--- Compared with %s ---\n", oldPath)
+	fmt.Fprintf(w, "Added:   %d\n", len(d.Added))
+	fmt.Fprintf(w, "Removed: %d\n", len(d.Removed))
+	fmt.Fprintf(w, "Changed: %d\n", len(d.Changed))
+
+	for _, it := range d.Added {
+		fmt.Fprintf(w, "  + %s\n", it.Name)
+	}
+	for _, it := range d.Removed {
+		fmt.Fprintf(w, "  - %s\n", it.Name)
+	}
+	for _, c := range d.Changed {
+		fields := make([]string, len(c.Fields))
+		for i, f := range c.Fields {
+			fields[i] = fmt.Sprintf("%s: %q -> %q", f.Field, f.Old, f.New)
+		}
+		fmt.Fprintf(w, "  ~ %s (%s)\n", c.Name, strings.Join(fields, ", "))
+	}
+}
+
+// writeDiffJSON writes d to w as indented JSON.
+func writeDiffJSON(w io.Writer, d backup.DiffResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// albumFields reads and sets the album-level fields DetectAlbumInconsistencies
+// checks, by their AlbumWarning.Field name.
+var albumFields = map[string]struct {
+	get func(backup.Item) string
+	set func(*backup.Item, string)
+}{
+	"album_artist": {
+		get: func(it backup.Item) string { return it.AlbumArtist },
+		set: func(it *backup.Item, v string) { it.AlbumArtist = v },
+	},
+	"year": {
+		get: func(it backup.Item) string { return strconv.Itoa(it.Year) },
+		set: func(it *backup.Item, v string) { it.Year, _ = strconv.Atoi(v) },
+	},
+}
+
+// albumFieldWriter rewrites one album-level field in the file at path.
+type albumFieldWriter func(path, field, value string) error
+
+// writeAlbumField is the albumFieldWriter used outside tests.
+func writeAlbumField(path, field, value string) error {
+	meta, err := tags.ReadFile(path, tags.ReadOptions{})
+	if err != nil {
+		return err
+	}
+	switch field {
+	case "album_artist":
+		meta.AlbumArtist = value
+	case "year":
+		meta.Year, _ = strconv.Atoi(value)
+	}
+	return tags.WriteTags(path, meta)
+}
+
+// localPathsByKey maps item keys to the local file each matched entry came from.
+func localPathsByKey(matched []matcher.MatchedFile) map[string]string {
+	paths := make(map[string]string, len(matched))
+	for _, mf := range matched {
+		if key := backup.ItemKey(mf.Entry); key != "" {
+			paths[key] = mf.LocalPath
+		}
+	}
+	return paths
+}
+
+// albumWarningPath is the file an album warning is about: its local path when
+// it was matched, else its Dropbox path.
+func albumWarningPath(w backup.AlbumWarning, localPaths map[string]string) string {
+	if p := localPaths[w.Key]; p != "" {
+		return p
+	}
+	return path.Join(w.Folder, w.Name)
+}
+
+// fixAlbumsPromptable reports why --fix-albums cannot ask its questions, if it
+// cannot: it reads every answer from stdin, so stdin must be a terminal that
+// --token - / --refresh-token - has not read from, and --yes must not be set.
+func fixAlbumsPromptable(yes, stdinUsed, terminal bool) error {
+	switch {
+	case yes:
+		return errors.New("--fix-albums asks which value to keep for each album, so it cannot be combined with --yes")
+	case stdinUsed:
+		return errors.New("--fix-albums reads its answers from stdin, which --token - / --refresh-token - already used")
+	case !terminal:
+		return errors.New("--fix-albums asks which value to keep for each album, so it needs a terminal")
+	}
+	return nil
+}
+
+// fixAlbums walks through the albums flagged in warnings and, for each field
+// their tracks disagree on, asks on out which value to keep, reading answers
+// from in. Tracks with another value are rewritten with write and updated in
+// items, so the backup reflects the fix. Empty values and "Unknown" cannot be
+// written to files and are not offered. Items without a local file (e.g.
+// Dropbox-only ones) are left alone. Write failures are reported to onError,
+// leaving the item as is, and the rest carry on. It returns how many files were
+// rewritten.
+func fixAlbums(items []backup.Item, warnings []backup.AlbumWarning, localPaths map[string]string,
+	in io.Reader, out io.Writer, write albumFieldWriter, onError func(path string, err error),
+) int {
+	answers := bufio.NewScanner(in)
+	fixed := 0
+
+	seen := make(map[[3]string]bool)
+	for _, w := range warnings {
+		group := [3]string{w.Album, w.Folder, w.Field}
+		if seen[group] {
+			continue
+		}
+		seen[group] = true
+		field := albumFields[w.Field]
+
+		var tracks []int
+		for i, it := range items {
+			if it.Album == w.Album && it.Dir() == w.Folder {
+				tracks = append(tracks, i)
+			}
+		}
+		values, counts := distinctValues(items, tracks, field.get)
+		if len(values) < 2 {
+			continue
+		}
+
+		album := strconv.Quote(w.Album)
+		if w.Folder != "" {
+			album += " in " + w.Folder
+		}
+		fmt.Fprintf(out, "\nAlbum %s: tracks disagree on %s\n", album, strings.ReplaceAll(w.Field, "_", " "))
+		for i, v := range values {
+			fmt.Fprintf(out, "  %d) %s (%d tracks)\n", i+1, v, counts[i])
+		}
+		choice, ok := pickValue(answers, out, len(values))
+		if !ok {
+			return fixed
+		}
+		if choice < 0 {
+			continue
+		}
+
+		keep := values[choice]
+		for _, i := range tracks {
+			if field.get(items[i]) == keep {
+				continue
+			}
+			file := localPaths[items[i].Key]
+			if file == "" {
+				continue
+			}
+			if err := write(file, w.Field, keep); err != nil {
+				onError(file, fmt.Errorf("fixing %s: %w", strings.ReplaceAll(w.Field, "_", " "), err))
+				continue
+			}
+			field.set(&items[i], keep)
+			fixed++
+		}
+	}
+	return fixed
+}
+
+// distinctValues returns the writable values of the tracks, most common first
+// (ties in order of appearance), with how many tracks use each.
+func distinctValues(items []backup.Item, tracks []int, get func(backup.Item) string) ([]string, []int) {
+	var values []string
+	count := make(map[string]int)
+	for _, i := range tracks {
+		v := get(items[i])
+		if v == "" || v == "0" || v == tags.Unknown {
+			continue
+		}
+		if count[v] == 0 {
+			values = append(values, v)
+		}
+		count[v]++
+	}
+	slices.SortStableFunc(values, func(a, b string) int { return count[b] - count[a] })
+	counts := make([]int, len(values))
+	for i, v := range values {
+		counts[i] = count[v]
+	}
+	return values, counts
+}
+
+// pickValue asks for a choice between 1 and n until it gets a valid one. It
+// returns the zero-based choice, -1 to skip (empty answer), and false once
+// the input ends or the user quits.
+func pickValue(answers *bufio.Scanner, out io.Writer, n int) (int, bool) {
+	for {
+		fmt.Fprintf(out, "Value to keep [1-%d, Enter to skip, q to stop]: ", n)
+		if !answers.Scan() {
+			fmt.Fprintln(out)
+			return 0, false
+		}
+		answer := strings.TrimSpace(answers.Text())
+		switch strings.ToLower(answer) {
+		case "":
+			return -1, true
+		case "q", "quit":
+			return 0, false
+		}
+		if choice, err := strconv.Atoi(answer); err == nil && choice >= 1 && choice <= n {
+			return choice - 1, true
+		}
+		fmt.Fprintf(out, "Please enter a number between 1 and %d.\n", n)
+	}
+}
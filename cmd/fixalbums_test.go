@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func albumItems() []backup.Item {
+	return []backup.Item{
+		{Key: "id:1", Name: "01.mp3", Album: "Record", AlbumArtist: "Band", Year: 2001},
+		{Key: "id:2", Name: "02.mp3", Album: "Record", AlbumArtist: "Band", Year: 2001},
+		{Key: "id:3", Name: "03.mp3", Album: "Record", AlbumArtist: "The Band", Year: 2002},
+		{Key: "id:4", Name: "04.mp3", Album: "Record", AlbumArtist: tags.Unknown, Year: 2001},
+		{Key: "id:5", Name: "other.mp3", Album: "Other", AlbumArtist: "Someone", Year: 1990},
+	}
+}
+
+func TestFixAlbums(t *testing.T) {
+	t.Parallel()
+
+	localPaths := map[string]string{"id:1": "/m/01.mp3", "id:2": "/m/02.mp3", "id:3": "/m/03.mp3", "id:4": "/m/04.mp3"}
+
+	type write struct{ path, field, value string }
+
+	tests := []struct {
+		name       string
+		answers    string
+		wantWrites []write
+		wantItems  func([]backup.Item)
+	}{
+		{
+			name:    "pick the minority value, then keep the majority year",
+			answers: "2\n1\n",
+			wantWrites: []write{
+				{"/m/01.mp3", "album_artist", "The Band"},
+				{"/m/02.mp3", "album_artist", "The Band"},
+				{"/m/04.mp3", "album_artist", "The Band"},
+				{"/m/03.mp3", "year", "2001"},
+			},
+			wantItems: func(items []backup.Item) {
+				for i := range items[:4] {
+					items[i].AlbumArtist, items[i].Year = "The Band", 2001
+				}
+			},
+		},
+		{
+			name:      "skip both",
+			answers:   "\n\n",
+			wantItems: func([]backup.Item) {},
+		},
+		{
+			name:       "invalid answers are asked again",
+			answers:    "9\nband\n1\nq\n",
+			wantWrites: []write{{"/m/03.mp3", "album_artist", "Band"}, {"/m/04.mp3", "album_artist", "Band"}},
+			wantItems: func(items []backup.Item) {
+				items[2].AlbumArtist = "Band"
+				items[3].AlbumArtist = "Band"
+			},
+		},
+		{
+			name:      "input ends",
+			answers:   "",
+			wantItems: func([]backup.Item) {},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			items := albumItems()
+			var writes []write
+			var out strings.Builder
+			n := fixAlbums(items, backup.DetectAlbumInconsistencies(items), localPaths,
+				strings.NewReader(test.answers), &out,
+				func(path, field, value string) error {
+					writes = append(writes, write{path, field, value})
+					return nil
+				},
+				func(path string, err error) { t.Errorf("writing %s: %v", path, err) })
+			assert.Equal(t, test.wantWrites, writes)
+			assert.Equal(t, len(test.wantWrites), n)
+
+			want := albumItems()
+			test.wantItems(want)
+			assert.Equal(t, want, items)
+		})
+	}
+}
+
+func TestFixAlbums_Prompt(t *testing.T) {
+	t.Parallel()
+
+	items := albumItems()
+	var out strings.Builder
+	fixAlbums(items, backup.DetectAlbumInconsistencies(items), nil, strings.NewReader("\n\n"), &out,
+		func(string, string, string) error { return nil }, func(string, error) {})
+
+	assert.Contains(t, out.String(), "Album \"Record\": tracks disagree on album artist\n"+
+		"  1) Band (2 tracks)\n"+
+		"  2) The Band (1 tracks)\n")
+	assert.Contains(t, out.String(), "  1) 2001 (3 tracks)\n  2) 2002 (1 tracks)\n")
+	assert.NotContains(t, out.String(), tags.Unknown, "unwritable values are not offered")
+}
+
+func TestFixAlbums_SameTitleInDifferentFolders(t *testing.T) {
+	t.Parallel()
+
+	items := []backup.Item{
+		{Key: "id:1", Name: "q1.mp3", Folder: "/Music/Queen", Album: "Greatest Hits", AlbumArtist: "Queen", Year: 1981},
+		{Key: "id:2", Name: "q2.mp3", Folder: "/Music/Queen", Album: "Greatest Hits", AlbumArtist: "Queen", Year: 1981},
+		{Key: "id:3", Name: "q3.mp3", Folder: "/Music/Queen", Album: "Greatest Hits", AlbumArtist: "Queen", Year: 1982},
+		{Key: "id:4", Name: "a1.mp3", Folder: "/Music/ABBA", Album: "Greatest Hits", AlbumArtist: "ABBA", Year: 1975},
+		{Key: "id:5", Name: "a2.mp3", Folder: "/Music/ABBA", Album: "Greatest Hits", AlbumArtist: "ABBA", Year: 1975},
+	}
+	localPaths := map[string]string{"id:1": "/m/q1.mp3", "id:2": "/m/q2.mp3", "id:3": "/m/q3.mp3", "id:4": "/m/a1.mp3", "id:5": "/m/a2.mp3"}
+
+	var writes []string
+	var out strings.Builder
+	n := fixAlbums(items, backup.DetectAlbumInconsistencies(items), localPaths, strings.NewReader("1\n"), &out,
+		func(path, field, value string) error {
+			writes = append(writes, path+" "+field+"="+value)
+			return nil
+		},
+		func(path string, err error) { t.Errorf("writing %s: %v", path, err) })
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"/m/q3.mp3 year=1981"}, writes, "the other album's tracks are left alone")
+	assert.Contains(t, out.String(), "Album \"Greatest Hits\" in /Music/Queen: tracks disagree on year\n"+
+		"  1) 1981 (2 tracks)\n"+
+		"  2) 1982 (1 tracks)\n")
+	assert.NotContains(t, out.String(), "album artist")
+}
+
+func TestFixAlbums_WriteError(t *testing.T) {
+	t.Parallel()
+
+	items := albumItems()
+	writeErr := errors.New("read-only file")
+	localPaths := map[string]string{"id:1": "/m/01.mp3", "id:2": "/m/02.mp3", "id:3": "/m/03.mp3"}
+
+	failed := map[string]error{}
+	n := fixAlbums(items, backup.DetectAlbumInconsistencies(items), localPaths, strings.NewReader("2\n"), &strings.Builder{},
+		func(path, _, _ string) error {
+			if path == "/m/01.mp3" {
+				return writeErr
+			}
+			return nil
+		},
+		func(path string, err error) { failed[path] = err })
+	assert.Equal(t, 1, n, "the other tracks are still fixed")
+	require.Len(t, failed, 1)
+	require.ErrorIs(t, failed["/m/01.mp3"], writeErr)
+	assert.Equal(t, "Band", items[0].AlbumArtist, "a failed write leaves the item as is")
+	assert.Equal(t, "The Band", items[1].AlbumArtist)
+}
+
+func TestFixAlbumsPromptable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		yes       bool
+		stdinUsed bool
+		terminal  bool
+		wantErr   string
+	}{
+		{name: "terminal", terminal: true},
+		{name: "--yes", yes: true, terminal: true, wantErr: "--yes"},
+		{name: "secret read from stdin", stdinUsed: true, terminal: true, wantErr: "--token -"},
+		{name: "no terminal", wantErr: "needs a terminal"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := fixAlbumsPromptable(test.yes, test.stdinUsed, test.terminal)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+}
+
+func TestAlbumWarningPath(t *testing.T) {
+	t.Parallel()
+
+	localPaths := map[string]string{"id:1": "/local/Album/01.mp3"}
+	assert.Equal(t, "/local/Album/01.mp3",
+		albumWarningPath(backup.AlbumWarning{Key: "id:1", Folder: "/Music/Album", Name: "01.mp3"}, localPaths))
+	assert.Equal(t, "/Music/Album/02.mp3",
+		albumWarningPath(backup.AlbumWarning{Key: "id:2", Folder: "/Music/Album", Name: "02.mp3"}, localPaths),
+		"a track without a local file gets its Dropbox path")
+}
+
+func TestLocalPathsByKey(t *testing.T) {
+	t.Parallel()
+
+	matched := []matcher.MatchedFile{
+		{LocalPath: "/m/a.mp3", Entry: dropbox.Entry{ID: "id:1", PathDisplay: "/Music/a.mp3"}},
+		{LocalPath: "/m/b.mp3", Entry: dropbox.Entry{PathDisplay: "/Music/b.mp3"}},
+	}
+	paths := localPathsByKey(matched)
+	assert.Equal(t, "/m/a.mp3", paths["id:1"])
+	assert.Equal(t, "/m/b.mp3", paths[backup.ItemKey(matched[1].Entry)])
+}
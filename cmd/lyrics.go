@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// lyricsReportName is the file listing every exported sidecar, written alongside them.
+const lyricsReportName = "lyrics-report.tsv"
+
+// lrcTimestamp matches an LRC time tag such as "[01:23.45]" at the start of a line.
+var lrcTimestamp = regexp.MustCompile(`(?m)^\[\d+:\d{2}(?:[.:]\d+)?\]`)
+
+// lyricsExt returns ".lrc" for time-synced lyrics and ".txt" for plain ones.
+func lyricsExt(lyrics string) string {
+	if lrcTimestamp.MatchString(lyrics) {
+		return ".lrc"
+	}
+	return ".txt"
+}
+
+// exportLyrics writes a sidecar for every track with embedded lyrics under dir,
+// mirroring the track's path relative to localDir, plus a report mapping each
+// sidecar to its Dropbox path. It returns the number of sidecars written.
+func exportLyrics(dir, localDir string, matched []matcher.MatchedFile, metas []tags.AudioMeta, errs []error) (int, error) {
+	var report []string
+	for i, mf := range matched {
+		if errs[i] != nil || metas[i].Lyrics == "" {
+			continue
+		}
+
+		rel, err := filepath.Rel(localDir, mf.LocalPath)
+		if err != nil {
+			return len(report), fmt.Errorf("locating %s: %w", mf.LocalPath, err)
+		}
+		rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + lyricsExt(metas[i].Lyrics)
+
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return len(report), fmt.Errorf("creating lyrics directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(metas[i].Lyrics), 0o644); err != nil {
+			return len(report), fmt.Errorf("writing lyrics: %w", err)
+		}
+		report = append(report, filepath.ToSlash(rel)+"\t"+mf.Entry.PathDisplay)
+	}
+
+	sort.Strings(report)
+	content := "sidecar\tdropbox_path\n"
+	if len(report) > 0 {
+		content += strings.Join(report, "\n") + "\n"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return len(report), fmt.Errorf("creating lyrics directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, lyricsReportName), []byte(content), 0o644); err != nil {
+		return len(report), fmt.Errorf("writing lyrics report: %w", err)
+	}
+
+	return len(report), nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestLyricsExt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		lyrics string
+		want   string
+	}{
+		{"plain", "First line\nSecond line", ".txt"},
+		{"LRC", "[ar:Artist]\n[00:12.34]First line\n[00:15.00]Second line", ".lrc"},
+		{"LRC without fraction", "[1:02]Line", ".lrc"},
+		{"bracketed text", "[Chorus]\nLa la", ".txt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, lyricsExt(test.lyrics))
+		})
+	}
+}
+
+func TestExportLyrics(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	matched := []matcher.MatchedFile{
+		{LocalPath: "/music/Album/01 Plain.mp3", Entry: dropbox.Entry{PathDisplay: "/Music/Album/01 Plain.mp3"}},
+		{LocalPath: "/music/Album/02 Synced.flac", Entry: dropbox.Entry{PathDisplay: "/Music/Album/02 Synced.flac"}},
+		{LocalPath: "/music/Album/03 None.mp3", Entry: dropbox.Entry{PathDisplay: "/Music/Album/03 None.mp3"}},
+		{LocalPath: "/music/Album/04 Failed.mp3", Entry: dropbox.Entry{PathDisplay: "/Music/Album/04 Failed.mp3"}},
+	}
+	metas := []tags.AudioMeta{
+		{Lyrics: "Unsynced words"},
+		{Lyrics: "[00:01.00]Synced words"},
+		{},
+		{Lyrics: "ignored"},
+	}
+	errs := []error{nil, nil, nil, context.Canceled}
+
+	n, err := exportLyrics(dir, "/music", matched, metas, errs)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	data, err := os.ReadFile(filepath.Join(dir, "Album", "01 Plain.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Unsynced words", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "Album", "02 Synced.lrc"))
+	require.NoError(t, err)
+	assert.Equal(t, "[00:01.00]Synced words", string(data))
+
+	assert.NoFileExists(t, filepath.Join(dir, "Album", "04 Failed.txt"))
+
+	report, err := os.ReadFile(filepath.Join(dir, lyricsReportName))
+	require.NoError(t, err)
+	assert.Equal(t, "sidecar\tdropbox_path\n"+
+		"Album/01 Plain.txt\t/Music/Album/01 Plain.mp3\n"+
+		"Album/02 Synced.lrc\t/Music/Album/02 Synced.flac\n", string(report))
+}
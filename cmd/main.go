@@ -2,16 +2,24 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/rs/zerolog"
 
@@ -24,19 +32,105 @@ import (
 	"github.com/sdelicata/cloudbeats-backup-generator/pkg/worker"
 )
 
+// minCacheHitRate is the hit rate below which a non-empty tag cache is reported as underperforming.
+const minCacheHitRate = 0.5
+
+// rootScanConfirmThreshold is the audio file count above which scanning the whole
+// Dropbox root asks for confirmation.
+const rootScanConfirmThreshold = 5000
+
+// Build metadata, set via -ldflags -X at build time.
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+
+	// defaultAppKey is an embedded public Dropbox app used for PKCE setup when
+	// no --app-key is given. Empty means users must bring their own app.
+	defaultAppKey = ""
+)
+
 func main() {
 	localDir := flag.String("local", "", "Path to the local folder to scan (required, must be inside the Dropbox folder)")
 	output := flag.String("output", "cloudbeats.cbbackup", "Path to the output .cbbackup file")
+	uploadTo := flag.String("upload-to", "", "Also upload the output to this Dropbox path (a folder if it ends with /), replacing any existing file")
+	fsync := flag.Bool("fsync", false, "Flush the output file to disk before exiting (safe to unmount removable drives right away)")
+	warningsPath := flag.String("warnings-file", "", "Also write per-file warnings (unmatched files, tag errors, album inconsistencies, ...) to this path as JSON lines")
+	summaryJSON := flag.String("summary-json", "", "Write a JSON summary of the run (counts, durations, cache stats, status) to this path")
+	compare := flag.String("compare", "", "Path to a previous .cbbackup to diff the new backup against")
+	basePath := flag.String("base", "", "Skip files whose Dropbox path already has an item in this .cbbackup (e.g. to add only new folders)")
+	compareJSON := flag.Bool("compare-json", false, "Print the --compare diff as JSON on stdout instead of a summary")
+	format := flag.String("format", "cbbackup", "Output format: cbbackup, csv, itunes (or json with --list-unmatched)")
+	durationPrecision := flag.String("duration-precision", "1", "Decimal places of track durations (0-3), optionally as round:N or truncate:N")
+	compatVersion := flag.String("compat-version", backup.LatestVersion, "CloudBeats backup schema revision to write: "+strings.Join(backup.SchemaVersions(), ", "))
+	groupByFlag := flag.String("group-by", "", "Also generate one playlist per album, artist, genre, or folder (cbbackup format only)")
 	token := flag.String("token", "", "Dropbox access token (also read from DROPBOX_TOKEN env var)")
 	appKey := flag.String("app-key", "", "Dropbox app key for refresh token auth (also read from DROPBOX_APP_KEY env var)")
 	appSecret := flag.String("app-secret", "", "Dropbox app secret for refresh token auth (also read from DROPBOX_APP_SECRET env var)")
 	refreshToken := flag.String("refresh-token", "", "Dropbox refresh token for automatic token renewal (also read from DROPBOX_REFRESH_TOKEN env var)")
+	reuseToken := flag.Bool("reuse-token", false, "Save refreshed access tokens in the config directory and reuse them in later runs until they are about to expire")
+	modifiedSinceFlag := flag.String("modified-since", "", "Only include Dropbox files modified since this time: a duration ago (e.g. 7d, 48h) or an RFC3339 timestamp")
+	rawPaths := flag.Bool("raw-paths", false, "Do not resolve symlinks when mapping --local or symlinked audio files to their Dropbox paths")
+	maxDepth := flag.Int("max-depth", 0, "Maximum folder depth to scan below --local (0 = unlimited, 1 = one level of subfolders)")
+	includeHidden := flag.Bool("include-hidden", false, "Also scan hidden files and folders, including macOS ._ resource forks")
+	extraRemoteFlag := flag.String("extra-remote", "", "Comma-separated extra Dropbox paths the --local folder also maps to (e.g. a shared folder), listed and matched after the main one")
+	matchFlag := flag.String("match", "path", "How local files are matched to Dropbox files: path (relative path) or filename (basename only, ignoring folders)")
+	includeDropboxOnly := flag.Bool("include-dropbox-only", false, "Also add Dropbox files with no local copy, with metadata inferred from their Dropbox path and no duration")
+	excludeShared := flag.Bool("exclude-shared", false, "Skip Dropbox files in shared folders, for CloudBeats accounts that only see their own files")
+	pathCaseCheck := flag.Bool("dropbox-path-case-check", false, "Warn if the --local folder's name differs only in case from the name Dropbox shows for it (harmless; explains the difference)")
+	syncLagRatio := flag.Float64("sync-lag-ratio", 0.5, "Warn when Dropbox lists fewer audio files than this fraction of the local ones, as while it is still uploading (0 = never)")
+	failOnSyncLag := flag.Bool("fail-on-sync-lag", false, "Exit with an error instead of only warning when Dropbox lists far fewer files than --local has (see --sync-lag-ratio)")
+	checkSizes := flag.Bool("check-sizes", false, "Skip matched files whose local size differs from Dropbox (partial downloads, files still syncing)")
+	traceHTTP := flag.Bool("trace-http", false, "Log every Dropbox API request (method, endpoint, status, duration); with --log-level trace also headers and bodies, token redacted")
+	apiRPS := flag.Float64("api-rps", 0, "Maximum Dropbox API requests per second, shared by all requests (0 = unlimited)")
+	rootNamespace := flag.String("dropbox-root-namespace", "", "Numeric Dropbox namespace ID to resolve paths against (e.g. a team space root), sent as Dropbox-API-Path-Root")
+	dropboxTimeout := flag.Duration("dropbox-timeout", dropbox.DefaultListTimeout, "How long each page of the Dropbox listing may take; other API calls keep a 30s timeout, uploads 15m per request")
 	workers := flag.Int("workers", 0, "Number of parallel workers for reading tags (0 = auto: 2x CPU cores)")
+	scanWorkers := flag.Int("scan-workers", 1, "Number of directories listed at once while scanning --local; raise it for network-mounted libraries")
+	var serializedFormats stringsFlag
+	flag.Var(&serializedFormats, "serialize-format", "Read files with this extension (e.g. ape) one at a time, for formats taglib cannot read concurrently; repeatable")
+	listUnmatched := flag.Bool("list-unmatched", false, "Only list local and Dropbox files that do not match each other, then exit (--format json for JSON)")
 	dryRun := flag.Bool("dry-run", false, "Show Dropbox mapping without reading tags or writing a file")
+	unknownAsEmpty := flag.Bool("unknown-as-empty", false, "Leave artist/album blank instead of \"Unknown\" when tags are absent")
+	inferAlbumArtist := flag.Bool("prefer-tag-albumartist-fallback", false, "Fill in missing album artists from the album's other tracks when they agree on one")
+	titleTemplateFlag := flag.String("title-template", "", "Title for files without a title tag, as a Go template over .Filename, .Stripped (no track-number prefix), and .Folder, e.g. \"{{.Stripped}}\"")
+	classicalTitles := flag.Bool("classical-titles", false, "Title tracks tagged with a work and movement as \"Work: II. Movement\" (e.g. \"Symphony No. 5: II. Andante\")")
+	primaryGenre := flag.Bool("primary-genre", false, "Use only the first genre of multi-value genres (e.g. \"Electronic; House\" becomes \"Electronic\")")
+	splitChapters := flag.Bool("split-chapters", false, "Detect chaptered .m4b/.m4a files and, with --format itunes, emit one track per chapter")
+	exportLyricsDir := flag.String("export-lyrics", "", "Also write embedded lyrics as .lrc/.txt sidecars with a report into this directory")
+	tagSourcesPath := flag.String("tag-sources-report", "", "Write a JSON report of where each file's title, artist, album, and other fields came from (tag, path, or default) to this path")
+	onTagError := flag.String("on-tag-error", "default", "What to do with files whose tags cannot be read: skip, default, abort")
+	manifestPath := flag.String("manifest", "", "Take the file list and metadata from this JSON manifest instead of scanning --local and reading tags")
+	writeTagsFlag := flag.Bool("write-tags", false, "Trim and Unicode-normalize names in the files' tags (and fill in inferred album artists), after a preview and confirmation")
+	fixAlbumsFlag := flag.Bool("fix-albums", false, "For each album whose tracks disagree on album artist or year, ask which value to keep and write it to the files")
+	noTags := flag.Bool("no-tags", false, "Skip reading tags: infer title, track, artist, and album from Artist/Album/NN Title paths (durations are 0)")
+	withDuration := flag.Bool("with-duration", false, "With --no-tags, still read each file's duration (audio properties only, no tag parsing)")
 	noCache := flag.Bool("no-cache", false, "Disable the tag cache (re-parse all files)")
+	cacheMaxEntries := flag.Int("cache-max-entries", 0, "Keep at most N tag cache entries, dropping the least recently used (0 = unlimited)")
+	var cacheBypassDirs stringsFlag
+	flag.Var(&cacheBypassDirs, "cache-bypass", "Re-parse files under this folder (relative to --local) even if cached; repeatable")
+	cacheRelative := flag.Bool("cache-relative", false, "Key the tag cache on paths relative to --local, so it stays valid when the library is moved or mounted elsewhere")
+	cacheMaxAgeFlag := flag.String("cache-max-age", "", "Drop tag cache entries unused for longer than this, e.g. 90d or 720h (empty = forever)")
+	resumeCheckpoint := flag.Bool("resume-checkpoint", false, "Record tagged files in <output>.checkpoint as they are read, and skip the ones recorded by an earlier run that was killed")
+	savePartial := flag.Bool("save-partial", false, "On interrupt, write a partial output with the files tagged so far")
+	noProgress := flag.Bool("no-progress", false, "Disable the progress line (log output is unaffected)")
+	profileCPU := flag.String("profile-cpu", "", "Write a pprof CPU profile of the run to this file")
+	profileMem := flag.String("profile-mem", "", "Write a pprof heap profile to this file when the run ends")
 	logLevel := flag.String("log-level", "info", "Log level: trace, debug, info, warn, error")
+	maxUnmatchedLog := flag.Int("max-unmatched-log", 50, "Log at most N unmatched local and Dropbox files each at debug level (0 = all)")
+	resetAll := flag.Bool("reset-all", false, "Delete stored credentials, configuration, and tag caches, then exit")
+	exportCache := flag.String("export-cache", "", "Write the tag cache as a JSON manifest (usable with --manifest) to this path and exit")
+	inspect := flag.String("inspect", "", "Print the tags read from a single audio file as JSON and exit")
+	yes := flag.Bool("yes", false, "Never prompt: proceed past confirmations and fail fast if credentials are missing")
+	flag.BoolVar(yes, "non-interactive", false, "Alias for --yes")
+	showVersion := flag.Bool("version", false, "Print version information and exit")
 	flag.Parse()
 
+	if *showVersion {
+		fmt.Printf("cloudbeats-backup-generator %s (commit %s, built %s)\n", version, commit, date)
+		return
+	}
+
 	// Setup logger
 	level, err := zerolog.ParseLevel(*logLevel)
 	if err != nil {
@@ -46,60 +140,282 @@ func main() {
 		With().Timestamp().Logger().
 		Level(level)
 
+	stopProfiles, err := startProfiles(*profileCPU, *profileMem)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("starting profiling")
+	}
+	defer func() {
+		if err := stopProfiles(); err != nil {
+			logger.Warn().Err(err).Msg("writing profiles")
+		}
+	}()
+	// Fatal errors exit without running defers: finish the profiles first
+	logger = logger.Hook(zerolog.HookFunc(func(_ *zerolog.Event, level zerolog.Level, _ string) {
+		if level == zerolog.FatalLevel {
+			if err := stopProfiles(); err != nil {
+				fmt.Fprintf(os.Stderr, "writing profiles: %v\n", err)
+			}
+		}
+	}))
+
+	runStart := time.Now()
+
+	if *inspect != "" {
+		if err := inspectFile(os.Stdout, *inspect); err != nil {
+			logger.Fatal().Err(err).Msg("inspecting file")
+		}
+		return
+	}
+
+	if *exportCache != "" {
+		if err := exportTagCache(*exportCache, cache.Load(cache.DefaultPath(), logger)); err != nil {
+			logger.Fatal().Err(err).Msg("exporting tag cache")
+		}
+		return
+	}
+
+	if *resetAll {
+		paths, err := appDataPaths()
+		if err != nil {
+			logger.Fatal().Err(err).Msg("locating app data")
+		}
+		if len(paths) == 0 {
+			fmt.Fprintln(os.Stderr, "No app data found.")
+			return
+		}
+		for _, p := range paths {
+			fmt.Fprintf(os.Stderr, "  %s: %s (%s)\n", p.Label, p.Path, formatBytes(p.Size))
+		}
+		if !*yes {
+			if !isInteractive() {
+				logger.Fatal().Msg("--reset-all needs confirmation; pass --yes to proceed")
+			}
+			if !confirm("Delete all of the above?") {
+				logger.Fatal().Msg("aborted, nothing removed")
+			}
+		}
+		if err := removeAppData(os.Stderr, paths); err != nil {
+			logger.Fatal().Err(err).Msg("resetting app data")
+		}
+		return
+	}
+
 	// Validate required flags
 	if *localDir == "" {
 		logger.Fatal().Msg("--local flag is required")
 	}
+	switch *format {
+	case "cbbackup", "csv", "itunes":
+	case "json":
+		if !*listUnmatched {
+			logger.Fatal().Msg("--format json only applies to --list-unmatched")
+		}
+	default:
+		logger.Fatal().Str("format", *format).Msg("--format must be one of: cbbackup, csv, itunes (or json with --list-unmatched)")
+	}
+
+	if *withDuration && !*noTags {
+		logger.Fatal().Msg("--with-duration only applies with --no-tags (durations are always read from tags)")
+	}
+	if *manifestPath != "" && *noTags {
+		logger.Fatal().Msg("--manifest and --no-tags are mutually exclusive: the manifest already supplies the metadata")
+	}
+	if *fixAlbumsFlag && (*noTags || *manifestPath != "") {
+		logger.Fatal().Msg("--fix-albums rewrites file tags, so it cannot be combined with --no-tags or --manifest")
+	}
+	if *resumeCheckpoint && (*noTags || *manifestPath != "") {
+		logger.Fatal().Msg("--resume-checkpoint only applies when reading tags from the files")
+	}
+	if *writeTagsFlag && (*noTags || *manifestPath != "") {
+		logger.Fatal().Msg("--write-tags rewrites file tags, so it cannot be combined with --no-tags or --manifest")
+	}
+	if *dropboxTimeout <= 0 {
+		logger.Fatal().Dur("dropbox_timeout", *dropboxTimeout).Msg("--dropbox-timeout must be positive")
+	}
+	if *syncLagRatio < 0 {
+		logger.Fatal().Float64("sync_lag_ratio", *syncLagRatio).Msg("--sync-lag-ratio must not be negative")
+	}
+	uploadDest, err := uploadPath(*uploadTo, *output)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --upload-to")
+	}
+	schema, err := backup.ParseSchema(*compatVersion)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --compat-version")
+	}
+	durationFormat, err := backup.ParseDurationFormat(*durationPrecision)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --duration-precision")
+	}
+	backup.SetDurationFormat(durationFormat)
+	groupBy, err := backup.ParseGroupBy(*groupByFlag)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --group-by")
+	}
+	if groupBy != backup.GroupByNone && *format != "cbbackup" {
+		logger.Fatal().Msg("--group-by only applies to the cbbackup format")
+	}
+	var titleTemplate *backup.TitleTemplate
+	if *titleTemplateFlag != "" {
+		titleTemplate, err = backup.ParseTitleTemplate(*titleTemplateFlag)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("invalid --title-template")
+		}
+	}
+	matchMode, err := matcher.ParseMatchMode(*matchFlag)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --match")
+	}
+	extraRemotePaths, err := parseRemotePaths(*extraRemoteFlag)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --extra-remote")
+	}
+	tagErrorPolicy, err := tags.ParseErrorPolicy(*onTagError)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --on-tag-error")
+	}
+	cacheMaxAge, err := parseAge(*cacheMaxAgeFlag)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --cache-max-age")
+	}
+	modifiedSince, err := parseSince(*modifiedSinceFlag, time.Now())
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --modified-since")
+	}
+	if !modifiedSince.IsZero() {
+		logger.Warn().Time("modified_since", modifiedSince).
+			Msg("only files modified since the cutoff are included; the output will not be a full library")
+	}
+
+	// Fail now rather than after the scan and tag run if the output cannot be written
+	if !*dryRun && !*listUnmatched {
+		if err := backup.CheckWritable(*output); err != nil {
+			logger.Fatal().Err(err).Msg("checking --output")
+		}
+	}
 
 	// Resolve Dropbox access token
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	// --token - / --refresh-token - read the secret from stdin, which then cannot answer prompts
+	stdinUsed, err := readStdinSecret(os.Stdin, token, refreshToken)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("reading secret from stdin")
+	}
+
 	ak := firstNonEmpty(*appKey, os.Getenv("DROPBOX_APP_KEY"))
 	as := firstNonEmpty(*appSecret, os.Getenv("DROPBOX_APP_SECRET"))
 	rt := firstNonEmpty(*refreshToken, os.Getenv("DROPBOX_REFRESH_TOKEN"))
 	dt := firstNonEmpty(*token, os.Getenv("DROPBOX_TOKEN"))
 
-	tok, err := resolveToken(ctx, ak, as, rt, dt, logger)
+	// --yes forces non-interactive behavior even when a terminal is attached
+	interactive := !*yes && !stdinUsed && isInteractive()
+	if *fixAlbumsFlag {
+		if err := fixAlbumsPromptable(*yes, stdinUsed, isInteractive()); err != nil {
+			logger.Fatal().Err(err).Msg("cannot use --fix-albums")
+		}
+	}
+
+	if warning, ok := tokenMixupWarning(rt); ok {
+		logger.Warn().Msg(warning)
+	}
+
+	tokens := &tokenCache{}
+	if *reuseToken {
+		if path, err := tokenCachePath(); err != nil {
+			logger.Warn().Err(err).Msg("cannot save access tokens, --reuse-token has no effect")
+		} else {
+			tokens = loadTokenCache(path, logger)
+		}
+	}
+	refresh := refresher(dropbox.RefreshAccessTokenWithExpiry)
+	tok, err := resolveToken(ctx, tokens, refresh, ak, as, rt, dt, logger)
 	if err != nil {
-		if !isInteractive() {
+		if !interactive {
 			logger.Fatal().Err(err).Msg("resolving Dropbox token")
 		}
 
 		// Interactive auto-setup
 		logger.Warn().Msg("no Dropbox credentials found, starting interactive setup...")
-		if ak == "" {
-			ak = promptValue("Dropbox app key")
-		}
-		if as == "" {
-			as = promptValue("Dropbox app secret")
+		if ak == "" && defaultAppKey != "" {
+			// Embedded public app: PKCE needs no secret, only the user's consent
+			ak = defaultAppKey
+		} else {
+			if ak == "" {
+				ak = promptValue("Dropbox app key")
+			}
+			if as == "" {
+				as = promptValue("Dropbox app secret")
+			}
 		}
 		if err := runAuth(ctx, ak, as, logger); err != nil {
 			logger.Fatal().Err(err).Msg("authorization failed")
 		}
 
 		// Retry with saved credentials
-		tok, err = resolveToken(ctx, "", "", "", "", logger)
+		tok, err = resolveToken(ctx, tokens, refresh, "", "", "", "", logger)
 		if err != nil {
 			logger.Fatal().Err(err).Msg("resolving Dropbox token after setup")
 		}
 	}
 
+	summary := runSummary{Format: *format}
+	finishSummary := func(status string) {
+		if *summaryJSON == "" {
+			return
+		}
+		summary.Status = status
+		summary.Durations.Total = ms(time.Since(runStart))
+		if err := writeSummary(*summaryJSON, summary); err != nil {
+			logger.Warn().Err(err).Msg("writing run summary")
+		}
+	}
+
 	// Auto-detect or validate workers
 	if *workers <= 0 {
 		*workers = runtime.NumCPU() * 2
 	}
 
 	// Resolve local dir to absolute path
-	absLocal, err := filepath.Abs(*localDir)
+	absLocal, err := resolveLocalDir(*localDir, os.Getenv(libraryRootEnv))
 	if err != nil {
 		logger.Fatal().Err(err).Msg("resolving local path")
 	}
 
+	var manifest *tags.Manifest
+	if *manifestPath != "" {
+		manifest, err = tags.LoadManifest(*manifestPath)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("loading --manifest")
+		}
+		manifest.Resolve(absLocal)
+	}
+
+	var base *backup.Backup
+	if *basePath != "" {
+		if base, err = backup.Read(*basePath); err != nil {
+			logger.Fatal().Err(err).Msg("reading --base backup")
+		}
+	}
+
 	// Step 1: Authenticate with Dropbox
-	client := dropbox.NewClient(tok, logger)
+	client := dropbox.NewClient(tok.value, logger)
+	client.SetLimiter(dropbox.NewLimiter(*apiRPS))
+	client.SetListTimeout(*dropboxTimeout)
+	if err := client.SetPathRoot(*rootNamespace); err != nil {
+		logger.Fatal().Err(err).Msg("invalid --dropbox-root-namespace")
+	}
+	if *traceHTTP {
+		client.EnableTrace()
+	}
 	logger.Info().Msg("authenticating with Dropbox...")
-	accountID, err := client.GetAccountID(ctx)
+	var accountID string
+	err = retryRejectedToken(ctx, client, &tok, logger, func() error {
+		var err error
+		accountID, err = client.GetAccountID(ctx)
+		return err
+	})
 	if err != nil {
 		logger.Fatal().Err(err).Msg("authenticating with Dropbox")
 	}
@@ -113,41 +429,236 @@ func main() {
 	logger.Info().Str("dropbox_root", dropboxRoot).Msg("detected Dropbox root")
 
 	// Step 2b: Compute remote path
-	remotePath, err := dropbox.ComputeRemotePath(absLocal, dropboxRoot)
+	var remotePath string
+	if *rawPaths {
+		remotePath, err = dropbox.ComputeRawRemotePath(absLocal, dropboxRoot)
+	} else {
+		remotePath, err = dropbox.ComputeRemotePath(absLocal, dropboxRoot, logger)
+	}
 	if err != nil {
 		logger.Fatal().Err(err).Msg("computing remote path")
 	}
 	logger.Info().Str("remote_path", remotePath).Msg("computed remote path")
+	if *pathCaseCheck && remotePath != "" {
+		if folder, err := client.GetMetadata(ctx, remotePath); err != nil {
+			logger.Warn().Err(err).Msg("checking the case of the Dropbox folder")
+		} else if local, differs := folderCaseMismatch(absLocal, folder.Name); differs {
+			logger.Warn().Str("local", local).Str("dropbox", folder.Name).
+				Msg("the local folder name differs from Dropbox only in case; this is harmless, " +
+					"Dropbox paths are case-insensitive and files are matched regardless of case")
+		} else {
+			logger.Debug().Str("local", local).Str("dropbox", folder.Name).Msg("checked the case of the Dropbox folder")
+		}
+	}
 
 	// Step 2c: Scan local files
-	logger.Info().Str("dir", absLocal).Msg("scanning local files...")
-	localFiles, err := matcher.ScanLocal(absLocal)
-	if err != nil {
-		logger.Fatal().Err(err).Msg("scanning local directory")
+	if remotePath == "" {
+		logger.Info().Str("dir", absLocal).Msg("scanning entire Dropbox root")
+	}
+	var warnings *warningStream
+	if *warningsPath != "" {
+		if warnings, err = createWarningStream(*warningsPath); err != nil {
+			logger.Fatal().Err(err).Msg("opening warnings file")
+		}
+		defer func() {
+			if err := warnings.Close(); err != nil {
+				logger.Warn().Err(err).Msg("writing warnings file")
+			}
+		}()
 	}
+
+	scanStart := time.Now()
+	var localFiles []string
+	var scanStats matcher.ScanStats
+	if manifest != nil {
+		// The manifest stands in for the library: nothing below --local is read
+		localFiles = manifest.Paths()
+		logger.Info().Str("manifest", *manifestPath).Msg("using manifest instead of scanning local files")
+	} else {
+		logger.Info().Str("dir", absLocal).Msg("scanning local files...")
+		localFiles, scanStats, err = matcher.ScanLocalStats(absLocal, matcher.ScanOptions{
+			MaxDepth:      *maxDepth,
+			IncludeHidden: *includeHidden,
+			Concurrency:   *scanWorkers,
+			OnSkip: func(path string, err error) {
+				logger.Warn().Err(err).Str("path", path).Msg("skipping entry that changed during the scan")
+				warnings.Emit(warnScanSkipped, path, err.Error())
+			},
+		})
+		if err != nil {
+			logger.Fatal().Err(err).Msg("scanning local directory")
+		}
+	}
+	summary.Durations.Scan = ms(time.Since(scanStart))
+	summary.LocalFiles = len(localFiles)
 	logger.Info().Int("count", len(localFiles)).Msg("local audio files found")
+	if skipped := scanStats.TopSkipped(5); len(skipped) > 0 {
+		logger.Info().Str("top", formatExtensionCounts(skipped)).Msg("skipped non-audio files")
+	}
+
+	// Pointing --local at the Dropbox root by mistake picks up everything in the account
+	if remotePath == "" && len(localFiles) > rootScanConfirmThreshold && !*yes {
+		if !interactive {
+			logger.Fatal().Int("count", len(localFiles)).
+				Msg("--local is the Dropbox root and contains many audio files; pass --yes to proceed anyway")
+		}
+		if !confirm(fmt.Sprintf("--local is your whole Dropbox (%d audio files). Continue?", len(localFiles))) {
+			logger.Fatal().Msg("aborted; point --local at your music folder instead")
+		}
+	}
 
 	// Step 2d: List Dropbox files
+	if err := renewBeforeListing(ctx, client, &tok, time.Now(), logger); err != nil {
+		logger.Fatal().Err(err).Msg("authentication failed")
+	}
 	logger.Info().Msg("listing Dropbox files...")
-	entries, err := client.ListFolder(ctx, remotePath)
+	listStart := time.Now()
+	entries, err := client.ListFolderSince(ctx, remotePath, modifiedSince)
 	if err != nil {
+		if errors.Is(err, dropbox.ErrPathNotFound) {
+			logger.Fatal().Str("remote_path", remotePath).
+				Msg("this folder does not exist in Dropbox yet; wait for Dropbox Desktop to finish syncing it and try again")
+		}
 		logger.Fatal().Err(err).Msg("listing Dropbox folder")
 	}
+	for _, extra := range extraRemotePaths {
+		logger.Info().Str("remote_path", extra).Msg("listing extra Dropbox path...")
+		more, err := client.ListFolderSince(ctx, extra, modifiedSince)
+		if err != nil {
+			logger.Fatal().Err(err).Str("remote_path", extra).Msg("listing extra Dropbox folder")
+		}
+		entries = append(entries, more...)
+	}
+	summary.Durations.List = ms(time.Since(listStart))
+	summary.RemotePath = remotePath
+	summary.DropboxFiles = len(entries)
+
+	// A folder still uploading lists a fraction of the library: the backup would be mostly empty.
+	// A --modified-since listing is partial by design.
+	if remote, lagging := syncLagged(len(localFiles), entries, *syncLagRatio); lagging && modifiedSince.IsZero() {
+		ev := logger.Warn()
+		if *failOnSyncLag {
+			ev = logger.Fatal()
+		}
+		ev.Int("local", len(localFiles)).Int("dropbox", remote).
+			Msg("Dropbox lists far fewer audio files than --local has; it is probably still uploading. " +
+				"Wait for Dropbox to finish syncing and run again")
+	}
 
 	// Step 2e: Match local files with Dropbox entries
-	result := matcher.Match(absLocal, remotePath, localFiles, entries)
+	matchOpts := matcher.MatchOptions{
+		Mode:             matchMode,
+		ExtraRemotePaths: extraRemotePaths,
+	}
+	if !*rawPaths {
+		matchOpts.DropboxRoot = dropboxRoot
+		matchOpts.Symlinks = scanStats.Symlinks
+	}
+	result := matcher.Match(absLocal, remotePath, localFiles, entries, matchOpts)
+	switch {
+	case manifest != nil:
+		// Metadata recorded for another version of a file would be wrong for this one
+		result.CheckSizesAgainst(manifest.Size)
+	case *checkSizes:
+		result.CheckSizes()
+	}
+	if base != nil {
+		skipPaths, unresolved := basePaths(base, entries)
+		if unresolved > 0 {
+			logger.Warn().Int("count", unresolved).
+				Msg("--base items without a path that are not in the Dropbox listing are ignored")
+		}
+		result.SkipPaths(skipPaths)
+	}
+	if !modifiedSince.IsZero() {
+		result.SkipOutOfRange(modifiedSince)
+	}
+	if *excludeShared {
+		result.SkipShared()
+	} else if n := result.CountShared(); n > 0 {
+		logger.Info().Int("count", n).
+			Msg("matched files are in shared folders; pass --exclude-shared if CloudBeats cannot see them")
+	}
 	logger.Info().
 		Int("matched", len(result.Matched)).
+		Int("conflicts", len(result.Conflicts)).
 		Int("unmatched_local", len(result.UnmatchedLocal)).
 		Int("unmatched_dropbox", len(result.UnmatchedDropbox)).
+		Int("size_mismatches", len(result.SizeMismatches)).
+		Int("in_base", len(result.InBase)).
+		Int("shared", len(result.Shared)).
+		Int("out_of_range", len(result.OutOfRange)).
 		Msg("matching complete")
+	summary.Matched = len(result.Matched)
+	summary.UnmatchedLocal = len(result.UnmatchedLocal)
+	summary.UnmatchedDropbox = len(result.UnmatchedDropbox)
+	summary.Conflicts = len(result.Conflicts)
+	summary.SizeMismatches = len(result.SizeMismatches)
+	summary.InBase = len(result.InBase)
+	summary.Shared = len(result.Shared)
+	summary.OutOfRange = len(result.OutOfRange)
 
 	// Log unmatched files
-	for _, path := range result.UnmatchedLocal {
+	logCapped(logger, result.UnmatchedLocal, *maxUnmatchedLog, "local files without a Dropbox match", func(path string) {
 		logger.Debug().Str("file", path).Msg("local file has no Dropbox match (skipped)")
+	})
+	for _, path := range result.UnmatchedLocal {
+		warnings.Emit(warnUnmatchedLocal, path, "")
 	}
-	for _, entry := range result.UnmatchedDropbox {
+	if manifest != nil && len(result.UnmatchedLocal) > 0 {
+		logger.Warn().Int("count", len(result.UnmatchedLocal)).
+			Msg("manifest entries have no Dropbox match; check that their paths are relative to --local")
+	}
+	for _, c := range result.Conflicts {
+		candidates := make([]string, len(c.Candidates))
+		for i, e := range c.Candidates {
+			candidates[i] = e.PathDisplay
+		}
+		logger.Warn().Str("file", c.LocalPath).Strs("candidates", candidates).
+			Msg("ambiguous filename, not matched")
+		warnings.Emit(warnAmbiguousName, c.LocalPath, "candidates: "+strings.Join(candidates, ", "))
+	}
+	for _, m := range result.SizeMismatches {
+		logger.Warn().Str("file", m.LocalPath).Int64("local_size", m.LocalSize).Int64("dropbox_size", m.RemoteSize).
+			Msg("local size differs from Dropbox, skipped (still syncing?)")
+		warnings.Emit(warnSizeMismatch, m.LocalPath,
+			fmt.Sprintf("local size %d bytes, Dropbox size %d bytes", m.LocalSize, m.RemoteSize))
+	}
+	for _, mf := range result.InBase {
+		logger.Debug().Str("path", mf.Entry.PathDisplay).Msg("already in --base backup (skipped)")
+	}
+	for _, mf := range result.Shared {
+		logger.Debug().Str("path", mf.Entry.PathDisplay).Msg("in a shared folder (skipped)")
+	}
+	logCapped(logger, result.UnmatchedDropbox, *maxUnmatchedLog, "Dropbox files without a local match", func(entry dropbox.Entry) {
 		logger.Debug().Str("path", entry.PathDisplay).Msg("Dropbox file has no local match")
+	})
+	for _, entry := range result.UnmatchedDropbox {
+		warnings.Emit(warnUnmatchedDropbox, entry.PathDisplay, "")
+	}
+
+	// Troubleshooting: report only what did not match, and exit
+	if *listUnmatched {
+		report := newUnmatchedReport(absLocal, result)
+		if *format == "json" {
+			if err := writeUnmatchedJSON(os.Stdout, report); err != nil {
+				logger.Fatal().Err(err).Msg("writing unmatched files")
+			}
+		} else {
+			printUnmatched(os.Stdout, report)
+		}
+		finishSummary(statusDryRun)
+		return
+	}
+
+	// Dropbox-only files follow the local scan's --max-depth and hidden-file rules
+	var dropboxOnly []dropbox.Entry
+	dropboxRoots := append([]string{remotePath}, extraRemotePaths...)
+	if *includeDropboxOnly {
+		dropboxOnly = dropboxOnlyEntries(dropboxRoots, result.UnmatchedDropbox, matcher.ScanOptions{
+			MaxDepth:      *maxDepth,
+			IncludeHidden: *includeHidden,
+		})
 	}
 
 	// Dry-run: print summary and exit
@@ -159,97 +670,535 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Matched:           %d\n", len(result.Matched))
 		fmt.Fprintf(os.Stderr, "Unmatched local:   %d\n", len(result.UnmatchedLocal))
 		fmt.Fprintf(os.Stderr, "Unmatched Dropbox: %d\n", len(result.UnmatchedDropbox))
+		if matchMode == matcher.MatchByFilename {
+			fmt.Fprintf(os.Stderr, "Name conflicts:    %d\n", len(result.Conflicts))
+		}
+		if *checkSizes || manifest != nil {
+			fmt.Fprintf(os.Stderr, "Size mismatches:   %d\n", len(result.SizeMismatches))
+		}
+		if *basePath != "" {
+			fmt.Fprintf(os.Stderr, "Already in base:   %d\n", len(result.InBase))
+		}
+		if *excludeShared {
+			fmt.Fprintf(os.Stderr, "Shared (skipped):  %d\n", len(result.Shared))
+		}
+		if !modifiedSince.IsZero() {
+			fmt.Fprintf(os.Stderr, "Older than cutoff: %d\n", len(result.OutOfRange))
+		}
+		if *includeDropboxOnly {
+			fmt.Fprintf(os.Stderr, "Dropbox-only:      %d\n", len(dropboxOnly))
+		}
+		finishSummary(statusDryRun)
 		return
 	}
 
+	// Lyrics are only extracted on request: they are large and would bloat the tag cache
+	readOpts := tags.ReadOptions{Lyrics: *exportLyricsDir != ""}
+	readMeta, err := serializeFormats(newTagReader(*noTags, *withDuration, absLocal, readOpts), serializedFormats)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("invalid --serialize-format")
+	}
+	if manifest != nil {
+		readMeta = newManifestReader(manifest, absLocal)
+	}
+	if *noTags {
+		logger.Info().Msg("--no-tags: building items from file paths only")
+	}
+
 	// Load tag cache
 	var tagCache *cache.TagCache
-	if !*noCache {
-		tagCache = cache.Load(defaultCachePath(), logger)
-		logger.Info().Int("entries", tagCache.Len()).Msg("tag cache loaded")
+	var cachedBefore int
+	// Path-derived and manifest metadata must not be cached as if it came from the tags
+	if !*noCache && !*noTags && manifest == nil {
+		tagCache = cache.Load(cache.DefaultPath(), logger)
+		tagCache.SetEvictionPolicy(cache.EvictionPolicy{MaxEntries: *cacheMaxEntries, MaxAge: cacheMaxAge})
+		tagCache.SetLyrics(readOpts.Lyrics)
+		if *cacheRelative {
+			tagCache.SetRelativeRoot(absLocal)
+		}
+		cachedBefore = tagCache.Len()
+		logger.Info().Int("entries", cachedBefore).Msg("tag cache loaded")
+	}
+
+	var ckpt *checkpoint
+	if *resumeCheckpoint {
+		var err error
+		if ckpt, err = openCheckpoint(checkpointPath(*output)); err != nil {
+			logger.Fatal().Err(err).Msg("opening --resume-checkpoint file")
+		}
+		if n := ckpt.Len(); n > 0 {
+			logger.Info().Int("files", n).Msg("resuming: skipping files tagged by the interrupted run")
+		}
 	}
 
 	// Step 3: Read tags with worker pool
 	logger.Info().Int("workers", *workers).Msg("reading audio tags...")
 	total := len(result.Matched)
 
+	// Per-file timing is only collected when its output can be seen.
+	timed := logger.GetLevel() <= zerolog.DebugLevel
+	var timingsMu sync.Mutex
+	var timings []fileTiming
+
+	var progress worker.ItemProgressFunc
+	progressWidth := terminalWidth(os.Stderr)
+	if !*noProgress {
+		// collectItems reports from the one goroutine draining the results, so
+		// calls never overlap and done only grows
+		progress = func(done, total, index int) {
+			name := result.Matched[index].LocalPath
+			if rel, err := filepath.Rel(absLocal, name); err == nil {
+				name = filepath.ToSlash(rel)
+			}
+			fmt.Fprint(os.Stderr, progressLine(done, total, name, progressWidth))
+		}
+	}
+
+	itemOpts := backup.ItemOptions{
+		UnknownAsEmpty:  *unknownAsEmpty,
+		PrimaryGenre:    *primaryGenre,
+		TitleTemplate:   titleTemplate,
+		ClassicalTitles: *classicalTitles,
+	}
+
+	bypassCache := cacheBypass(absLocal, cacheBypassDirs)
 	var cacheHits atomic.Int64
-	metas, errs := worker.Process(ctx, result.Matched, *workers,
-		func(_ context.Context, mf matcher.MatchedFile) (tags.AudioMeta, error) {
-			if tagCache != nil {
-				if meta, ok := tagCache.Lookup(mf.LocalPath); ok {
-					cacheHits.Add(1)
-					return meta, nil
-				}
+	tagsStart := time.Now()
+	readTags := func(_ context.Context, mf matcher.MatchedFile) (tags.AudioMeta, error) {
+		if meta, ok := lookupCache(tagCache, bypassCache, mf.LocalPath); ok {
+			cacheHits.Add(1)
+			return meta, nil
+		}
+		if meta, ok := lookupCheckpoint(ckpt, bypassCache, mf.LocalPath); ok {
+			return meta, nil
+		}
+		if !timed {
+			meta, err := readMeta(mf.LocalPath)
+			if err == nil {
+				ckpt.Record(mf.LocalPath, meta)
 			}
-			return tags.ReadFile(mf.LocalPath)
-		},
-		func(done, total int) {
-			fmt.Fprintf(os.Stderr, "\rProcessing: %d/%d files", done, total)
-		},
+			return meta, err
+		}
+
+		start := time.Now()
+		meta, err := readMeta(mf.LocalPath)
+		elapsed := time.Since(start)
+		logger.Trace().Str("file", mf.LocalPath).Dur("elapsed", elapsed).Msg("read tags")
+
+		timingsMu.Lock()
+		timings = append(timings, fileTiming{path: mf.LocalPath, elapsed: elapsed})
+		timingsMu.Unlock()
+		if err == nil {
+			ckpt.Record(mf.LocalPath, meta)
+		}
+		return meta, err
+	}
+	// Metadata is only kept for the steps below that need it, so large
+	// libraries do not hold every file's tags (lyrics included) until the end
+	keepMetas := *writeTagsFlag || *exportLyricsDir != "" || *tagSourcesPath != ""
+	items, metas, errs, abortErr := collectItems(
+		worker.ProcessStream(ctx, result.Matched, *workers,
+			func(ctx context.Context, mf matcher.MatchedFile) (tags.AudioMeta, error) {
+				meta, err := readTags(ctx, mf)
+				if err == nil && tagCache != nil {
+					tagCache.Store(mf.LocalPath, meta)
+				}
+				return meta, err
+			},
+		),
+		accountID, result.Matched, keepMetas, tagErrorPolicy, itemOpts, progress,
 	)
-	fmt.Fprintf(os.Stderr, "\rProcessing: %d/%d files\n", total, total)
+	interrupted := ctx.Err() != nil
+	summary.Durations.Tags = ms(time.Since(tagsStart))
+	if progress != nil {
+		if !interrupted {
+			fmt.Fprintln(os.Stderr, progressLine(total, total, "", progressWidth))
+		} else {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+
+	if timed {
+		logSlowestFiles(logger, timings, 10)
+	}
 
 	// Log any tag reading errors (e.g. taglib panics)
 	for i, err := range errs {
-		if err != nil {
+		if err != nil && !isCanceled(err) {
+			summary.TagErrors++
 			logger.Warn().Err(err).Str("file", result.Matched[i].LocalPath).Msg("error reading tags")
+			warnings.Emit(warnTagError, result.Matched[i].LocalPath, err.Error())
 		}
 	}
 
-	// Update and save tag cache
+	// Save the tag cache, which the reads above filled in
 	if tagCache != nil {
-		for i, mf := range result.Matched {
-			if errs[i] == nil {
-				tagCache.Store(mf.LocalPath, metas[i])
-			}
-		}
 		if err := tagCache.Save(); err != nil {
 			logger.Warn().Err(err).Msg("saving tag cache")
 		}
-		logger.Info().
+		summary.Cache = cacheSummary{
+			Enabled: true,
+			Hits:    int(cacheHits.Load()),
+			Parsed:  total - int(cacheHits.Load()),
+		}
+		if total > 0 {
+			summary.Cache.HitRate = float64(cacheHits.Load()) / float64(total)
+		}
+		stats := logger.Info().
 			Int("hits", int(cacheHits.Load())).
 			Int("parsed", total-int(cacheHits.Load())).
-			Msg("tag cache stats")
+			Int("entries_before", cachedBefore).
+			Int("entries_after", tagCache.Len())
+		if path := tagCache.Path(); path != "" {
+			stats = stats.Str("path", path)
+			if info, err := os.Stat(path); err == nil {
+				stats = stats.Int64("size_bytes", info.Size())
+			}
+		}
+		stats.Msg("tag cache stats")
+
+		// A mostly-missing cache usually means file sizes or mtimes keep changing between runs
+		if cachedBefore > 0 && total > 0 {
+			hitRate := float64(cacheHits.Load()) / float64(total)
+			if hitRate < minCacheHitRate {
+				logger.Warn().
+					Str("hit_rate", fmt.Sprintf("%.0f%%", hitRate*100)).
+					Msg("tag cache is underperforming: most files looked modified since the last run " +
+						"(check whether your sync client rewrites file timestamps)")
+			}
+		}
 	}
 
-	// Step 4: Build backup items
-	items := make([]backup.Item, len(result.Matched))
-	for i, mf := range result.Matched {
-		meta := metas[i]
-		item := backup.Item{
-			AccountID:   accountID,
-			Key:         mf.Entry.ID,
-			Name:        mf.Entry.Name,
-			Path:        "",
-			Service:     "dropbox",
-			Album:       meta.Album,
-			AlbumArtist: meta.AlbumArtist,
-			Artist:      meta.Artist,
-			DiskNumber:  meta.DiskNumber,
-			Duration:    backup.Duration(meta.Duration.Seconds()),
-			TagName:     meta.Title,
-			Year:        meta.Year,
+	// Once every file is read the checkpoint has served its purpose
+	if ckpt != nil {
+		if err := ckpt.Err(); err != nil {
+			logger.Warn().Err(err).Msg("writing checkpoint, later files were not recorded")
 		}
-		if meta.Genre != "" {
-			item.Genre = &meta.Genre
+		if interrupted {
+			if err := ckpt.Close(); err != nil {
+				logger.Warn().Err(err).Msg("saving checkpoint")
+			}
+			logger.Info().Str("checkpoint", checkpointPath(*output)).
+				Msg("progress saved; run the same command again to resume")
+		} else if err := ckpt.Remove(); err != nil {
+			logger.Warn().Err(err).Msg("removing checkpoint")
 		}
-		if meta.TrackNumber >= 0 {
-			item.TrackNumber = &meta.TrackNumber
+	}
+
+	outputPath := *output
+	if interrupted {
+		if !*savePartial {
+			logger.Fatal().Msg("interrupted, no output written (use --save-partial to keep the files tagged so far)")
+		}
+		outputPath = partialPath(*output)
+		logger.Warn().Str("output", outputPath).Msg("interrupted, writing partial output")
+	}
+
+	// Step 4: Add to the backup items built while reading tags
+	if abortErr != nil {
+		logger.Fatal().Err(abortErr).Msg("aborting on tag read error (--on-tag-error=abort)")
+	}
+	if *includeDropboxOnly {
+		extra := dropboxOnlyItems(accountID, dropboxRoots, dropboxOnly, itemOpts)
+		summary.DropboxOnly = len(extra)
+		logger.Info().Int("items", len(extra)).Msg("added Dropbox-only files without local tags")
+		items = append(items, extra...)
+	}
+
+	// Collapse duplicate entries (e.g. from overlapping shared folders)
+	if deduped := backup.Dedup(items); len(deduped) < len(items) {
+		summary.DuplicatesRemoved = len(items) - len(deduped)
+		logger.Warn().Int("removed", len(items)-len(deduped)).Msg("removed items with duplicate Dropbox IDs")
+		items = deduped
+	}
+
+	if *splitChapters {
+		items = applyChapters(items, result.Matched, *format == "itunes", tags.ReadChapters, logger)
+	}
+
+	if *inferAlbumArtist {
+		if n := backup.InferAlbumArtists(items); n > 0 {
+			logger.Info().Int("items", n).Msg("filled in missing album artists")
+		}
+	}
+
+	// Write the normalized tags back to the files, after showing what changes
+	if *writeTagsFlag {
+		changes := planTagWrites(result.Matched, metas, errs, items)
+		printTagChanges(os.Stderr, absLocal, changes)
+		switch {
+		case len(changes) == 0:
+			logger.Info().Msg("tags are already normalized, nothing to write")
+		case !*yes && !interactive:
+			logger.Warn().Int("files", len(changes)).Msg("--write-tags preview only; pass --yes to write these changes")
+		case !*yes && !confirm(fmt.Sprintf("Write tags to %d files?", len(changes))):
+			logger.Info().Msg("tags left unchanged")
+		default:
+			written := applyTagChanges(changes, tags.WriteTags, func(path string, err error) {
+				logger.Warn().Err(err).Str("file", path).Msg("writing tags")
+				warnings.Emit(warnTagWriteError, path, err.Error())
+			})
+			applyWrittenTags(items, metas, accountID, result.Matched, written, itemOpts)
+			logger.Info().Int("files", len(written)).Msg("tags written")
 		}
-		items[i] = item
+	}
+
+	// Flag tracks whose album-level tags disagree with the rest of their album
+	albumWarnings := backup.DetectAlbumInconsistencies(items)
+	localPaths := localPathsByKey(result.Matched)
+	for _, w := range albumWarnings {
+		file := albumWarningPath(w, localPaths)
+		logger.Warn().
+			Str("album", w.Album).
+			Str("field", w.Field).
+			Str("file", file).
+			Str("value", w.Value).
+			Str("majority", w.Majority).
+			Msg("inconsistent album tag")
+		warnings.Emit(warnAlbumInconsistency, file,
+			fmt.Sprintf("album %q: %s is %q, most tracks have %q", w.Album, w.Field, w.Value, w.Majority))
+	}
+	if *fixAlbumsFlag && len(albumWarnings) > 0 {
+		n := fixAlbums(items, albumWarnings, localPaths, os.Stdin, os.Stderr, writeAlbumField,
+			func(path string, err error) {
+				logger.Warn().Err(err).Str("file", path).Msg("writing album tag")
+				warnings.Emit(warnTagWriteError, path, err.Error())
+			})
+		logger.Info().Int("files", n).Msg("album tags rewritten")
+	}
+
+	if *exportLyricsDir != "" {
+		n, err := exportLyrics(*exportLyricsDir, absLocal, result.Matched, metas, errs)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("exporting lyrics")
+		}
+		logger.Info().Int("files", n).Str("dir", *exportLyricsDir).Msg("lyrics exported")
+	}
+	if *tagSourcesPath != "" {
+		if err := writeTagSourcesReport(*tagSourcesPath, newTagSourcesReport(absLocal, result.Matched, metas)); err != nil {
+			logger.Fatal().Err(err).Msg("writing tag sources report")
+		}
+		logger.Info().Str("path", *tagSourcesPath).Msg("tag sources report written")
 	}
 
 	b := &backup.Backup{
 		Items:     items,
-		Playlists: []backup.Playlist{},
+		Playlists: backup.BuildPlaylists(items, groupBy),
+	}
+	if groupBy != backup.GroupByNone {
+		logger.Info().Int("playlists", len(b.Playlists)).Str("group_by", string(groupBy)).Msg("playlists generated")
+	}
+
+	// Compare against a previous backup before replacing it
+	if *compare != "" {
+		old, err := backup.Read(*compare)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("reading backup to compare against")
+		}
+		d := backup.Diff(old, b)
+		if *compareJSON {
+			if err := writeDiffJSON(os.Stdout, d); err != nil {
+				logger.Fatal().Err(err).Msg("writing comparison")
+			}
+		} else {
+			printDiff(os.Stderr, *compare, d)
+		}
+	}
+
+	// Step 5: Write output file
+	if err := writeOutput(outputPath, *format, b, backup.WriteOptions{Sync: *fsync, Schema: schema}); err != nil {
+		logger.Fatal().Err(err).Msg("writing output file")
+	}
+	logger.Info().Str("output", outputPath).Str("format", *format).Int("items", len(items)).Msg("output file written")
+
+	if uploadDest != "" {
+		if interrupted {
+			logger.Warn().Msg("interrupted, not uploading the partial output")
+		} else if err := uploadOutput(ctx, client, outputPath, uploadDest); err != nil {
+			logger.Fatal().Err(err).Msg("uploading output to Dropbox")
+		} else {
+			logger.Info().Str("dropbox_path", uploadDest).Msg("output uploaded to Dropbox")
+		}
 	}
 
-	// Step 5: Write backup file
-	if err := backup.Write(*output, b); err != nil {
-		logger.Fatal().Err(err).Msg("writing backup file")
+	summary.Output = outputPath
+	summary.Items = len(items)
+	if interrupted {
+		finishSummary(statusPartial)
+	} else {
+		finishSummary(statusComplete)
 	}
-	logger.Info().Str("output", *output).Int("items", len(items)).Msg("backup file written")
+}
+
+// uploadPath validates the --upload-to destination: an absolute Dropbox path,
+// completed with the output's file name when it names a folder ("/Apps/CloudBeats/").
+// An empty dest disables the upload.
+func uploadPath(dest, output string) (string, error) {
+	if dest == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(dest, "/") {
+		return "", fmt.Errorf("path %q must start with /", dest)
+	}
+	if strings.HasSuffix(dest, "/") {
+		dest += filepath.Base(output)
+	}
+	return dest, nil
+}
+
+// uploadOutput uploads the file at path to dest in Dropbox, through an upload
+// session when it is too large for a single request.
+func uploadOutput(ctx context.Context, client *dropbox.Client, path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening output: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("reading output: %w", err)
+	}
+	upload := client.Upload
+	if info.Size() > dropbox.MaxUploadSize {
+		upload = client.UploadSession
+	}
+	if _, err := upload(ctx, dest, f); err != nil {
+		return fmt.Errorf("uploading to %s: %w", dest, err)
+	}
+	return nil
+}
+
+// isCanceled reports whether err stems from the run being interrupted.
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// partialPath labels an output path as partial, e.g. "lib.cbbackup" becomes "lib.partial.cbbackup".
+func partialPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".partial" + ext
+}
+
+func writeOutput(path, format string, b *backup.Backup, opts backup.WriteOptions) error {
+	if format == "cbbackup" {
+		return backup.Write(path, b, opts)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating output file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	switch format {
+	case "csv":
+		err = backup.WriteCSV(f, b.Items)
+	case "itunes":
+		err = backup.WriteITunesXML(f, b.Items)
+	default:
+		err = fmt.Errorf("unsupported output format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Sync {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("syncing output file: %w", err)
+		}
+	}
+	return f.Close()
+}
+
+// formatExtensionCounts renders counts as "1200 .jpg, 40 .pdf, 3 (no extension)".
+func formatExtensionCounts(counts []matcher.ExtensionCount) string {
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		ext := c.Ext
+		if ext == "" {
+			ext = "(no extension)"
+		}
+		parts[i] = fmt.Sprintf("%d %s", c.Count, ext)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// exportTagCache writes tc to path as a manifest.
+func exportTagCache(path string, tc *cache.TagCache) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	if err := tc.Export(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// inspectFile writes the metadata and raw tag map read from path to w as JSON.
+func inspectFile(w io.Writer, path string) error {
+	meta, raw, err := tags.ReadFileRaw(path)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		File    string              `json:"file"`
+		Meta    tags.AudioMeta      `json:"meta"`
+		RawTags map[string][]string `json:"raw_tags"`
+	}{path, meta, raw})
+}
+
+// fileTiming records how long reading tags from a single file took.
+type fileTiming struct {
+	path    string
+	elapsed time.Duration
+}
+
+// logSlowestFiles logs the n slowest tag reads at debug level, slowest first.
+func logSlowestFiles(logger zerolog.Logger, timings []fileTiming, n int) {
+	sort.Slice(timings, func(i, j int) bool {
+		return timings[i].elapsed > timings[j].elapsed
+	})
+	if len(timings) > n {
+		timings = timings[:n]
+	}
+	for i, ft := range timings {
+		logger.Debug().Int("rank", i+1).Str("file", ft.path).Dur("elapsed", ft.elapsed).Msg("slow tag read")
+	}
+}
+
+// stdinValue is the flag value that reads a secret from stdin instead of argv.
+const stdinValue = "-"
+
+// readStdinSecret replaces a "-" token or refresh token with the first line read from
+// stdin, and reports whether stdin was consumed. Only one of them may be "-".
+func readStdinSecret(stdin io.Reader, token, refreshToken *string) (bool, error) {
+	var target *string
+	switch {
+	case *token == stdinValue && *refreshToken == stdinValue:
+		return false, errors.New("only one of --token and --refresh-token can be read from stdin")
+	case *token == stdinValue:
+		target = token
+	case *refreshToken == stdinValue:
+		target = refreshToken
+	default:
+		return false, nil
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return true, err
+	}
+	value := strings.TrimSpace(line)
+	if value == "" {
+		return true, errors.New("stdin is empty")
+	}
+	*target = value
+	return true, nil
 }
 
 func isInteractive() bool {
@@ -266,8 +1215,24 @@ func promptValue(name string) string {
 	return strings.TrimSpace(value)
 }
 
+// confirm asks a yes/no question on stderr, defaulting to no.
+func confirm(question string) bool {
+	answer := strings.ToLower(promptValue(question + " [y/N]"))
+	return answer == "y" || answer == "yes"
+}
+
+// runAuth runs the OAuth2 code flow and stores the resulting credentials.
+// An empty appSecret selects the PKCE flow for public clients.
 func runAuth(ctx context.Context, appKey, appSecret string, logger zerolog.Logger) error {
+	var verifier string
 	authURL := dropbox.AuthorizationURL(appKey)
+	if appSecret == "" {
+		var err error
+		if verifier, err = dropbox.NewPKCEVerifier(); err != nil {
+			return err
+		}
+		authURL = dropbox.AuthorizationURLPKCE(appKey, verifier)
+	}
 	fmt.Fprintf(os.Stderr, "Opening authorization URL in your browser...\n\n  %s\n\n", authURL)
 	openBrowser(authURL)
 
@@ -283,7 +1248,13 @@ func runAuth(ctx context.Context, appKey, appSecret string, logger zerolog.Logge
 	}
 
 	logger.Info().Msg("exchanging authorization code...")
-	refreshToken, _, err := dropbox.ExchangeAuthorizationCode(ctx, appKey, appSecret, code)
+	var refreshToken string
+	var err error
+	if verifier != "" {
+		refreshToken, _, err = dropbox.ExchangeAuthorizationCodePKCE(ctx, appKey, verifier, code)
+	} else {
+		refreshToken, _, err = dropbox.ExchangeAuthorizationCode(ctx, appKey, appSecret, code)
+	}
 	if err != nil {
 		return fmt.Errorf("exchanging authorization code: %w", err)
 	}
@@ -314,16 +1285,27 @@ func openBrowser(url string) {
 	_ = cmd.Start()
 }
 
-func resolveToken(ctx context.Context, appKey, appSecret, refreshToken, directToken string, logger zerolog.Logger) (string, error) {
-	// Explicit flags: all 3 refresh params present
-	if appKey != "" && appSecret != "" && refreshToken != "" {
+// tokenMixupWarning returns a warning when refreshToken is a short-lived access
+// token ("sl."), passed to the wrong flag: a frequent setup mistake whose API
+// errors are otherwise confusing. The reverse mixup is not reported, since
+// legacy long-lived access tokens have the shape of refresh tokens.
+func tokenMixupWarning(refreshToken string) (string, bool) {
+	if !strings.HasPrefix(refreshToken, "sl.") {
+		return "", false
+	}
+	return "the value given as --refresh-token / DROPBOX_REFRESH_TOKEN looks like a short-lived " +
+		"access token (\"sl.\"); pass it as --token instead, or use the refresh token from the authorization setup", true
+}
+
+func resolveToken(ctx context.Context, tokens *tokenCache, refresh refresher, appKey, appSecret, refreshToken, directToken string, logger zerolog.Logger) (accessToken, error) {
+	// Explicit flags: app key and refresh token present (the secret is absent for PKCE apps)
+	if appKey != "" && refreshToken != "" {
 		logger.Info().Msg("refreshing Dropbox access token...")
-		token, err := dropbox.RefreshAccessToken(ctx, appKey, appSecret, refreshToken)
+		tok, err := newRefreshedToken(ctx, tokens, refresh, appKey, appSecret, refreshToken, logger)
 		if err != nil {
-			return "", fmt.Errorf("refreshing access token: %w", err)
+			return accessToken{}, fmt.Errorf("refreshing access token: %w", err)
 		}
-		logger.Info().Msg("access token refreshed successfully")
-		return token, nil
+		return tok, nil
 	}
 
 	// Stored credentials
@@ -331,27 +1313,108 @@ func resolveToken(ctx context.Context, appKey, appSecret, refreshToken, directTo
 	if err != nil {
 		logger.Warn().Err(err).Msg("failed to load stored credentials")
 	}
-	if creds != nil && creds.AppKey != "" && creds.AppSecret != "" && creds.RefreshToken != "" {
+	if creds != nil && creds.AppKey != "" && creds.RefreshToken != "" {
 		logger.Info().Msg("using stored credentials, refreshing access token...")
-		token, err := dropbox.RefreshAccessToken(ctx, creds.AppKey, creds.AppSecret, creds.RefreshToken)
+		tok, err := newRefreshedToken(ctx, tokens, refresh, creds.AppKey, creds.AppSecret, creds.RefreshToken, logger)
 		if err != nil {
-			return "", fmt.Errorf("refreshing access token with stored credentials: %w", err)
+			return accessToken{}, fmt.Errorf("refreshing access token with stored credentials: %w", err)
 		}
-		logger.Info().Msg("access token refreshed successfully")
-		return token, nil
+		return tok, nil
 	}
 
 	// Direct mode: token provided directly
 	if directToken != "" {
-		return directToken, nil
+		return accessToken{value: directToken}, nil
 	}
 
-	return "", fmt.Errorf("dropbox authentication required. Either:\n" +
+	return accessToken{}, fmt.Errorf("dropbox authentication required. Either:\n" +
 		"  - Provide --app-key, --app-secret, and --refresh-token\n" +
 		"  - Provide --token or DROPBOX_TOKEN env var (short-lived, expires in ~4h)\n" +
 		"  - Run interactively to set up credentials (one-time setup)")
 }
 
+// parseAge parses a duration that may also be given in days ("90d"). Empty means zero.
+func parseAge(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
+
+// parseSince parses a cutoff time given either as an age relative to now (see parseAge)
+// or as an RFC3339 timestamp. Empty means no cutoff (the zero time).
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	age, err := parseAge(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a duration nor an RFC3339 time", s)
+	}
+	return now.Add(-age), nil
+}
+
+// libraryRootEnv names the base directory a relative --local is resolved against.
+const libraryRootEnv = "CBBACKUP_LIBRARY_ROOT"
+
+// resolveLocalDir makes local absolute. A relative local is joined to libraryRoot
+// when one is set, and to the working directory otherwise.
+func resolveLocalDir(local, libraryRoot string) (string, error) {
+	if !filepath.IsAbs(local) && libraryRoot != "" {
+		local = filepath.Join(libraryRoot, local)
+	}
+	return filepath.Abs(local)
+}
+
+// stringsFlag is a flag.Value collecting every occurrence of a repeatable flag.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// parseRemotePaths splits a comma-separated list of Dropbox paths, each of which must be
+// absolute ("/Shared Music"); trailing slashes are dropped.
+func parseRemotePaths(s string) ([]string, error) {
+	var paths []string
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("dropbox path %q must start with /", p)
+		}
+		if p = strings.TrimRight(p, "/"); p == "" {
+			return nil, errors.New("the Dropbox root cannot be an extra path")
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if v != "" {
@@ -360,11 +1423,3 @@ func firstNonEmpty(values ...string) string {
 	}
 	return ""
 }
-
-func defaultCachePath() string {
-	dir, err := os.UserCacheDir()
-	if err != nil {
-		dir = os.TempDir()
-	}
-	return filepath.Join(dir, "cloudbeats-backup-generator", "cache.json")
-}
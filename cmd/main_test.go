@@ -0,0 +1,250 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+)
+
+func TestParseAge(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"empty", "", 0, false},
+		{"days", "90d", 90 * 24 * time.Hour, false},
+		{"go duration", "36h", 36 * time.Hour, false},
+		{"bad days", "xd", 0, true},
+		{"negative", "-1h", 0, true},
+		{"garbage", "soon", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseAge(test.s)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"empty", "", time.Time{}, false},
+		{"days ago", "7d", now.Add(-7 * 24 * time.Hour), false},
+		{"hours ago", "48h", now.Add(-48 * time.Hour), false},
+		{"RFC3339", "2024-06-01T00:00:00Z", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), false},
+		{"garbage", "last week", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseSince(test.s, now)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, test.want.Equal(got), "want %v, got %v", test.want, got)
+		})
+	}
+}
+
+func TestFormatExtensionCounts(t *testing.T) {
+	t.Parallel()
+
+	got := formatExtensionCounts([]matcher.ExtensionCount{{Ext: ".jpg", Count: 1200}, {Ext: ".pdf", Count: 40}, {Ext: "", Count: 3}})
+	assert.Equal(t, "1200 .jpg, 40 .pdf, 3 (no extension)", got)
+}
+
+func TestReadStdinSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name             string
+		token            string
+		refreshToken     string
+		stdin            string
+		wantUsed         bool
+		wantToken        string
+		wantRefreshToken string
+		wantErr          string
+	}{
+		{"no dash leaves stdin alone", "sl.abc", "", "ignored\n", false, "sl.abc", "", ""},
+		{"token from stdin", "-", "", "sl.piped\n", true, "sl.piped", "", ""},
+		{"refresh token without newline", "", "-", "  rt.piped  ", true, "", "rt.piped", ""},
+		{"both from stdin", "-", "-", "x\n", false, "-", "-", "only one of --token and --refresh-token can be read from stdin"},
+		{"empty stdin", "-", "", "", true, "-", "", "stdin is empty"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, w, err := os.Pipe()
+			require.NoError(t, err)
+			defer func() { _ = r.Close() }()
+			_, err = w.WriteString(test.stdin)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			token, refreshToken := test.token, test.refreshToken
+			used, err := readStdinSecret(r, &token, &refreshToken)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.wantUsed, used)
+			assert.Equal(t, test.wantToken, token)
+			assert.Equal(t, test.wantRefreshToken, refreshToken)
+		})
+	}
+}
+
+func TestParseRemotePaths(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{"empty", "", nil, false},
+		{"single", "/Shared Music", []string{"/Shared Music"}, false},
+		{"list with spaces and slashes", " /A/ , /B ,", []string{"/A", "/B"}, false},
+		{"relative", "Music", nil, true},
+		{"root", "/", nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseRemotePaths(test.s)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestResolveLocalDir(t *testing.T) {
+	t.Parallel()
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	base := filepath.Join(t.TempDir(), "Dropbox", "Music")
+
+	tests := []struct {
+		name  string
+		local string
+		root  string
+		want  string
+	}{
+		{"relative joined to root", "Albums", base, filepath.Join(base, "Albums")},
+		{"relative without root uses working dir", "Albums", "", filepath.Join(wd, "Albums")},
+		{"absolute ignores root", filepath.Join(wd, "elsewhere"), base, filepath.Join(wd, "elsewhere")},
+		{"relative root is made absolute", "Albums", "lib", filepath.Join(wd, "lib", "Albums")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := resolveLocalDir(test.local, test.root)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestTokenMixupWarning(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		refreshToken string
+		want         bool
+	}{
+		{"refresh token", "aBcD3fGh1JkLmN0pQrStUvWxYz-_0123456789AbCdEfGhIjKlMnOpQrStUv", false},
+		{"access token as --refresh-token", "sl.u.AF1b2C3d4E5f6G7h8I9j0K-L_mNoPqRsTuVwXyZ", true},
+		{"empty", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			warning, ok := tokenMixupWarning(test.refreshToken)
+			assert.Equal(t, test.want, ok)
+			if test.want {
+				assert.Contains(t, warning, "--token")
+			} else {
+				assert.Empty(t, warning)
+			}
+		})
+	}
+}
+
+func TestUploadPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		dest    string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{"disabled", "", "cloudbeats.cbbackup", "", false},
+		{"file", "/Apps/CloudBeats/library.cbbackup", "cloudbeats.cbbackup", "/Apps/CloudBeats/library.cbbackup", false},
+		{"folder keeps output name", "/Apps/CloudBeats/", filepath.Join("out", "cloudbeats.cbbackup"), "/Apps/CloudBeats/cloudbeats.cbbackup", false},
+		{"relative", "Apps/CloudBeats/", "cloudbeats.cbbackup", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := uploadPath(test.dest, test.output)
+			if test.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/cache"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/worker"
+)
+
+// newTagReader returns how each file's metadata is obtained: from its tags, or with
+// noTags from its path below localDir alone. withDuration adds a duration-only
+// probe to noTags; otherwise noTags never opens the file.
+func newTagReader(noTags, withDuration bool, localDir string, opts tags.ReadOptions) func(path string) (tags.AudioMeta, error) {
+	return taglibReaders{readFile: tags.ReadFile, readDuration: tags.ReadDurationOnly}.
+		tagReader(noTags, withDuration, localDir, opts)
+}
+
+// taglibReaders are the taglib calls newTagReader makes; tests replace them to
+// observe taglib use.
+type taglibReaders struct {
+	readFile     func(path string, opts tags.ReadOptions) (tags.AudioMeta, error)
+	readDuration func(path string) (time.Duration, error)
+}
+
+// tagReader is newTagReader with taglib calls made through r.
+func (r taglibReaders) tagReader(noTags, withDuration bool, localDir string, opts tags.ReadOptions) func(path string) (tags.AudioMeta, error) {
+	if noTags {
+		return func(path string) (tags.AudioMeta, error) {
+			meta := tags.FromPath(localDir, path)
+			if !withDuration {
+				return meta, nil
+			}
+			d, err := r.readDuration(path)
+			meta.Duration = d
+			return meta, err
+		}
+	}
+	return func(path string) (tags.AudioMeta, error) {
+		return r.readFile(path, opts)
+	}
+}
+
+// serializeFormats wraps read so that files with one of the extensions exts
+// (".ape" or "ape", any case) are read one at a time per extension, for taglib
+// formats that are not safe to read concurrently. Other formats, and files of
+// different flagged extensions, are still read in parallel.
+func serializeFormats(read func(path string) (tags.AudioMeta, error), exts []string) (func(path string) (tags.AudioMeta, error), error) {
+	if len(exts) == 0 {
+		return read, nil
+	}
+	locks := make(map[string]*sync.Mutex, len(exts))
+	for _, ext := range exts {
+		ext = "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+		if !matcher.IsAudioFile(ext) {
+			return nil, fmt.Errorf("%q is not a supported audio extension", ext)
+		}
+		locks[ext] = &sync.Mutex{}
+	}
+	return func(path string) (tags.AudioMeta, error) {
+		if mu := locks[strings.ToLower(filepath.Ext(path))]; mu != nil {
+			mu.Lock()
+			defer mu.Unlock()
+		}
+		return read(path)
+	}, nil
+}
+
+// syncLagged reports whether Dropbox lists fewer than minRatio audio files per
+// local one, the sign of a folder still uploading, where the backup would miss
+// most of the library. It also returns how many audio files Dropbox listed. A
+// minRatio of 0 disables the check.
+func syncLagged(localFiles int, entries []dropbox.Entry, minRatio float64) (int, bool) {
+	remote := 0
+	for _, e := range entries {
+		if matcher.IsAudioFile(e.Name) {
+			remote++
+		}
+	}
+	return remote, minRatio > 0 && float64(remote) < minRatio*float64(localFiles)
+}
+
+// newManifestReader returns metadata from m without opening any file. Paths missing
+// from m fall back to what their location below localDir implies.
+func newManifestReader(m *tags.Manifest, localDir string) func(path string) (tags.AudioMeta, error) {
+	return func(path string) (tags.AudioMeta, error) {
+		if meta, ok := m.Lookup(path); ok {
+			return meta, nil
+		}
+		return tags.FromPath(localDir, path), fmt.Errorf("%s is not in the manifest", path)
+	}
+}
+
+// cacheBypass returns a predicate reporting whether a path lies in one of dirs,
+// each given relative to localDir (or absolute).
+func cacheBypass(localDir string, dirs []string) func(path string) bool {
+	prefixes := make([]string, len(dirs))
+	for i, dir := range dirs {
+		dir = filepath.FromSlash(dir)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(localDir, dir)
+		}
+		prefixes[i] = filepath.Clean(dir)
+	}
+	return func(path string) bool {
+		for _, prefix := range prefixes {
+			if path == prefix || strings.HasPrefix(path, prefix+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// lookupCache returns the cached metadata for path, treating bypassed paths as
+// misses so they are re-parsed. tc may be nil when caching is disabled.
+func lookupCache(tc *cache.TagCache, bypass func(path string) bool, path string) (tags.AudioMeta, bool) {
+	if tc == nil || bypass(path) {
+		return tags.AudioMeta{}, false
+	}
+	return tc.Lookup(path)
+}
+
+// lookupCheckpoint is lookupCache for the tags an interrupted run recorded.
+func lookupCheckpoint(c *checkpoint, bypass func(path string) bool, path string) (tags.AudioMeta, bool) {
+	if bypass(path) {
+		return tags.AudioMeta{}, false
+	}
+	return c.Lookup(path)
+}
+
+// collectItems builds the backup items of matched from their tag reads as
+// worker.ProcessStream delivers them, so each file's metadata is dropped once
+// its item is built unless keepMetas is set, for the steps that need it later.
+// Items come back in the order of matched. errs, and metas when kept, are
+// parallel to matched; files the stream never delivered were skipped by an
+// interrupt and get context.Canceled. Those files are always left out; files
+// with tag errors are handled per policy, and under tags.ErrorPolicyAbort the
+// first of them in matched order fails the whole read once results are drained.
+// progress, if set, is called after each result from the calling goroutine.
+func collectItems(results <-chan worker.Result[tags.AudioMeta], accountID string, matched []matcher.MatchedFile,
+	keepMetas bool, policy tags.ErrorPolicy, opts backup.ItemOptions, progress worker.ItemProgressFunc,
+) (items []backup.Item, metas []tags.AudioMeta, errs []error, err error) {
+	total := len(matched)
+	if keepMetas {
+		metas = make([]tags.AudioMeta, total)
+	}
+	errs = make([]error, total)
+	for i := range errs {
+		errs[i] = context.Canceled
+	}
+	built := make([]backup.Item, total)
+	kept := make([]bool, total)
+	abortAt := total
+
+	done := 0
+	for r := range results {
+		errs[r.Index] = r.Err
+		if keepMetas {
+			metas[r.Index] = r.Value
+		}
+		item, ok, buildErr := buildItem(accountID, matched[r.Index], r.Value, r.Err, policy, opts)
+		switch {
+		case buildErr != nil:
+			if r.Index < abortAt {
+				err, abortAt = buildErr, r.Index
+			}
+		case ok:
+			built[r.Index], kept[r.Index] = item, true
+		}
+
+		done++
+		if progress != nil {
+			progress(done, total, r.Index)
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	items = built[:0]
+	for i, ok := range kept {
+		if ok {
+			items = append(items, built[i])
+		}
+	}
+	return items, metas, errs, nil
+}
+
+// buildItem turns one tagged matched file into its backup item. It reports
+// false for a file left out, and fails on a tag error under tags.ErrorPolicyAbort.
+func buildItem(accountID string, mf matcher.MatchedFile, meta tags.AudioMeta, readErr error,
+	policy tags.ErrorPolicy, opts backup.ItemOptions,
+) (backup.Item, bool, error) {
+	if readErr != nil {
+		if isCanceled(readErr) {
+			return backup.Item{}, false, nil
+		}
+		switch policy {
+		case tags.ErrorPolicySkip:
+			return backup.Item{}, false, nil
+		case tags.ErrorPolicyAbort:
+			return backup.Item{}, false, fmt.Errorf("reading tags from %s: %w", mf.LocalPath, readErr)
+		}
+	}
+	return backup.NewItem(accountID, mf.Entry, meta, opts), true, nil
+}
+
+// dropboxOnlyEntries picks the Dropbox files with no local copy that
+// --include-dropbox-only adds: those a scan with opts would have found below
+// whichever of roots holds them, so --max-depth and hidden files and folders
+// count as they do locally. Files outside every root are judged by name alone.
+func dropboxOnlyEntries(roots []string, entries []dropbox.Entry, opts matcher.ScanOptions) []dropbox.Entry {
+	var kept []dropbox.Entry
+	for _, e := range entries {
+		rel := e.Name
+		if _, below, ok := remoteRoot(roots, e); ok {
+			rel = below
+		}
+		if opts.Includes(rel) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// dropboxOnlyItems builds items for Dropbox files with no local copy
+// (--include-dropbox-only), as picked by dropboxOnlyEntries. Their tags cannot
+// be read, so metadata is inferred from their path below whichever of roots
+// holds them, as with --no-tags, and their duration is unknown.
+func dropboxOnlyItems(accountID string, roots []string, entries []dropbox.Entry, opts backup.ItemOptions) []backup.Item {
+	items := make([]backup.Item, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, backup.NewItem(accountID, e, remoteMeta(roots, e), opts))
+	}
+	return items
+}
+
+// remoteMeta infers e's metadata from its Dropbox path below the first of roots
+// that contains it.
+func remoteMeta(roots []string, e dropbox.Entry) tags.AudioMeta {
+	path := filepath.FromSlash(e.PathDisplay)
+	if root, _, ok := remoteRoot(roots, e); ok {
+		return tags.FromPath(filepath.FromSlash(root), path)
+	}
+	return tags.FromPath("", path)
+}
+
+// remoteRoot finds the first of roots that contains e and splits e's display
+// path into that root and the slash-separated rest below it. Roots compare
+// case-insensitively against e's lowercase path, as Dropbox paths do, one path
+// segment at a time: lowercasing may change a name's length, so the display
+// path is cut by segment count rather than byte offset.
+func remoteRoot(roots []string, e dropbox.Entry) (root, rel string, ok bool) {
+	lower := pathSegments(e.PathLower)
+	display := pathSegments(e.PathDisplay)
+	if len(lower) != len(display) {
+		return "", "", false
+	}
+	for _, r := range roots {
+		prefix := pathSegments(strings.ToLower(r))
+		if len(prefix) < len(lower) && slices.Equal(lower[:len(prefix)], prefix) {
+			n := len(prefix)
+			return "/" + strings.Join(display[:n], "/"), strings.Join(display[n:], "/"), true
+		}
+	}
+	return "", "", false
+}
+
+// pathSegments splits a Dropbox path into its names; the root has none.
+func pathSegments(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
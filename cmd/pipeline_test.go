@@ -0,0 +1,631 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/cache"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox/dropboxtest"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags/tagstest"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/worker"
+)
+
+// streamResults returns a closed stream holding a result for each of metas and
+// errs, last first as a worker pool may finish them. Results whose error is
+// context.Canceled are left out, like items an interrupt kept from starting.
+func streamResults(metas []tags.AudioMeta, errs []error) <-chan worker.Result[tags.AudioMeta] {
+	results := make(chan worker.Result[tags.AudioMeta], len(metas))
+	for i := len(metas) - 1; i >= 0; i-- {
+		if !errors.Is(errs[i], context.Canceled) {
+			results <- worker.Result[tags.AudioMeta]{Index: i, Value: metas[i], Err: errs[i]}
+		}
+	}
+	close(results)
+	return results
+}
+
+func TestCollectItems_ErrorPolicy(t *testing.T) {
+	t.Parallel()
+
+	matched := []matcher.MatchedFile{
+		{LocalPath: "/music/good.mp3", Entry: dropbox.Entry{ID: "id:1", Name: "good.mp3"}},
+		{LocalPath: "/music/corrupt.mp3", Entry: dropbox.Entry{ID: "id:2", Name: "corrupt.mp3"}},
+		{LocalPath: "/music/pending.mp3", Entry: dropbox.Entry{ID: "id:3", Name: "pending.mp3"}},
+	}
+	metas := []tags.AudioMeta{
+		{Title: "Good", Artist: "Artist", TrackNumber: 1},
+		{Title: "corrupt", Artist: tags.Unknown, TrackNumber: -1},
+		{},
+	}
+	errs := []error{nil, errors.New("taglib panicked: boom"), context.Canceled}
+
+	tests := []struct {
+		name     string
+		policy   tags.ErrorPolicy
+		wantKeys []string
+		wantErr  string
+	}{
+		{"skip drops corrupt files", tags.ErrorPolicySkip, []string{"id:1"}, ""},
+		{"default keeps corrupt files", tags.ErrorPolicyDefault, []string{"id:1", "id:2"}, ""},
+		{"abort fails", tags.ErrorPolicyAbort, nil, "reading tags from /music/corrupt.mp3: taglib panicked: boom"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			items, gotMetas, gotErrs, err := collectItems(streamResults(metas, errs), "dbid:1", matched,
+				false, test.policy, backup.ItemOptions{}, nil)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			keys := make([]string, len(items))
+			for i, it := range items {
+				keys[i] = it.Key
+			}
+			assert.Equal(t, test.wantKeys, keys, "in matched order")
+			assert.Nil(t, gotMetas, "metadata is not kept unless asked")
+			assert.Equal(t, errs, gotErrs, "files never read count as interrupted")
+		})
+	}
+}
+
+func TestCollectItems_KeepMetas(t *testing.T) {
+	t.Parallel()
+
+	matched := []matcher.MatchedFile{
+		{LocalPath: "/music/a.mp3", Entry: dropbox.Entry{ID: "id:1", Name: "a.mp3"}},
+		{LocalPath: "/music/b.mp3", Entry: dropbox.Entry{ID: "id:2", Name: "b.mp3"}},
+	}
+	metas := []tags.AudioMeta{{Title: "A"}, {Title: "B"}}
+
+	var progress []int
+	items, gotMetas, errs, err := collectItems(streamResults(metas, []error{nil, nil}), "dbid:1", matched,
+		true, tags.ErrorPolicyDefault, backup.ItemOptions{}, func(done, total, index int) {
+			assert.Equal(t, len(matched), total)
+			progress = append(progress, done)
+		})
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "A", items[0].TagName)
+	assert.Equal(t, metas, gotMetas)
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Equal(t, []int{1, 2}, progress)
+}
+
+func TestNewTagReader_NoTags(t *testing.T) {
+	t.Parallel()
+
+	var calls, durationCalls int
+	readers := taglibReaders{
+		readFile: func(string, tags.ReadOptions) (tags.AudioMeta, error) {
+			calls++
+			return tags.AudioMeta{Title: "From tags"}, nil
+		},
+		readDuration: func(string) (time.Duration, error) {
+			durationCalls++
+			return 3 * time.Minute, nil
+		},
+	}
+
+	read := readers.tagReader(true, false, "/music", tags.ReadOptions{})
+	meta, err := read("/music/Artist/Album/02 Song.mp3")
+	require.NoError(t, err)
+	assert.Equal(t, 0, calls, "--no-tags must not open files")
+	assert.Equal(t, "Song", meta.Title)
+	assert.Equal(t, "Artist", meta.Artist)
+	assert.Equal(t, "Album", meta.Album)
+	assert.Zero(t, meta.Duration)
+	assert.Equal(t, 0, durationCalls)
+
+	read = readers.tagReader(true, true, "/music", tags.ReadOptions{})
+	meta, err = read("/music/Artist/Album/02 Song.mp3")
+	require.NoError(t, err)
+	assert.Equal(t, 0, calls, "--with-duration must not parse tags")
+	assert.Equal(t, 1, durationCalls)
+	assert.Equal(t, "Song", meta.Title)
+	assert.Equal(t, 3*time.Minute, meta.Duration)
+
+	read = readers.tagReader(false, false, "/music", tags.ReadOptions{})
+	meta, err = read("/music/Artist/Album/02 Song.mp3")
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "From tags", meta.Title)
+}
+
+func TestCacheBypass(t *testing.T) {
+	t.Parallel()
+
+	bypass := cacheBypass("/music", []string{"Retagged", "Other/Album/", "/elsewhere"})
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/music/Retagged/01 Track.mp3", true},
+		{"/music/Retagged", true},
+		{"/music/Retagged Too/01 Track.mp3", false},
+		{"/music/Other/Album/01 Track.mp3", true},
+		{"/music/Other/Single.mp3", false},
+		{"/elsewhere/Track.mp3", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, bypass(filepath.FromSlash(test.path)))
+		})
+	}
+}
+
+func TestLookupCache_BypassReparsesCachedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	retagged := filepath.Join(dir, "Retagged", "01 Track.mp3")
+	untouched := filepath.Join(dir, "Untouched", "01 Track.mp3")
+	for _, path := range []string{retagged, untouched} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("audio"), 0o644))
+	}
+
+	tc := cache.Load(filepath.Join(dir, "cache.json"), zerolog.Nop())
+	tc.Store(retagged, tags.AudioMeta{Title: "Old Title"})
+	tc.Store(untouched, tags.AudioMeta{Title: "Cached"})
+
+	bypass := cacheBypass(dir, []string{"Retagged"})
+
+	_, ok := lookupCache(tc, bypass, retagged)
+	assert.False(t, ok, "bypassed file must be re-parsed despite a valid cache entry")
+
+	meta, ok := lookupCache(tc, bypass, untouched)
+	require.True(t, ok)
+	assert.Equal(t, "Cached", meta.Title)
+
+	_, ok = lookupCache(nil, bypass, untouched)
+	assert.False(t, ok)
+
+	// An interrupted run's checkpoint is bypassed the same way
+	ckptPath := filepath.Join(dir, "lib.cbbackup.checkpoint")
+	first, err := openCheckpoint(ckptPath)
+	require.NoError(t, err)
+	first.Record(retagged, tags.AudioMeta{Title: "Old Title"})
+	first.Record(untouched, tags.AudioMeta{Title: "Recorded"})
+	require.NoError(t, first.Close())
+	ckpt, err := openCheckpoint(ckptPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ckpt.Close() })
+
+	_, ok = lookupCheckpoint(ckpt, bypass, retagged)
+	assert.False(t, ok)
+	meta, ok = lookupCheckpoint(ckpt, bypass, untouched)
+	require.True(t, ok)
+	assert.Equal(t, "Recorded", meta.Title)
+}
+
+func TestBuildItems_FromManifestWithoutFiles(t *testing.T) {
+	t.Parallel()
+
+	// The library root is never created: everything comes from the manifest
+	library := filepath.Join(t.TempDir(), "Music")
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(manifestPath, []byte(`[
+		{"path": "Artist/Album/01 Intro.flac", "size": 2048, "mtime": "2024-05-01T10:00:00Z",
+		 "meta": {"Title": "Intro", "Artist": "Artist", "Album": "Album", "AlbumArtist": "Artist",
+		          "TrackNumber": 1, "Duration": 61000000000}},
+		{"path": "Artist/Album/02 Not In Dropbox.flac", "meta": {"Title": "Gone"}}
+	]`), 0o644))
+
+	manifest, err := tags.LoadManifest(manifestPath)
+	require.NoError(t, err)
+	manifest.Resolve(library)
+
+	entries := []dropbox.Entry{
+		{ID: "id:1", Name: "01 Intro.flac", PathLower: "/music/artist/album/01 intro.flac", PathDisplay: "/Music/Artist/Album/01 Intro.flac"},
+	}
+	result := matcher.Match(library, "/Music", manifest.Paths(), entries, matcher.MatchOptions{})
+	require.Len(t, result.Matched, 1)
+	assert.Equal(t, []string{filepath.Join(library, "Artist", "Album", "02 Not In Dropbox.flac")}, result.UnmatchedLocal)
+
+	read := newManifestReader(manifest, library)
+	results := worker.ProcessStream(context.Background(), result.Matched, 2,
+		func(_ context.Context, mf matcher.MatchedFile) (tags.AudioMeta, error) {
+			return read(mf.LocalPath)
+		})
+
+	items, _, _, err := collectItems(results, "dbid:acct", result.Matched, false, tags.ErrorPolicyAbort, backup.ItemOptions{}, nil)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "Intro", items[0].TagName)
+	assert.Equal(t, "Artist", items[0].Artist)
+	assert.Equal(t, backup.Duration(61), items[0].Duration)
+
+	_, err = read(filepath.Join(library, "elsewhere.mp3"))
+	assert.ErrorContains(t, err, "not in the manifest")
+}
+
+func TestDropboxOnlyItems(t *testing.T) {
+	t.Parallel()
+
+	localDir := t.TempDir()
+	kept := filepath.Join(localDir, "Artist", "Album", "01 Kept.flac")
+	entries := []dropbox.Entry{
+		{Tag: "file", ID: "id:1", Name: "01 Kept.flac", PathLower: "/music/artist/album/01 kept.flac", PathDisplay: "/Music/Artist/Album/01 Kept.flac"},
+		// Deleted locally to save space
+		{Tag: "file", ID: "id:2", Name: "02 Streamed.flac", PathLower: "/music/artist/album/cd2/02 streamed.flac", PathDisplay: "/Music/Artist/Album/CD2/02 Streamed.flac"},
+		{Tag: "file", ID: "id:3", Name: "Loose.mp3", PathLower: "/shared/loose.mp3", PathDisplay: "/Shared/Loose.mp3"},
+		{Tag: "file", ID: "id:4", Name: "._02 Streamed.flac", PathLower: "/music/artist/album/._02 streamed.flac", PathDisplay: "/Music/Artist/Album/._02 Streamed.flac"},
+		{Tag: "file", ID: "id:5", Name: "cover.jpg", PathLower: "/music/cover.jpg", PathDisplay: "/Music/cover.jpg"},
+		{Tag: "file", ID: "id:6", Name: "Take.flac", PathLower: "/music/.sync/take.flac", PathDisplay: "/Music/.sync/Take.flac"},
+	}
+
+	result := matcher.Match(localDir, "/music", []string{kept}, entries, matcher.MatchOptions{})
+	require.Len(t, result.Matched, 1)
+
+	roots := []string{"/music", "/Elsewhere"}
+	picked := dropboxOnlyEntries(roots, result.UnmatchedDropbox, matcher.ScanOptions{})
+	items := dropboxOnlyItems("dbid:acct", roots, picked, backup.ItemOptions{})
+	require.Len(t, items, 2, "hidden files and folders and non-audio files are left out")
+
+	streamed := items[0]
+	assert.Equal(t, "id:2", streamed.Key)
+	assert.Equal(t, "Streamed", streamed.TagName)
+	assert.Equal(t, "Album", streamed.Album)
+	assert.Equal(t, "Artist", streamed.Artist)
+	assert.Equal(t, 2, streamed.DiskNumber)
+	require.NotNil(t, streamed.TrackNumber)
+	assert.Equal(t, 2, *streamed.TrackNumber)
+	assert.Zero(t, streamed.Duration, "the duration cannot be read without the file")
+
+	// Outside every root: only the file name says anything
+	loose := items[1]
+	assert.Equal(t, "id:3", loose.Key)
+	assert.Equal(t, "Loose", loose.TagName)
+	assert.Equal(t, tags.Unknown, loose.Album)
+
+	withHidden := dropboxOnlyEntries(roots, result.UnmatchedDropbox, matcher.ScanOptions{IncludeHidden: true})
+	assert.Len(t, withHidden, 4)
+
+	// CD2 is two folders below /music, like a local file --max-depth 1 skips
+	shallow := dropboxOnlyEntries(roots, result.UnmatchedDropbox, matcher.ScanOptions{MaxDepth: 1})
+	require.Len(t, shallow, 1)
+	assert.Equal(t, "id:3", shallow[0].ID)
+}
+
+func TestRemoteRoot_NonASCII(t *testing.T) {
+	t.Parallel()
+
+	// "İ" is two bytes but lowercases to three, so byte offsets taken on the
+	// lowercase path would cut the display path in the wrong place
+	display := "/İstanbul/Tarkan/Ölürüm Sana/01 Şımarık.mp3"
+	e := dropbox.Entry{Tag: "file", ID: "id:1", Name: "01 Şımarık.mp3", PathLower: strings.ToLower(display), PathDisplay: display}
+	require.NotEqual(t, len(display), len(e.PathLower))
+
+	root, rel, ok := remoteRoot([]string{"/Elsewhere", "/İSTANBUL"}, e)
+	require.True(t, ok)
+	assert.Equal(t, "/İstanbul", root)
+	assert.Equal(t, "Tarkan/Ölürüm Sana/01 Şımarık.mp3", rel)
+
+	items := dropboxOnlyItems("dbid:acct", []string{"/İstanbul"}, []dropbox.Entry{e}, backup.ItemOptions{})
+	require.Len(t, items, 1)
+	assert.Equal(t, "Tarkan", items[0].Artist)
+	assert.Equal(t, "Ölürüm Sana", items[0].Album)
+	assert.Equal(t, "Şımarık", items[0].TagName)
+
+	_, _, ok = remoteRoot([]string{"/İstanbul/Tarkan/Ölürüm Sana/01 Şımarık.mp3"}, e)
+	assert.False(t, ok, "a root contains only paths below it")
+}
+
+func TestRenewBeforeListing(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		expiresAt   time.Time
+		canRefresh  bool
+		wantRefresh bool
+	}{
+		{name: "near expiry is refreshed", expiresAt: now.Add(2 * time.Minute), canRefresh: true, wantRefresh: true},
+		{name: "already expired is refreshed", expiresAt: now.Add(-time.Minute), canRefresh: true, wantRefresh: true},
+		{name: "plenty of lifetime left", expiresAt: now.Add(3 * time.Hour), canRefresh: true},
+		{name: "unknown lifetime", canRefresh: true},
+		{name: "direct token cannot be refreshed", expiresAt: now.Add(2 * time.Minute)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := dropboxtest.NewMockServer(t, "dbid:123",
+				[]dropbox.Entry{dropboxtest.File("id:1", "/Music/a.mp3")},
+			)
+			client := dropbox.NewClientWithBaseURL("stale-token", srv.URL, zerolog.Nop())
+
+			refreshes := 0
+			tok := accessToken{value: "stale-token", expiresAt: test.expiresAt}
+			if test.canRefresh {
+				tok.refresh = func(context.Context) (string, time.Duration, error) {
+					refreshes++
+					return dropboxtest.Token, 4 * time.Hour, nil
+				}
+			}
+
+			require.NoError(t, renewBeforeListing(context.Background(), client, &tok, now, zerolog.Nop()))
+
+			_, err := client.ListFolder(context.Background(), "/Music")
+			if !test.wantRefresh {
+				assert.Zero(t, refreshes)
+				assert.Equal(t, "stale-token", tok.value)
+				assert.Error(t, err, "the mock server rejects the stale token")
+				return
+			}
+			assert.Equal(t, 1, refreshes)
+			assert.Equal(t, dropboxtest.Token, tok.value)
+			assert.Equal(t, now.Add(4*time.Hour), tok.expiresAt)
+			require.NoError(t, err, "the listing uses the refreshed token")
+		})
+	}
+}
+
+func TestRenewBeforeListing_RefreshError(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	refreshErr := errors.New("invalid_grant")
+	tok := accessToken{
+		value:     "stale-token",
+		expiresAt: now.Add(time.Minute),
+		refresh: func(context.Context) (string, time.Duration, error) {
+			return "", 0, refreshErr
+		},
+	}
+
+	err := renewBeforeListing(context.Background(), dropbox.NewClient("stale-token", zerolog.Nop()), &tok, now, zerolog.Nop())
+	require.ErrorIs(t, err, refreshErr)
+	assert.Equal(t, "stale-token", tok.value)
+}
+
+func TestNewRefreshedToken_ReusesValidToken(t *testing.T) {
+	t.Parallel()
+
+	var requests []string
+	lifetime := 4 * time.Hour
+	refresh := func(_ context.Context, appKey, _, refreshToken string) (string, time.Duration, error) {
+		requests = append(requests, refreshToken)
+		return fmt.Sprintf("access-%s-%d", refreshToken, len(requests)), lifetime, nil
+	}
+	ctx := context.Background()
+
+	tokens := &tokenCache{}
+	first, err := newRefreshedToken(ctx, tokens, refresh, "key", "", "refresh-a", zerolog.Nop())
+	require.NoError(t, err)
+	second, err := newRefreshedToken(ctx, tokens, refresh, "key", "", "refresh-a", zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"refresh-a"}, requests, "the second call reuses the token")
+	assert.Equal(t, first.value, second.value)
+	assert.WithinDuration(t, first.expiresAt, second.expiresAt, time.Second)
+	require.NotNil(t, second.refresh, "a reused token can still be renewed")
+
+	other, err := newRefreshedToken(ctx, tokens, refresh, "key", "", "refresh-b", zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"refresh-a", "refresh-b"}, requests, "tokens are kept per refresh token")
+	assert.NotEqual(t, first.value, other.value)
+
+	// A token about to expire is refreshed rather than reused
+	lifetime = tokenRefreshMargin / 2
+	tokens = &tokenCache{}
+	_, err = newRefreshedToken(ctx, tokens, refresh, "key", "", "refresh-c", zerolog.Nop())
+	require.NoError(t, err)
+	_, err = newRefreshedToken(ctx, tokens, refresh, "key", "", "refresh-c", zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"refresh-a", "refresh-b", "refresh-c", "refresh-c"}, requests)
+}
+
+func TestNewRefreshedToken_SavedForLaterRuns(t *testing.T) {
+	t.Parallel()
+
+	requests := 0
+	refresh := func(context.Context, string, string, string) (string, time.Duration, error) {
+		requests++
+		return "access-token", 4 * time.Hour, nil
+	}
+	path := filepath.Join(t.TempDir(), "config", tokenCacheFile)
+
+	_, err := newRefreshedToken(context.Background(), loadTokenCache(path, zerolog.Nop()), refresh, "key", "", "refresh-secret", zerolog.Nop())
+	require.NoError(t, err)
+	tok, err := newRefreshedToken(context.Background(), loadTokenCache(path, zerolog.Nop()), refresh, "key", "", "refresh-secret", zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests, "the next run reuses the saved token")
+	assert.Equal(t, "access-token", tok.value)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "refresh-secret")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+}
+
+func TestRetryRejectedToken(t *testing.T) {
+	t.Parallel()
+
+	srv := dropboxtest.NewMockServer(t, "dbid:123")
+	client := dropbox.NewClientWithBaseURL("revoked-token", srv.URL, zerolog.Nop())
+
+	refreshes := 0
+	refresh := func(context.Context, string, string, string) (string, time.Duration, error) {
+		refreshes++
+		return dropboxtest.Token, 4 * time.Hour, nil
+	}
+	tokens := &tokenCache{}
+	key := tokenCacheKey("key", "refresh-a")
+	require.NoError(t, tokens.put(key, cachedToken{Value: "revoked-token", ExpiresAt: time.Now().Add(3 * time.Hour)}))
+
+	tok, err := newRefreshedToken(context.Background(), tokens, refresh, "key", "", "refresh-a", zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, "revoked-token", tok.value)
+
+	var accountID string
+	err = retryRejectedToken(context.Background(), client, &tok, zerolog.Nop(), func() error {
+		var err error
+		accountID, err = client.GetAccountID(context.Background())
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "dbid:123", accountID)
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, dropboxtest.Token, tok.value)
+	cached, ok := tokens.get(key, time.Now())
+	require.True(t, ok)
+	assert.Equal(t, dropboxtest.Token, cached.Value, "the rejected token is replaced")
+
+	// A token that was just refreshed is not retried
+	client.SetToken("revoked-token")
+	tok.value = "revoked-token"
+	err = retryRejectedToken(context.Background(), client, &tok, zerolog.Nop(), func() error {
+		_, err := client.GetAccountID(context.Background())
+		return err
+	})
+	require.Error(t, err)
+	assert.Equal(t, 1, refreshes)
+}
+
+func TestSyncLagged(t *testing.T) {
+	t.Parallel()
+
+	listing := func(audio, other int) []dropbox.Entry {
+		var entries []dropbox.Entry
+		for i := range audio {
+			entries = append(entries, dropboxtest.File(fmt.Sprintf("id:%d", i), fmt.Sprintf("/Music/%d.mp3", i)))
+		}
+		for i := range other {
+			entries = append(entries, dropboxtest.File(fmt.Sprintf("id:x%d", i), fmt.Sprintf("/Music/cover%d.jpg", i)))
+		}
+		return entries
+	}
+
+	tests := []struct {
+		name        string
+		local       int
+		entries     []dropbox.Entry
+		ratio       float64
+		wantRemote  int
+		wantLagging bool
+	}{
+		{name: "still uploading", local: 5000, entries: listing(300, 0), ratio: 0.5, wantRemote: 300, wantLagging: true},
+		{name: "non-audio files do not count", local: 100, entries: listing(40, 200), ratio: 0.5, wantRemote: 40, wantLagging: true},
+		{name: "in sync", local: 5000, entries: listing(4990, 10), ratio: 0.5, wantRemote: 4990},
+		{name: "at the ratio", local: 100, entries: listing(50, 0), ratio: 0.5, wantRemote: 50},
+		{name: "more in Dropbox than locally", local: 10, entries: listing(500, 0), ratio: 0.5, wantRemote: 500},
+		{name: "empty listing", local: 10, ratio: 0.5, wantLagging: true},
+		{name: "nothing local", local: 0, ratio: 0.5},
+		{name: "disabled", local: 5000, entries: listing(1, 0), ratio: 0, wantRemote: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			remote, lagging := syncLagged(test.local, test.entries, test.ratio)
+			assert.Equal(t, test.wantRemote, remote)
+			assert.Equal(t, test.wantLagging, lagging)
+		})
+	}
+}
+
+func TestSerializeFormats(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	inFlight := make(map[string]int)
+	maxInFlight := make(map[string]int)
+	read := func(path string) (tags.AudioMeta, error) {
+		ext := strings.ToLower(filepath.Ext(path))
+		mu.Lock()
+		inFlight[ext]++
+		maxInFlight[ext] = max(maxInFlight[ext], inFlight[ext])
+		mu.Unlock()
+
+		time.Sleep(2 * time.Millisecond)
+
+		mu.Lock()
+		inFlight[ext]--
+		mu.Unlock()
+		return tags.AudioMeta{Title: path}, nil
+	}
+
+	serialized, err := serializeFormats(read, []string{"APE", ".wv"})
+	require.NoError(t, err)
+
+	var paths []string
+	for i := range 24 {
+		for _, ext := range []string{".ape", ".APE", ".wv", ".mp3"} {
+			paths = append(paths, fmt.Sprintf("/music/%02d%s", i, ext))
+		}
+	}
+	metas, errs := worker.Process(context.Background(), paths, 16,
+		func(_ context.Context, path string) (tags.AudioMeta, error) { return serialized(path) }, nil)
+
+	for i, path := range paths {
+		require.NoError(t, errs[i])
+		assert.Equal(t, path, metas[i].Title)
+	}
+	assert.Equal(t, 1, maxInFlight[".ape"], "flagged format reads never overlap, whatever the case")
+	assert.Equal(t, 1, maxInFlight[".wv"])
+	assert.Greater(t, maxInFlight[".mp3"], 1, "other formats stay parallel")
+}
+
+func TestSerializeFormats_Invalid(t *testing.T) {
+	t.Parallel()
+
+	read := func(string) (tags.AudioMeta, error) { return tags.AudioMeta{}, nil }
+
+	_, err := serializeFormats(read, []string{"ape", "txt"})
+	assert.ErrorContains(t, err, `".txt"`)
+
+	read, err = serializeFormats(read, nil)
+	require.NoError(t, err)
+	assert.NotNil(t, read)
+}
+
+func BenchmarkReadFiles(b *testing.B) {
+	paths := tagstest.Fixtures(b, 200)
+
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", n), func(b *testing.B) {
+			for b.Loop() {
+				_, _ = worker.Process(context.Background(), paths, n,
+					func(_ context.Context, path string) (tags.AudioMeta, error) {
+						return tags.ReadFile(path, tags.ReadOptions{})
+					},
+					nil,
+				)
+			}
+			b.ReportMetric(float64(len(paths))*float64(b.N)/b.Elapsed().Seconds(), "files/s")
+		})
+	}
+}
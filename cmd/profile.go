@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+)
+
+// startProfiles starts a CPU profile written to cpuPath and arranges for a heap
+// profile to be written to memPath; an empty path skips that profile. The
+// returned stop finishes both and may be called more than once, so it can run
+// from both a defer and an exit path.
+func startProfiles(cpuPath, memPath string) (stop func() error, err error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		if cpuFile, err = os.Create(cpuPath); err != nil {
+			return nil, fmt.Errorf("creating CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			_ = cpuFile.Close()
+			return nil, fmt.Errorf("starting CPU profile: %w", err)
+		}
+	}
+
+	var once sync.Once
+	var stopErr error
+	return func() error {
+		once.Do(func() {
+			if cpuFile != nil {
+				pprof.StopCPUProfile()
+				if err := cpuFile.Close(); err != nil {
+					stopErr = fmt.Errorf("writing CPU profile: %w", err)
+				}
+			}
+			if memPath != "" {
+				stopErr = errors.Join(stopErr, writeHeapProfile(memPath))
+			}
+		})
+		return stopErr
+	}, nil
+}
+
+// writeHeapProfile writes the current heap profile to path, after a GC so it
+// reflects live memory.
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating memory profile: %w", err)
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing memory profile: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing memory profile: %w", err)
+	}
+	return nil
+}
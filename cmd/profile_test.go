@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Not parallel: CPU profiling is process-wide.
+func TestStartProfiles(t *testing.T) {
+	dir := t.TempDir()
+	cpu := filepath.Join(dir, "cpu.pprof")
+	mem := filepath.Join(dir, "mem.pprof")
+
+	stop, err := startProfiles(cpu, mem)
+	require.NoError(t, err)
+	require.NoError(t, stop())
+	require.NoError(t, stop(), "stopping twice is harmless")
+
+	for _, path := range []string{cpu, mem} {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Positive(t, info.Size(), path)
+	}
+
+	// Unset flags profile nothing
+	stop, err = startProfiles("", "")
+	require.NoError(t, err)
+	require.NoError(t, stop())
+
+	_, err = startProfiles(filepath.Join(dir, "missing", "cpu.pprof"), "")
+	require.Error(t, err)
+	stop, err = startProfiles("", filepath.Join(dir, "missing", "mem.pprof"))
+	require.NoError(t, err)
+	require.ErrorContains(t, stop(), "creating memory profile")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/width"
+)
+
+// defaultProgressWidth is assumed when the terminal width cannot be determined.
+const defaultProgressWidth = 80
+
+// progressLine renders a carriage-return progress line such as
+// "\rProcessing (1200/50000): Artist/Album/track.flac", fitted to width columns.
+// name is shortened from the left, keeping the file name visible, and the line is
+// padded so it fully overwrites a longer previous one.
+func progressLine(done, total int, name string, width int) string {
+	if width <= 0 {
+		width = defaultProgressWidth
+	}
+	// Writing into the last column makes some terminals wrap
+	width--
+
+	text := fmt.Sprintf("Processing (%d/%d)", done, total)
+	if name != "" {
+		text += ": " + truncateLeft(name, width-displayWidth(text)-2)
+	}
+	if pad := width - displayWidth(text); pad > 0 {
+		text += strings.Repeat(" ", pad)
+	}
+	return "\r" + text
+}
+
+// truncateLeft shortens s to at most n columns by replacing its beginning with "…".
+func truncateLeft(s string, n int) string {
+	if displayWidth(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	// Keep as many trailing runes as fit beside the one-column ellipsis
+	runes := []rune(s)
+	start, used := len(runes), 0
+	for start > 0 && used+runeWidth(runes[start-1]) <= n-1 {
+		start--
+		used += runeWidth(runes[start])
+	}
+	return "…" + string(runes[start:])
+}
+
+// displayWidth returns how many terminal columns s takes.
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth returns how many terminal columns r takes: two for East Asian wide
+// and fullwidth characters, none for combining marks (as in decomposed file
+// names) and invisible format characters, and one otherwise.
+func runeWidth(r rune) int {
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
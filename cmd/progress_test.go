@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressLine(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		done  int
+		total int
+		file  string
+		width int
+		want  string
+	}{
+		{"fits", 1, 10, "A/B/c.flac", 40, "\rProcessing (1/10): A/B/c.flac" + strings.Repeat(" ", 10)},
+		{"truncated from the left", 12, 500, "Artist/Album/01 Long Track Name.flac", 40, "\rProcessing (12/500): …g Track Name.flac"},
+		{"no name", 5, 5, "", 30, "\rProcessing (5/5)" + strings.Repeat(" ", 13)},
+		{"unknown width", 1, 1, "x.mp3", 0, "\rProcessing (1/1): x.mp3" + strings.Repeat(" ", 56)},
+		{"wide characters", 3, 9, "宇多田ヒカル/01 Automatic.flac", 40, "\rProcessing (3/9): …ル/01 Automatic.flac"},
+		{"wide characters padded", 3, 9, "坂本龍一.flac", 40, "\rProcessing (3/9): 坂本龍一.flac" + strings.Repeat(" ", 8)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := progressLine(test.done, test.total, test.file, test.width)
+			assert.Equal(t, test.want, got)
+
+			width := test.width
+			if width == 0 {
+				width = defaultProgressWidth
+			}
+			assert.Equal(t, width-1, displayWidth(strings.TrimPrefix(got, "\r")), "width-1 columns")
+		})
+	}
+}
+
+func TestTruncateLeft(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "short", truncateLeft("short", 10))
+	assert.Equal(t, "…ère.mp3", truncateLeft("Déjà/Première.mp3", 8))
+	assert.Equal(t, "…", truncateLeft("abc", 1))
+	assert.Empty(t, truncateLeft("abc", 0))
+	assert.Equal(t, "…ヒカル.mp3", truncateLeft("宇多田ヒカル.mp3", 11), "wide characters take two columns")
+	assert.Equal(t, "…ヒカル.mp3", truncateLeft("宇多田ヒカル.mp3", 12), "a wide character never straddles the limit")
+	assert.Equal(t, "…e\u0300re.mp3", truncateLeft("Pre\u0300mie\u0300re.mp3", 8), "combining marks take none")
+}
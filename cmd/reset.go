@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/cache"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/config"
+)
+
+// managedPath is a directory of app data removed by --reset-all.
+type managedPath struct {
+	Label string
+	Path  string
+	Size  int64
+}
+
+// appDataPaths returns the existing directories holding credentials, configuration,
+// and caches, with their sizes.
+func appDataPaths() ([]managedPath, error) {
+	var candidates []managedPath
+	configDir, err := config.Dir()
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, managedPath{Label: "config and credentials", Path: configDir})
+	for _, dir := range cache.Dirs() {
+		candidates = append(candidates, managedPath{Label: "tag cache", Path: dir})
+	}
+	return existingPaths(candidates)
+}
+
+// existingPaths keeps the candidates that exist (once each), filling in their sizes.
+func existingPaths(candidates []managedPath) ([]managedPath, error) {
+	seen := make(map[string]bool)
+	var paths []managedPath
+	for _, p := range candidates {
+		if seen[p.Path] {
+			continue
+		}
+		seen[p.Path] = true
+
+		size, err := diskUsage(p.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("measuring %s: %w", p.Path, err)
+		}
+		p.Size = size
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// diskUsage returns the total size of the regular files under path.
+func diskUsage(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// removeAppData deletes each path, reporting it to w.
+func removeAppData(w io.Writer, paths []managedPath) error {
+	for _, p := range paths {
+		if err := os.RemoveAll(p.Path); err != nil {
+			return fmt.Errorf("removing %s: %w", p.Path, err)
+		}
+		fmt.Fprintf(w, "Removed %s: %s (%s)\n", p.Label, p.Path, formatBytes(p.Size))
+	}
+	return nil
+}
+
+// formatBytes renders n with a binary unit, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoveAppData(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	configDir := filepath.Join(root, "config")
+	cacheDir := filepath.Join(root, "cache")
+	require.NoError(t, os.MkdirAll(configDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "credentials.json"), make([]byte, 100), 0o600))
+	require.NoError(t, os.MkdirAll(cacheDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(cacheDir, "cache.json"), make([]byte, 2048), 0o644))
+
+	paths, err := existingPaths([]managedPath{
+		{Label: "config and credentials", Path: configDir},
+		{Label: "tag cache", Path: cacheDir},
+		{Label: "tag cache", Path: cacheDir},
+		{Label: "tag cache", Path: filepath.Join(root, "missing")},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []managedPath{
+		{Label: "config and credentials", Path: configDir, Size: 100},
+		{Label: "tag cache", Path: cacheDir, Size: 2048},
+	}, paths)
+
+	var out bytes.Buffer
+	require.NoError(t, removeAppData(&out, paths))
+	assert.NoDirExists(t, configDir)
+	assert.NoDirExists(t, cacheDir)
+	assert.Equal(t, "Removed config and credentials: "+configDir+" (100 B)\n"+
+		"Removed tag cache: "+cacheDir+" (2.0 KiB)\n", out.String())
+}
+
+func TestFormatBytes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, formatBytes(test.n))
+		})
+	}
+}
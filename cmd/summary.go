@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Run statuses reported in the --summary-json file.
+const (
+	statusComplete = "complete" // full output written
+	statusPartial  = "partial"  // interrupted, --save-partial output written
+	statusDryRun   = "dry_run"  // mapping checked, nothing written
+)
+
+// runSummary is the machine-readable account of a run written by --summary-json.
+type runSummary struct {
+	Status     string `json:"status"`
+	Output     string `json:"output,omitempty"`
+	Format     string `json:"format"`
+	RemotePath string `json:"remote_path"`
+
+	LocalFiles       int `json:"local_files"`
+	DropboxFiles     int `json:"dropbox_files"`
+	Matched          int `json:"matched"`
+	UnmatchedLocal   int `json:"unmatched_local"`
+	UnmatchedDropbox int `json:"unmatched_dropbox"`
+	Conflicts        int `json:"conflicts"`
+	SizeMismatches   int `json:"size_mismatches"`
+	InBase           int `json:"in_base"`
+	Shared           int `json:"shared"`
+	DropboxOnly      int `json:"dropbox_only"`
+	OutOfRange       int `json:"out_of_range"`
+
+	TagErrors         int `json:"tag_errors"`
+	DuplicatesRemoved int `json:"duplicates_removed"`
+	Items             int `json:"items"`
+
+	Cache cacheSummary `json:"cache"`
+
+	Durations durationSummary `json:"durations_ms"`
+}
+
+// cacheSummary reports tag cache effectiveness.
+type cacheSummary struct {
+	Enabled bool    `json:"enabled"`
+	Hits    int     `json:"hits"`
+	Parsed  int     `json:"parsed"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// durationSummary holds per-phase wall-clock times in milliseconds.
+type durationSummary struct {
+	Scan  int64 `json:"scan"`
+	List  int64 `json:"list"`
+	Tags  int64 `json:"tags"`
+	Total int64 `json:"total"`
+}
+
+// ms converts d to whole milliseconds for the summary.
+func ms(d time.Duration) int64 {
+	return d.Milliseconds()
+}
+
+// writeSummary writes s to path as indented JSON.
+func writeSummary(path string, s runSummary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling summary: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSummary_Schema(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "summary.json")
+	require.NoError(t, writeSummary(path, runSummary{
+		Status:     statusComplete,
+		Output:     "cloudbeats.cbbackup",
+		Format:     "cbbackup",
+		RemotePath: "/Music",
+		LocalFiles: 10,
+		Matched:    9,
+		Items:      9,
+		Cache:      cacheSummary{Enabled: true, Hits: 6, Parsed: 3, HitRate: 6.0 / 9},
+		Durations:  durationSummary{Scan: 5, List: 200, Tags: 40, Total: 260},
+	}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+
+	keys := func(m map[string]any) []string {
+		out := make([]string, 0, len(m))
+		for k := range m {
+			out = append(out, k)
+		}
+		return out
+	}
+
+	// Pipelines assert on these names; renaming one is a breaking change.
+	assert.ElementsMatch(t, []string{
+		"status", "output", "format", "remote_path",
+		"local_files", "dropbox_files", "matched", "unmatched_local", "unmatched_dropbox", "conflicts", "size_mismatches", "in_base", "shared", "dropbox_only", "out_of_range",
+		"tag_errors", "duplicates_removed", "items",
+		"cache", "durations_ms",
+	}, keys(got))
+	assert.ElementsMatch(t, []string{"enabled", "hits", "parsed", "hit_rate"}, keys(got["cache"].(map[string]any)))
+	assert.ElementsMatch(t, []string{"scan", "list", "tags", "total"}, keys(got["durations_ms"].(map[string]any)))
+
+	assert.Equal(t, "complete", got["status"])
+	assert.InDelta(t, 0.667, got["cache"].(map[string]any)["hit_rate"], 0.001)
+}
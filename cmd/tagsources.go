@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// tagSourcesReport is what --tag-sources-report writes: where the metadata of
+// each matched file came from, to find poorly tagged files.
+type tagSourcesReport struct {
+	Files []fileTagSources `json:"files"`
+}
+
+// fileTagSources is one file of a tagSourcesReport. Sources is omitted for
+// metadata taken from a manifest.
+type fileTagSources struct {
+	// Path is relative to --local, with forward slashes.
+	Path    string            `json:"path"`
+	Sources tags.FieldSources `json:"sources,omitzero"`
+}
+
+// newTagSourcesReport collects the field sources of each matched file, with
+// paths made relative to localDir.
+func newTagSourcesReport(localDir string, matched []matcher.MatchedFile, metas []tags.AudioMeta) tagSourcesReport {
+	r := tagSourcesReport{Files: make([]fileTagSources, len(matched))}
+	for i, mf := range matched {
+		path := mf.LocalPath
+		if rel, err := filepath.Rel(localDir, path); err == nil {
+			path = rel
+		}
+		r.Files[i] = fileTagSources{Path: filepath.ToSlash(path), Sources: metas[i].Sources}
+	}
+	return r
+}
+
+// writeTagSourcesReport writes r to path as indented JSON.
+func writeTagSourcesReport(path string, r tagSourcesReport) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling tag sources report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing tag sources report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestTagSourcesReport(t *testing.T) {
+	t.Parallel()
+
+	local := filepath.FromSlash("/music")
+	matched := []matcher.MatchedFile{
+		{LocalPath: filepath.Join(local, "Band", "Record", "01 Song.flac")},
+		{LocalPath: filepath.Join(local, "from-manifest.mp3")},
+	}
+	metas := []tags.AudioMeta{
+		tags.FromPath(local, matched[0].LocalPath),
+		{Title: "From Manifest"},
+	}
+
+	path := filepath.Join(t.TempDir(), "sources.json")
+	require.NoError(t, writeTagSourcesReport(path, newTagSourcesReport(local, matched, metas)))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, map[string]any{
+		"files": []any{
+			map[string]any{
+				"path": "Band/Record/01 Song.flac",
+				"sources": map[string]any{
+					"title": "path", "artist": "path", "album": "path", "album_artist": "path",
+					"genre": "default", "year": "default", "track_number": "path", "disk_number": "default",
+				},
+			},
+			map[string]any{"path": "from-manifest.mp3"},
+		},
+	}, got)
+}
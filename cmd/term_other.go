@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// terminalWidth returns 0 (unknown) on platforms without a window size ioctl.
+func terminalWidth(*os.File) int {
+	return 0
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/config"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+)
+
+// tokenRefreshMargin is how much lifetime the access token must have left before
+// the listing starts; a large library can take many minutes to list.
+const tokenRefreshMargin = 10 * time.Minute
+
+// accessToken is the token a run uses and, when it came from a refresh token,
+// how to get a new one.
+type accessToken struct {
+	value string
+	// expiresAt is zero when the lifetime is unknown (a token given directly).
+	expiresAt time.Time
+	// refresh is nil in direct-token mode, where the token cannot be renewed.
+	refresh func(ctx context.Context) (string, time.Duration, error)
+	// forget, when value was reused from a token cache, removes it from there.
+	forget func()
+}
+
+// refresher exchanges a refresh token for an access token and its lifetime,
+// as dropbox.RefreshAccessTokenWithExpiry does.
+type refresher func(ctx context.Context, appKey, appSecret, refreshToken string) (string, time.Duration, error)
+
+// newRefreshedToken returns an access token for the given credentials, and
+// keeps them to renew it later with refresh. A token in tokens with at least
+// tokenRefreshMargin of lifetime left is reused; otherwise a new one is
+// fetched and added to tokens.
+func newRefreshedToken(ctx context.Context, tokens *tokenCache, refresh refresher, appKey, appSecret, refreshToken string, logger zerolog.Logger) (accessToken, error) {
+	key := tokenCacheKey(appKey, refreshToken)
+	tok := accessToken{refresh: func(ctx context.Context) (string, time.Duration, error) {
+		value, lifetime, err := refresh(ctx, appKey, appSecret, refreshToken)
+		if err == nil && lifetime > 0 {
+			if err := tokens.put(key, cachedToken{Value: value, ExpiresAt: time.Now().Add(lifetime)}); err != nil {
+				logger.Warn().Err(err).Msg("saving the access token for later runs")
+			}
+		}
+		return value, lifetime, err
+	}}
+
+	if cached, ok := tokens.get(key, time.Now()); ok {
+		tok.value, tok.expiresAt = cached.Value, cached.ExpiresAt
+		tok.forget = func() {
+			if err := tokens.drop(key); err != nil {
+				logger.Warn().Err(err).Msg("removing the rejected access token")
+			}
+		}
+		logger.Info().Str("valid_until", cached.ExpiresAt.Local().Format("15:04")).
+			Msg("reusing access token refreshed earlier")
+		return tok, nil
+	}
+	if _, err := tok.renew(ctx, time.Now(), logger); err != nil {
+		return accessToken{}, err
+	}
+	return tok, nil
+}
+
+// retryRejectedToken runs call and, if Dropbox rejects an access token reused
+// from the token cache (it may have been revoked), forgets it, refreshes the
+// token once, hands it to client, and runs call again.
+func retryRejectedToken(ctx context.Context, client *dropbox.Client, tok *accessToken, logger zerolog.Logger, call func() error) error {
+	err := call()
+	var apiErr *dropbox.APIError
+	if err == nil || tok.forget == nil || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		return err
+	}
+	logger.Warn().Msg("Dropbox rejected the saved access token, refreshing it...")
+	tok.forget()
+	value, err := tok.renew(ctx, time.Now(), logger)
+	if err != nil {
+		return fmt.Errorf("refreshing rejected access token: %w", err)
+	}
+	client.SetToken(value)
+	return call()
+}
+
+// tokenCacheFile is the file in the config directory where --reuse-token keeps
+// access tokens between runs.
+const tokenCacheFile = "token-cache.json"
+
+// cachedToken is an access token and when it stops working.
+type cachedToken struct {
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tokenCache keeps refreshed access tokens, keyed by a hash of the app key and
+// refresh token they came from, so they can be reused while still valid. With
+// a path, it is also saved there for later runs; refresh tokens themselves are
+// never written. It is safe for concurrent use. A nil *tokenCache keeps nothing.
+type tokenCache struct {
+	path string // "" keeps the tokens in memory only
+
+	mu     sync.Mutex
+	tokens map[string]cachedToken
+}
+
+// loadTokenCache returns a tokenCache saved at path, with the tokens an earlier
+// run left there. A missing or unreadable file starts it empty.
+func loadTokenCache(path string, logger zerolog.Logger) *tokenCache {
+	c := &tokenCache{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			logger.Warn().Err(err).Msg("reading saved access tokens")
+		}
+		return c
+	}
+	if err := json.Unmarshal(data, &c.tokens); err != nil {
+		logger.Warn().Err(err).Msg("parsing saved access tokens")
+		c.tokens = nil
+	}
+	return c
+}
+
+// tokenCachePath is where --reuse-token saves access tokens.
+func tokenCachePath() (string, error) {
+	dir, err := config.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, tokenCacheFile), nil
+}
+
+// tokenCacheKey identifies the credentials a token was refreshed with, without
+// revealing the refresh token.
+func tokenCacheKey(appKey, refreshToken string) string {
+	sum := sha256.Sum256([]byte(appKey + "\x00" + refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// get returns the token stored under key if it has at least tokenRefreshMargin
+// of lifetime left after now.
+func (c *tokenCache) get(key string, now time.Time) (cachedToken, bool) {
+	if c == nil {
+		return cachedToken{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tok, ok := c.tokens[key]
+	if !ok || tok.ExpiresAt.Sub(now) < tokenRefreshMargin {
+		return cachedToken{}, false
+	}
+	return tok, true
+}
+
+// put stores tok under key, drops expired tokens, and saves the cache if it
+// has a path.
+func (c *tokenCache) put(key string, tok cachedToken) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]cachedToken)
+	}
+	c.tokens[key] = tok
+	now := time.Now()
+	for k, t := range c.tokens {
+		if !t.ExpiresAt.After(now) {
+			delete(c.tokens, k)
+		}
+	}
+	return c.save()
+}
+
+// drop removes the token stored under key and saves the cache if it has a path.
+func (c *tokenCache) drop(key string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, key)
+	return c.save()
+}
+
+// save writes the tokens to c.path, if set. The caller must hold c.mu.
+func (c *tokenCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.tokens)
+	if err != nil {
+		return fmt.Errorf("encoding access tokens: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("creating config directory: %w", err)
+	}
+	if err := os.WriteFile(c.path, data, 0o600); err != nil {
+		return fmt.Errorf("writing access tokens: %w", err)
+	}
+	return nil
+}
+
+// renew fetches a new token, recording its expiry relative to now.
+func (t *accessToken) renew(ctx context.Context, now time.Time, logger zerolog.Logger) (string, error) {
+	value, lifetime, err := t.refresh(ctx)
+	if err != nil {
+		return "", err
+	}
+	t.value = value
+	t.forget = nil
+	t.expiresAt = time.Time{}
+	if lifetime > 0 {
+		t.expiresAt = now.Add(lifetime)
+	}
+	logRefreshed(logger, lifetime)
+	return value, nil
+}
+
+// expiresWithin reports whether the token is known to expire less than margin after now.
+func (t *accessToken) expiresWithin(now time.Time, margin time.Duration) bool {
+	return !t.expiresAt.IsZero() && t.expiresAt.Sub(now) < margin
+}
+
+// renewBeforeListing refreshes the token and hands it to client if it expires
+// within tokenRefreshMargin, so a long listing does not fail half-way with an
+// expired token. Tokens given directly cannot be renewed and are left as is.
+func renewBeforeListing(ctx context.Context, client *dropbox.Client, tok *accessToken, now time.Time, logger zerolog.Logger) error {
+	if tok.refresh == nil || !tok.expiresWithin(now, tokenRefreshMargin) {
+		return nil
+	}
+	logger.Info().Dur("remaining", tok.expiresAt.Sub(now).Round(time.Second)).
+		Msg("access token expires soon, refreshing before listing...")
+	value, err := tok.renew(ctx, now, logger)
+	if err != nil {
+		return fmt.Errorf("refreshing access token before listing: %w", err)
+	}
+	client.SetToken(value)
+	return nil
+}
+
+// logRefreshed reports a refreshed access token and, when Dropbox gave its
+// lifetime, the local time it stops working.
+func logRefreshed(logger zerolog.Logger, lifetime time.Duration) {
+	ev := logger.Info()
+	if lifetime > 0 {
+		ev = ev.Str("valid_until", time.Now().Add(lifetime).Format("15:04"))
+	}
+	ev.Msg("access token refreshed successfully")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+)
+
+// unmatchedReport is what --list-unmatched prints: every file that will not
+// make it into the backup, and why.
+type unmatchedReport struct {
+	// UnmatchedLocal holds local files, relative to --local, with no Dropbox counterpart.
+	UnmatchedLocal []string `json:"unmatched_local"`
+	// UnmatchedDropbox holds Dropbox audio files with no local counterpart.
+	UnmatchedDropbox []string `json:"unmatched_dropbox"`
+	// Conflicts holds local files whose basename matched several Dropbox files.
+	Conflicts []string `json:"conflicts,omitempty"`
+	// SizeMismatches holds local files whose size differs from Dropbox (--check-sizes).
+	SizeMismatches []string `json:"size_mismatches,omitempty"`
+}
+
+// newUnmatchedReport collects the unmatched files of result, with local paths
+// made relative to localDir.
+func newUnmatchedReport(localDir string, result matcher.ScanResult) unmatchedReport {
+	rel := func(path string) string {
+		if r, err := filepath.Rel(localDir, path); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return path
+	}
+
+	r := unmatchedReport{
+		UnmatchedLocal:   make([]string, 0, len(result.UnmatchedLocal)),
+		UnmatchedDropbox: make([]string, 0, len(result.UnmatchedDropbox)),
+	}
+	for _, path := range result.UnmatchedLocal {
+		r.UnmatchedLocal = append(r.UnmatchedLocal, rel(path))
+	}
+	for _, entry := range result.UnmatchedDropbox {
+		r.UnmatchedDropbox = append(r.UnmatchedDropbox, entry.PathDisplay)
+	}
+	for _, c := range result.Conflicts {
+		r.Conflicts = append(r.Conflicts, rel(c.LocalPath))
+	}
+	for _, m := range result.SizeMismatches {
+		r.SizeMismatches = append(r.SizeMismatches, rel(m.LocalPath))
+	}
+	return r
+}
+
+// printUnmatched writes r to w as grouped, human-readable lists.
+func printUnmatched(w io.Writer, r unmatchedReport) {
+	section := func(title, hint string, paths []string) {
+		fmt.Fprintf(w, "\n%s: %d\n", title, len(paths))
+		if len(paths) > 0 && hint != "" {
+			fmt.Fprintf(w, "  (%s)\n", hint)
+		}
+		for _, p := range paths {
+			fmt.Fprintf(w, "  %s\n", p)
+		}
+	}
+
+	section("Local files not in Dropbox", "not synced yet, or outside the listed Dropbox folder", r.UnmatchedLocal)
+	section("Dropbox files not found locally", "online-only, or excluded by selective sync", r.UnmatchedDropbox)
+	if len(r.Conflicts) > 0 {
+		section("Ambiguous filenames", "several Dropbox files share the name; use --match path", r.Conflicts)
+	}
+	if len(r.SizeMismatches) > 0 {
+		section("Size differs from Dropbox", "still syncing, or a partial download", r.SizeMismatches)
+	}
+}
+
+// logCapped calls log for each of the first limit items (all of them if limit
+// is 0), then logs at debug level how many of what were left out, so thousands
+// of unmatched files do not bury the rest of the debug output.
+func logCapped[T any](logger zerolog.Logger, items []T, limit int, what string, log func(T)) {
+	for i, item := range items {
+		if limit > 0 && i == limit {
+			logger.Debug().Int("count", len(items)-limit).
+				Msgf("… and %d more %s (raise --max-unmatched-log to list them)", len(items)-limit, what)
+			return
+		}
+		log(item)
+	}
+}
+
+// writeUnmatchedJSON writes r to w as indented JSON.
+func writeUnmatchedJSON(w io.Writer, r unmatchedReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
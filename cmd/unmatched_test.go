@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+)
+
+func TestUnmatchedReport(t *testing.T) {
+	t.Parallel()
+
+	local := filepath.FromSlash("/music")
+	result := matcher.ScanResult{
+		Matched:          []matcher.MatchedFile{{LocalPath: filepath.Join(local, "ok.mp3")}},
+		UnmatchedLocal:   []string{filepath.Join(local, "Album", "new.flac")},
+		UnmatchedDropbox: []dropbox.Entry{{PathDisplay: "/Music/Online Only.mp3"}},
+	}
+	report := newUnmatchedReport(local, result)
+
+	var text bytes.Buffer
+	printUnmatched(&text, report)
+	assert.Contains(t, text.String(), "Local files not in Dropbox: 1\n")
+	assert.Contains(t, text.String(), "  Album/new.flac\n")
+	assert.Contains(t, text.String(), "Dropbox files not found locally: 1\n")
+	assert.Contains(t, text.String(), "  /Music/Online Only.mp3\n")
+	assert.NotContains(t, text.String(), "ok.mp3")
+	assert.NotContains(t, text.String(), "Ambiguous", "empty optional sections are omitted")
+
+	var out bytes.Buffer
+	require.NoError(t, writeUnmatchedJSON(&out, report))
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(out.Bytes(), &got))
+	assert.Equal(t, map[string]any{
+		"unmatched_local":   []any{"Album/new.flac"},
+		"unmatched_dropbox": []any{"/Music/Online Only.mp3"},
+	}, got)
+}
+
+func TestUnmatchedReport_EmptyListsAreArrays(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	require.NoError(t, writeUnmatchedJSON(&out, newUnmatchedReport("/music", matcher.ScanResult{})))
+	assert.JSONEq(t, `{"unmatched_local": [], "unmatched_dropbox": []}`, out.String())
+}
+
+func TestLogCapped(t *testing.T) {
+	t.Parallel()
+
+	items := []string{"a", "b", "c", "d", "e"}
+	tests := []struct {
+		name   string
+		limit  int
+		logged []string
+		more   string
+	}{
+		{name: "over the limit", limit: 2, logged: []string{"a", "b"}, more: "… and 3 more files"},
+		{name: "at the limit", limit: 5, logged: items},
+		{name: "unlimited", limit: 0, logged: items},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			logger := zerolog.New(&out).Level(zerolog.DebugLevel)
+			var logged []string
+			logCapped(logger, items, test.limit, "files", func(s string) { logged = append(logged, s) })
+
+			assert.Equal(t, test.logged, logged)
+			if test.more == "" {
+				assert.Empty(t, out.String())
+			} else {
+				assert.Contains(t, out.String(), test.more)
+			}
+		})
+	}
+}
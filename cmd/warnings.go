@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// warningKind names the problem a runWarning reports.
+type warningKind string
+
+// Warning kinds written to --warnings-file.
+const (
+	warnScanSkipped        warningKind = "scan_skipped"
+	warnUnmatchedLocal     warningKind = "unmatched_local"
+	warnUnmatchedDropbox   warningKind = "unmatched_dropbox"
+	warnAmbiguousName      warningKind = "ambiguous_name"
+	warnSizeMismatch       warningKind = "size_mismatch"
+	warnTagError           warningKind = "tag_error"
+	warnTagWriteError      warningKind = "tag_write_error"
+	warnAlbumInconsistency warningKind = "album_inconsistency"
+)
+
+// runWarning is one line of --warnings-file: a problem with a single file.
+type runWarning struct {
+	Kind warningKind `json:"kind"`
+	// Path is the local path of the file, or its Dropbox path for
+	// unmatched_dropbox, or its file name for album_inconsistency.
+	Path string `json:"path"`
+	// Detail is a human-readable explanation, empty when the kind says it all.
+	Detail string `json:"detail"`
+}
+
+// warningStream writes runWarnings to a file as JSON lines as they happen, so
+// an integration can follow it during the run and keeps what was written if
+// the run dies. It is safe for concurrent use. A nil *warningStream discards
+// warnings.
+type warningStream struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+	err error
+}
+
+// createWarningStream creates (or truncates) the warnings file at path.
+func createWarningStream(path string) (*warningStream, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating warnings file: %w", err)
+	}
+	return &warningStream{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Emit writes a warning of the given kind. After a write error, warnings are
+// dropped; Close reports it.
+func (s *warningStream) Emit(kind warningKind, path, detail string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = s.enc.Encode(runWarning{Kind: kind, Path: path, Detail: detail})
+	}
+}
+
+// Close closes the file, returning the first write error, if any.
+func (s *warningStream) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.f.Close(); s.err == nil {
+		s.err = err
+	}
+	if s.err != nil {
+		return fmt.Errorf("writing warnings file: %w", s.err)
+	}
+	return nil
+}
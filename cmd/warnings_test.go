@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarningStream_Schema(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "warnings.jsonl")
+	warnings, err := createWarningStream(path)
+	require.NoError(t, err)
+	warnings.Emit(warnUnmatchedLocal, "/music/a.mp3", "")
+	warnings.Emit(warnTagError, "/music/b.flac", "taglib panicked")
+	warnings.Emit(warnAlbumInconsistency, "c.mp3", `album "Record": year is "1999", most tracks have "2001"`)
+	require.NoError(t, warnings.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	kinds := []warningKind{
+		warnScanSkipped, warnUnmatchedLocal, warnUnmatchedDropbox, warnAmbiguousName,
+		warnSizeMismatch, warnTagError, warnTagWriteError, warnAlbumInconsistency,
+	}
+	var got []map[string]any
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		var w map[string]any
+		require.NoError(t, json.Unmarshal(lines.Bytes(), &w), "each line is a JSON object")
+		assert.Len(t, w, 3, "every warning has exactly kind, path, and detail")
+		for _, key := range []string{"kind", "path", "detail"} {
+			assert.IsType(t, "", w[key], key)
+		}
+		assert.True(t, slices.Contains(kinds, warningKind(w["kind"].(string))), "known kind %v", w["kind"])
+		got = append(got, w)
+	}
+	require.NoError(t, lines.Err())
+	assert.Equal(t, []map[string]any{
+		{"kind": "unmatched_local", "path": "/music/a.mp3", "detail": ""},
+		{"kind": "tag_error", "path": "/music/b.flac", "detail": "taglib panicked"},
+		{"kind": "album_inconsistency", "path": "c.mp3", "detail": `album "Record": year is "1999", most tracks have "2001"`},
+	}, got)
+}
+
+func TestWarningStream_Nil(t *testing.T) {
+	t.Parallel()
+
+	var warnings *warningStream
+	warnings.Emit(warnTagError, "/music/a.mp3", "ignored")
+	assert.NoError(t, warnings.Close())
+}
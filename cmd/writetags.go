@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// tagChange is a file whose tags --write-tags rewrites.
+type tagChange struct {
+	// Index is the file's position in the matched files.
+	Index int
+	Path  string
+	Meta  tags.AudioMeta
+	// Fields lists what changes, as "field: old -> new", for the preview.
+	Fields []string
+}
+
+// normalizeMeta applies tags.Normalize to the metadata read from the file at
+// path. A title that only comes from the file name is left alone, so no TITLE
+// tag is added.
+func normalizeMeta(path string, meta tags.AudioMeta) tags.AudioMeta {
+	normalized := tags.Normalize(meta)
+	if meta.Title == fileTitle(path) {
+		normalized.Title = meta.Title
+	}
+	return normalized
+}
+
+// planTagWrites compares the metadata read from each file with its normalized
+// form and with the album artist filled in on its backup item by
+// --prefer-tag-albumartist-fallback, and returns the files that change.
+func planTagWrites(matched []matcher.MatchedFile, metas []tags.AudioMeta, errs []error, items []backup.Item) []tagChange {
+	inferred := make(map[string]string, len(items))
+	for _, it := range items {
+		inferred[it.Key] = it.AlbumArtist
+	}
+
+	var changes []tagChange
+	for i, mf := range matched {
+		if errs[i] != nil {
+			continue
+		}
+		original := metas[i]
+		meta := normalizeMeta(mf.LocalPath, original)
+		if isUnknown(original.AlbumArtist) {
+			if aa := inferred[backup.ItemKey(mf.Entry)]; !isUnknown(aa) {
+				meta.AlbumArtist = aa
+			}
+		}
+
+		var fields []string
+		diff := func(name, before, after string) {
+			if before != after && !isUnknown(after) {
+				fields = append(fields, fmt.Sprintf("%s: %q -> %q", name, before, after))
+			}
+		}
+		diff("title", original.Title, meta.Title)
+		diff("artist", original.Artist, meta.Artist)
+		diff("album", original.Album, meta.Album)
+		diff("album artist", original.AlbumArtist, meta.AlbumArtist)
+		diff("genre", original.Genre, meta.Genre)
+		diff("artist sort", original.ArtistSort, meta.ArtistSort)
+		diff("album artist sort", original.AlbumArtistSort, meta.AlbumArtistSort)
+		diff("album sort", original.AlbumSort, meta.AlbumSort)
+		if len(fields) > 0 {
+			changes = append(changes, tagChange{Index: i, Path: mf.LocalPath, Meta: meta, Fields: fields})
+		}
+	}
+	return changes
+}
+
+// printTagChanges writes the --write-tags preview to w, with paths relative to root.
+func printTagChanges(w io.Writer, root string, changes []tagChange) {
+	for _, c := range changes {
+		rel, err := filepath.Rel(root, c.Path)
+		if err != nil {
+			rel = c.Path
+		}
+		fmt.Fprintf(w, "%s\n    %s\n", rel, strings.Join(c.Fields, "\n    "))
+	}
+}
+
+// applyTagChanges writes each change with write, reporting failures to
+// onError and carrying on. It returns the changes that were written.
+func applyTagChanges(changes []tagChange, write func(string, tags.AudioMeta) error, onError func(path string, err error)) []tagChange {
+	var written []tagChange
+	for _, c := range changes {
+		if err := write(c.Path, c.Meta); err != nil {
+			onError(c.Path, err)
+			continue
+		}
+		written = append(written, c)
+	}
+	return written
+}
+
+// applyWrittenTags updates metas and the backup items of the files in written
+// to the tags now in those files, so the backup matches them. Chapter items
+// keep their chapter titles.
+func applyWrittenTags(items []backup.Item, metas []tags.AudioMeta, accountID string, matched []matcher.MatchedFile,
+	written []tagChange, opts backup.ItemOptions,
+) {
+	fresh := make(map[string]backup.Item, len(written))
+	for _, c := range written {
+		metas[c.Index] = c.Meta
+		it := backup.NewItem(accountID, matched[c.Index].Entry, c.Meta, opts)
+		fresh[it.Key] = it
+	}
+	for i, it := range items {
+		f, ok := fresh[it.Key]
+		if !ok {
+			continue
+		}
+		if it.Stop == 0 {
+			items[i].TagName = f.TagName
+		}
+		items[i].Artist, items[i].Album, items[i].AlbumArtist = f.Artist, f.Album, f.AlbumArtist
+		items[i].Genre = f.Genre
+		items[i].ArtistSort, items[i].AlbumArtistSort, items[i].AlbumSort = f.ArtistSort, f.AlbumArtistSort, f.AlbumSort
+	}
+}
+
+// fileTitle is the title tags.ReadFile falls back to for a file without one.
+func fileTitle(path string) string {
+	name := filepath.Base(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// isUnknown reports whether an artist or album value is absent.
+func isUnknown(s string) bool {
+	return s == "" || s == tags.Unknown
+}
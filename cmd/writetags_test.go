@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/backup"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestPlanTagWrites(t *testing.T) {
+	t.Parallel()
+
+	matched := []matcher.MatchedFile{
+		{LocalPath: "/music/Album/01 Song.mp3", Entry: dropbox.Entry{ID: "id:1"}},
+		{LocalPath: "/music/Album/02 Untitle\u0301d.mp3", Entry: dropbox.Entry{ID: "id:2"}},
+		{LocalPath: "/music/Album/03 Clean.mp3", Entry: dropbox.Entry{ID: "id:3"}},
+		{LocalPath: "/music/Album/04 Broken.mp3", Entry: dropbox.Entry{ID: "id:4"}},
+	}
+	metas := []tags.AudioMeta{
+		{Title: " Song ", Artist: "Band", Album: "Album\t", AlbumArtist: tags.Unknown},
+		// Decomposed file name used as the title: not a tag, so not written
+		{Title: "02 Untitle\u0301d", Artist: "Band", Album: "Album", AlbumArtist: "Band"},
+		{Title: "Clean", Artist: "Band", Album: "Album", AlbumArtist: "Band"},
+		{Title: " Broken ", Artist: "Band", Album: "Album", AlbumArtist: "Band"},
+	}
+	errs := []error{nil, nil, nil, errors.New("taglib panicked")}
+
+	original := append([]tags.AudioMeta(nil), metas...)
+
+	// --prefer-tag-albumartist-fallback filled in the first track's album artist
+	items := []backup.Item{
+		{Key: "id:1", AlbumArtist: "Band"},
+		{Key: "id:2", AlbumArtist: "Band"},
+		{Key: "id:3", AlbumArtist: "Band"},
+	}
+	changes := planTagWrites(matched, metas, errs, items)
+	assert.Equal(t, original, metas, "planning leaves the read tags alone")
+
+	// File name titles are kept as is, and failed reads are left alone
+	require.Len(t, changes, 1)
+	assert.Equal(t, 0, changes[0].Index)
+	assert.Equal(t, "/music/Album/01 Song.mp3", changes[0].Path)
+	assert.Equal(t, "Song", changes[0].Meta.Title)
+	assert.Equal(t, "Album", changes[0].Meta.Album)
+	assert.Equal(t, "Band", changes[0].Meta.AlbumArtist)
+	assert.Equal(t, []string{
+		`title: " Song " -> "Song"`,
+		`album: "Album\t" -> "Album"`,
+		`album artist: "Unknown" -> "Band"`,
+	}, changes[0].Fields)
+
+	var out strings.Builder
+	printTagChanges(&out, "/music", changes)
+	assert.Equal(t, "Album/01 Song.mp3\n"+
+		"    title: \" Song \" -> \"Song\"\n"+
+		"    album: \"Album\\t\" -> \"Album\"\n"+
+		"    album artist: \"Unknown\" -> \"Band\"\n", out.String())
+}
+
+func TestApplyTagChanges(t *testing.T) {
+	t.Parallel()
+
+	changes := []tagChange{{Path: "/a.mp3"}, {Path: "/readonly.mp3"}, {Path: "/b.mp3"}}
+	var wrote, failed []string
+	written := applyTagChanges(changes,
+		func(path string, _ tags.AudioMeta) error {
+			if path == "/readonly.mp3" {
+				return tags.ErrWriteFailed
+			}
+			wrote = append(wrote, path)
+			return nil
+		},
+		func(path string, err error) {
+			assert.ErrorIs(t, err, tags.ErrWriteFailed)
+			failed = append(failed, path)
+		})
+
+	assert.Equal(t, []tagChange{{Path: "/a.mp3"}, {Path: "/b.mp3"}}, written)
+	assert.Equal(t, []string{"/a.mp3", "/b.mp3"}, wrote)
+	assert.Equal(t, []string{"/readonly.mp3"}, failed)
+}
+
+func TestApplyWrittenTags(t *testing.T) {
+	t.Parallel()
+
+	matched := []matcher.MatchedFile{
+		{LocalPath: "/music/01.mp3", Entry: dropbox.Entry{ID: "id:1", Name: "01.mp3", PathDisplay: "/Music/01.mp3"}},
+		{LocalPath: "/music/02.mp3", Entry: dropbox.Entry{ID: "id:2", Name: "02.mp3", PathDisplay: "/Music/02.mp3"}},
+	}
+	metas := []tags.AudioMeta{
+		{Title: " Song ", Artist: "Band ", Album: "Album", AlbumArtist: tags.Unknown},
+		{Title: " Other ", Artist: "Band ", Album: "Album", AlbumArtist: tags.Unknown},
+	}
+	opts := backup.ItemOptions{}
+	items := []backup.Item{
+		backup.NewItem("dbid:1", matched[0].Entry, metas[0], opts),
+		backup.NewItem("dbid:1", matched[1].Entry, metas[1], opts),
+	}
+	// A chapter of the first file keeps its own title
+	chapter := items[0]
+	chapter.TagName, chapter.Stop = "Intro", time.Minute
+	items = append(items, chapter)
+
+	written := []tagChange{{Index: 0, Path: "/music/01.mp3", Meta: tags.AudioMeta{
+		Title: "Song", Artist: "Band", Album: "Album", AlbumArtist: "Band",
+	}}}
+	applyWrittenTags(items, metas, "dbid:1", matched, written, opts)
+
+	assert.Equal(t, written[0].Meta, metas[0])
+	assert.Equal(t, " Other ", metas[1].Title, "files left unwritten keep the tags read")
+	assert.Equal(t, "Song", items[0].TagName)
+	assert.Equal(t, "Band", items[0].Artist)
+	assert.Equal(t, "Band", items[0].AlbumArtist)
+	assert.Equal(t, "Band ", items[1].Artist)
+	assert.Equal(t, "Intro", items[2].TagName)
+	assert.Equal(t, "Band", items[2].AlbumArtist)
+}
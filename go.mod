@@ -6,6 +6,7 @@ require (
 	github.com/rs/zerolog v1.33.0
 	github.com/sentriz/audiotags v0.0.0-20250922130348-7ea48bcba851
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/sys v0.12.0
 	golang.org/x/text v0.21.0
 )
 
@@ -14,6 +15,5 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/sys v0.12.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
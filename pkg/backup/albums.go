@@ -0,0 +1,150 @@
+package backup
+
+import (
+	"strconv"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// AlbumWarning describes a track whose album-level tag disagrees with the rest of its album.
+type AlbumWarning struct {
+	Album    string
+	Folder   string // Dropbox folder holding the album
+	Field    string // "album_artist" or "year"
+	Key      string // item key of the offending track
+	Name     string // file name of the offending track
+	Value    string // the track's value
+	Majority string // the value most tracks of the album use
+}
+
+// DetectAlbumInconsistencies groups items by album, as InferAlbumArtists does,
+// and flags tracks whose album artist or year differs from the majority of the
+// album's tracks. Untagged ("Unknown" or empty) albums are ignored. Warnings
+// are ordered by the album's first appearance in items.
+func DetectAlbumInconsistencies(items []Item) []AlbumWarning {
+	var order []string
+	albums := make(map[string][]Item)
+	for _, it := range items {
+		if it.Album == "" || it.Album == tags.Unknown {
+			continue
+		}
+		key := it.albumKey()
+		if _, ok := albums[key]; !ok {
+			order = append(order, key)
+		}
+		albums[key] = append(albums[key], it)
+	}
+
+	fields := []struct {
+		name  string
+		value func(Item) string
+	}{
+		{"album_artist", func(it Item) string { return it.AlbumArtist }},
+		{"year", func(it Item) string { return strconv.Itoa(it.Year) }},
+	}
+
+	var warnings []AlbumWarning
+	for _, album := range order {
+		tracks := albums[album]
+		if len(tracks) < 2 {
+			continue
+		}
+		for _, f := range fields {
+			majority := majorityValue(tracks, f.value)
+			for _, it := range tracks {
+				if v := f.value(it); v != majority {
+					warnings = append(warnings, AlbumWarning{
+						Album:    it.Album,
+						Folder:   it.Dir(),
+						Field:    f.name,
+						Key:      it.Key,
+						Name:     it.Name,
+						Value:    v,
+						Majority: majority,
+					})
+				}
+			}
+		}
+	}
+
+	return warnings
+}
+
+// majorityValue returns the most common value among tracks; ties go to the value seen first.
+func majorityValue(tracks []Item, value func(Item) string) string {
+	counts := make(map[string]int)
+	best, bestCount := "", 0
+	for _, it := range tracks {
+		v := value(it)
+		counts[v]++
+		if counts[v] > bestCount {
+			best, bestCount = v, counts[v]
+		}
+	}
+	return best
+}
+
+// InferAlbumArtists fills in the album artist of tracks that lack one ("Unknown"
+// or empty) when the rest of their album agrees on a value: the album artist the
+// other tracks carry, or else the single artist of every track. An album is the
+// tracks of one folder sharing an album tag, so two artists' "Greatest Hits"
+// stay apart. Albums with mixed artists and no tagged album artist, such as
+// untagged compilations, are left alone. Untagged albums are ignored. It
+// returns how many items changed.
+func InferAlbumArtists(items []Item) int {
+	albums := make(map[string][]int)
+	for i, it := range items {
+		if isMissing(it.Album) {
+			continue
+		}
+		key := it.albumKey()
+		albums[key] = append(albums[key], i)
+	}
+
+	filled := 0
+	for _, idx := range albums {
+		inferred, ok := unanimous(items, idx, func(it Item) string { return it.AlbumArtist })
+		if !ok {
+			inferred, ok = unanimous(items, idx, func(it Item) string { return it.Artist })
+		}
+		if !ok {
+			continue
+		}
+		for _, i := range idx {
+			if isMissing(items[i].AlbumArtist) {
+				items[i].AlbumArtist = inferred
+				filled++
+			}
+		}
+	}
+	return filled
+}
+
+// unanimous returns the value shared by every track of idx that has one, and
+// false if none has a value or they disagree. Only artist-like fields use it,
+// so value treats "Unknown" and empty as absent.
+func unanimous(items []Item, idx []int, value func(Item) string) (string, bool) {
+	found := ""
+	for _, i := range idx {
+		v := value(items[i])
+		if isMissing(v) {
+			continue
+		}
+		if found != "" && v != found {
+			return "", false
+		}
+		found = v
+	}
+	return found, found != ""
+}
+
+// albumKey groups the tracks of one album: those sharing an album tag in the
+// same folder.
+func (it Item) albumKey() string {
+	return it.Album + "\x00" + it.Dir()
+}
+
+// isMissing reports whether an artist or album tag is absent.
+func isMissing(s string) bool {
+	return s == "" || s == tags.Unknown
+}
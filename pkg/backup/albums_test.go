@@ -0,0 +1,106 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectAlbumInconsistencies(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		{Name: "01.mp3", Album: "Abbey Road", AlbumArtist: "The Beatles", Year: 1969},
+		{Name: "02.mp3", Album: "Abbey Road", AlbumArtist: "The Beatles", Year: 1969},
+		{Name: "03.mp3", Album: "Abbey Road", AlbumArtist: "Beatles", Year: 1969},
+		{Name: "04.mp3", Album: "Abbey Road", AlbumArtist: "The Beatles", Year: 1969},
+		{Name: "a.mp3", Album: "Unknown", AlbumArtist: "X", Year: 1},
+		{Name: "b.mp3", Album: "Unknown", AlbumArtist: "Y", Year: 2},
+		{Name: "single.mp3", Album: "Single", AlbumArtist: "Z", Year: 2000},
+	}
+
+	got := DetectAlbumInconsistencies(items)
+
+	assert.Equal(t, []AlbumWarning{
+		{Album: "Abbey Road", Field: "album_artist", Name: "03.mp3", Value: "Beatles", Majority: "The Beatles"},
+	}, got)
+}
+
+func TestDetectAlbumInconsistencies_Consistent(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		{Name: "01.mp3", Album: "Album", AlbumArtist: "Artist", Year: 2001},
+		{Name: "02.mp3", Album: "Album", AlbumArtist: "Artist", Year: 2001},
+	}
+
+	assert.Empty(t, DetectAlbumInconsistencies(items))
+}
+
+func TestDetectAlbumInconsistencies_SameTitleInDifferentFolders(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		{Name: "q1.mp3", Folder: "/Music/Queen/Greatest Hits", Album: "Greatest Hits", AlbumArtist: "Queen", Year: 1981},
+		{Name: "q2.mp3", Folder: "/Music/Queen/Greatest Hits", Album: "Greatest Hits", AlbumArtist: "Queen", Year: 1981},
+		{Name: "a1.mp3", Folder: "/Music/ABBA/Greatest Hits", Album: "Greatest Hits", AlbumArtist: "ABBA", Year: 1975},
+		{Name: "a2.mp3", Folder: "/Music/ABBA/Greatest Hits", Album: "Greatest Hits", AlbumArtist: "ABBA", Year: 1976},
+	}
+
+	assert.Equal(t, []AlbumWarning{
+		{Album: "Greatest Hits", Folder: "/Music/ABBA/Greatest Hits", Field: "year", Name: "a2.mp3", Value: "1976", Majority: "1975"},
+	}, DetectAlbumInconsistencies(items))
+}
+
+func TestInferAlbumArtists(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		// Single-artist album without album artist tags
+		{Name: "kob1.mp3", Album: "Kind of Blue", Artist: "Miles Davis", AlbumArtist: "Unknown"},
+		{Name: "kob2.mp3", Album: "Kind of Blue", Artist: "Miles Davis", AlbumArtist: ""},
+		// Compilation: mixed artists, one track carries the album artist
+		{Name: "now1.mp3", Album: "Now 42", Artist: "Blur", AlbumArtist: "Various Artists"},
+		{Name: "now2.mp3", Album: "Now 42", Artist: "Pulp", AlbumArtist: "Unknown"},
+		{Name: "now3.mp3", Album: "Now 42", Artist: "Oasis", AlbumArtist: "Unknown"},
+		// Untagged compilation: mixed artists and no album artist anywhere
+		{Name: "mix1.mp3", Album: "Mixtape", Artist: "A", AlbumArtist: "Unknown"},
+		{Name: "mix2.mp3", Album: "Mixtape", Artist: "B", AlbumArtist: "Unknown"},
+		// Untagged album
+		{Name: "x.mp3", Album: "Unknown", Artist: "X", AlbumArtist: "Unknown"},
+	}
+
+	assert.Equal(t, 4, InferAlbumArtists(items))
+
+	got := make(map[string]string, len(items))
+	for _, it := range items {
+		got[it.Name] = it.AlbumArtist
+	}
+	assert.Equal(t, map[string]string{
+		"kob1.mp3": "Miles Davis",
+		"kob2.mp3": "Miles Davis",
+		"now1.mp3": "Various Artists",
+		"now2.mp3": "Various Artists",
+		"now3.mp3": "Various Artists",
+		"mix1.mp3": "Unknown",
+		"mix2.mp3": "Unknown",
+		"x.mp3":    "Unknown",
+	}, got)
+}
+
+func TestInferAlbumArtists_SameTitleInDifferentFolders(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		{Name: "q1.mp3", Folder: "/Music/Queen/Greatest Hits", Album: "Greatest Hits", Artist: "Queen", AlbumArtist: "Unknown"},
+		{Name: "q2.mp3", Folder: "/Music/Queen/Greatest Hits", Album: "Greatest Hits", Artist: "Queen", AlbumArtist: "Unknown"},
+		{Name: "a1.mp3", Folder: "/Music/ABBA/Greatest Hits", Album: "Greatest Hits", Artist: "ABBA", AlbumArtist: "Unknown"},
+		{Name: "a2.mp3", Folder: "/Music/ABBA/Greatest Hits", Album: "Greatest Hits", Artist: "ABBA", AlbumArtist: "Unknown"},
+	}
+
+	assert.Equal(t, 4, InferAlbumArtists(items))
+	assert.Equal(t, "Queen", items[0].AlbumArtist)
+	assert.Equal(t, "Queen", items[1].AlbumArtist)
+	assert.Equal(t, "ABBA", items[2].AlbumArtist)
+	assert.Equal(t, "ABBA", items[3].AlbumArtist)
+}
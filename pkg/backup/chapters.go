@@ -0,0 +1,50 @@
+package backup
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// SplitChapters turns a chaptered file's item into one item per chapter, each
+// bounded by Start and Stop, numbered from 1, and titled after its chapter
+// ("Chapter N" when untitled). A chapter ends where the next begins, the last
+// one at the item's duration. Chapters starting at or past the end of the file,
+// or out of order, are dropped. Without usable chapters, it is returned as is.
+// All chapter items share the file's Key, so Dedup must run before splitting.
+func SplitChapters(it Item, chapters []tags.Chapter) []Item {
+	total := time.Duration(float64(it.Duration) * float64(time.Second))
+
+	var split []Item
+	for i, ch := range chapters {
+		stop := total
+		if i+1 < len(chapters) {
+			stop = min(chapters[i+1].Start, total)
+		}
+		if ch.Start >= stop {
+			continue
+		}
+
+		n := len(split) + 1
+		part := it
+		part.TagName = ch.Title
+		if part.TagName == "" {
+			part.TagName = "Chapter " + strconv.Itoa(n)
+		}
+		part.TrackNumber = &n
+		part.TrackTotal = 0
+		part.Start = ch.Start
+		part.Stop = stop
+		part.Duration = Duration((stop - ch.Start).Seconds())
+		split = append(split, part)
+	}
+
+	if len(split) < 2 {
+		return []Item{it}
+	}
+	for i := range split {
+		split[i].TrackTotal = len(split)
+	}
+	return split
+}
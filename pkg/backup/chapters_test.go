@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestSplitChapters(t *testing.T) {
+	t.Parallel()
+
+	book := Item{Key: "id:book", Name: "Book.m4b", TagName: "The Book", Album: "The Book", Duration: Duration(3600)}
+	chapters := []tags.Chapter{
+		{Title: "Intro", Start: 0},
+		{Title: "", Start: 10 * time.Minute},
+		{Title: "Finale", Start: 45*time.Minute + 30*time.Second},
+		{Title: "Past the end", Start: 2 * time.Hour},
+	}
+
+	got := SplitChapters(book, chapters)
+	require.Len(t, got, 3)
+
+	want := []struct {
+		title       string
+		start, stop time.Duration
+		seconds     Duration
+	}{
+		{"Intro", 0, 10 * time.Minute, 600},
+		{"Chapter 2", 10 * time.Minute, 45*time.Minute + 30*time.Second, 2130},
+		{"Finale", 45*time.Minute + 30*time.Second, time.Hour, 870},
+	}
+	for i, w := range want {
+		assert.Equal(t, w.title, got[i].TagName)
+		assert.Equal(t, w.start, got[i].Start)
+		assert.Equal(t, w.stop, got[i].Stop)
+		assert.Equal(t, w.seconds, got[i].Duration)
+		require.NotNil(t, got[i].TrackNumber)
+		assert.Equal(t, i+1, *got[i].TrackNumber)
+		assert.Equal(t, 3, got[i].TrackTotal)
+		assert.Equal(t, "id:book", got[i].Key)
+		assert.Equal(t, "The Book", got[i].Album)
+	}
+}
+
+func TestSplitChapters_Unusable(t *testing.T) {
+	t.Parallel()
+
+	book := Item{Key: "id:book", TagName: "The Book", Duration: Duration(60)}
+
+	tests := []struct {
+		name     string
+		chapters []tags.Chapter
+	}{
+		{"no chapters", nil},
+		{"single chapter", []tags.Chapter{{Title: "Only", Start: 0}}},
+		{"all past the end", []tags.Chapter{{Start: 2 * time.Minute}, {Start: 3 * time.Minute}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, []Item{book}, SplitChapters(book, test.chapters))
+		})
+	}
+}
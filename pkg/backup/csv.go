@@ -0,0 +1,51 @@
+package backup
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+var csvHeader = []string{"path", "artist", "album", "title", "track", "disc", "year", "genre", "duration"}
+
+// WriteCSV writes a spreadsheet-friendly track listing of items to w, one row per item.
+// Absent track numbers and genres are written as empty cells.
+func WriteCSV(w io.Writer, items []Item) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("writing CSV header: %w", err)
+	}
+
+	for _, it := range items {
+		track := ""
+		if it.TrackNumber != nil {
+			track = strconv.Itoa(*it.TrackNumber)
+		}
+		genre := ""
+		if it.Genre != nil {
+			genre = *it.Genre
+		}
+
+		row := []string{
+			it.RemotePath(),
+			it.Artist,
+			it.Album,
+			it.TagName,
+			track,
+			strconv.Itoa(it.DiskNumber),
+			strconv.Itoa(it.Year),
+			genre,
+			it.Duration.String(),
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("writing CSV row: %w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("flushing CSV: %w", err)
+	}
+	return nil
+}
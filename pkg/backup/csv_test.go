@@ -0,0 +1,46 @@
+package backup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCSV(t *testing.T) {
+	t.Parallel()
+
+	genre := "Rock"
+	track := 3
+	items := []Item{
+		{
+			Name:        "song.mp3",
+			Folder:      "/Music/Artist/Album",
+			Artist:      "Artist",
+			Album:       "Album",
+			TagName:     "Song",
+			TrackNumber: &track,
+			DiskNumber:  1,
+			Year:        1999,
+			Genre:       &genre,
+			Duration:    Duration(294),
+		},
+		{
+			Name:       "other, with comma.flac",
+			Artist:     "Unknown",
+			Album:      "Unknown",
+			TagName:    "other",
+			DiskNumber: 2,
+			Duration:   Duration(61.04),
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, items))
+
+	want := "path,artist,album,title,track,disc,year,genre,duration\n" +
+		"/Music/Artist/Album/song.mp3,Artist,Album,Song,3,1,1999,Rock,294.0\n" +
+		"\"other, with comma.flac\",Unknown,Unknown,other,,2,0,,61.0\n"
+	assert.Equal(t, want, buf.String())
+}
@@ -0,0 +1,16 @@
+package backup
+
+// Dedup removes items that share a Key with an earlier item, keeping the first
+// occurrence and preserving order.
+func Dedup(items []Item) []Item {
+	seen := make(map[string]bool, len(items))
+	out := make([]Item, 0, len(items))
+	for _, it := range items {
+		if seen[it.Key] {
+			continue
+		}
+		seen[it.Key] = true
+		out = append(out, it)
+	}
+	return out
+}
@@ -0,0 +1,27 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedup(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		{Key: "id:1", Name: "a.mp3"},
+		{Key: "id:2", Name: "b.mp3"},
+		{Key: "id:1", Name: "a (shared).mp3"},
+		{Key: "id:3", Name: "c.mp3"},
+		{Key: "id:2", Name: "b (shared).mp3"},
+	}
+
+	got := Dedup(items)
+
+	assert.Equal(t, []Item{
+		{Key: "id:1", Name: "a.mp3"},
+		{Key: "id:2", Name: "b.mp3"},
+		{Key: "id:3", Name: "c.mp3"},
+	}, got)
+}
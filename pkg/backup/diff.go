@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"strconv"
+)
+
+// DiffResult lists how a new backup differs from an old one, matching items by Key.
+type DiffResult struct {
+	Added   []Item       `json:"added"`
+	Removed []Item       `json:"removed"`
+	Changed []ItemChange `json:"changed"`
+}
+
+// ItemChange describes an item present in both backups whose fields differ.
+type ItemChange struct {
+	Key    string        `json:"key"`
+	Name   string        `json:"name"`
+	Fields []FieldChange `json:"fields"`
+}
+
+// FieldChange is a single field's old and new value, using the backup JSON field name.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Empty reports whether the backups are equivalent.
+func (d DiffResult) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// itemFields lists the compared item fields by their JSON name.
+var itemFields = []struct {
+	name  string
+	value func(Item) string
+}{
+	{"account_id", func(it Item) string { return it.AccountID }},
+	{"name", func(it Item) string { return it.Name }},
+	{"path", func(it Item) string { return it.Path }},
+	{"service", func(it Item) string { return it.Service }},
+	{"tag_album", func(it Item) string { return it.Album }},
+	{"tag_albumArtist", func(it Item) string { return it.AlbumArtist }},
+	{"tag_artist", func(it Item) string { return it.Artist }},
+	{"tag_diskNumber", func(it Item) string { return strconv.Itoa(it.DiskNumber) }},
+	{"tag_duration", func(it Item) string { return it.Duration.String() }},
+	{"tag_genre", func(it Item) string { return derefString(it.Genre) }},
+	{"tag_name", func(it Item) string { return it.TagName }},
+	{"tag_trackNumber", func(it Item) string { return derefInt(it.TrackNumber) }},
+	{"tag_year", func(it Item) string { return strconv.Itoa(it.Year) }},
+}
+
+// Diff compares two backups by item Key. Added and changed items follow the
+// order of newB; removed items follow the order of old.
+func Diff(old, newB *Backup) DiffResult {
+	oldByKey := make(map[string]Item, len(old.Items))
+	for _, it := range old.Items {
+		oldByKey[it.Key] = it
+	}
+	newKeys := make(map[string]bool, len(newB.Items))
+
+	var d DiffResult
+	for _, it := range newB.Items {
+		newKeys[it.Key] = true
+		prev, ok := oldByKey[it.Key]
+		if !ok {
+			d.Added = append(d.Added, it)
+			continue
+		}
+
+		var fields []FieldChange
+		for _, f := range itemFields {
+			if o, n := f.value(prev), f.value(it); o != n {
+				fields = append(fields, FieldChange{Field: f.name, Old: o, New: n})
+			}
+		}
+		if len(fields) > 0 {
+			d.Changed = append(d.Changed, ItemChange{Key: it.Key, Name: it.Name, Fields: fields})
+		}
+	}
+
+	for _, it := range old.Items {
+		if !newKeys[it.Key] {
+			d.Removed = append(d.Removed, it)
+		}
+	}
+
+	return d
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func derefInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	rock := "Rock"
+	track1, track2 := 1, 2
+
+	old := &Backup{Items: []Item{
+		{Key: "id:keep", Name: "keep.mp3", Artist: "A", TrackNumber: &track1},
+		{Key: "id:gone", Name: "gone.mp3", Artist: "B"},
+		{Key: "id:edit", Name: "edit.mp3", Artist: "C", Year: 1999, TrackNumber: &track1},
+	}}
+	newB := &Backup{Items: []Item{
+		{Key: "id:keep", Name: "keep.mp3", Artist: "A", TrackNumber: &track1},
+		{Key: "id:edit", Name: "edit.mp3", Artist: "C.", Year: 2000, TrackNumber: &track2, Genre: &rock},
+		{Key: "id:new", Name: "new.mp3", Artist: "D"},
+	}}
+
+	d := Diff(old, newB)
+
+	require.Len(t, d.Added, 1)
+	assert.Equal(t, "id:new", d.Added[0].Key)
+
+	require.Len(t, d.Removed, 1)
+	assert.Equal(t, "id:gone", d.Removed[0].Key)
+
+	assert.Equal(t, []ItemChange{{
+		Key:  "id:edit",
+		Name: "edit.mp3",
+		Fields: []FieldChange{
+			{Field: "tag_artist", Old: "C", New: "C."},
+			{Field: "tag_genre", Old: "", New: "Rock"},
+			{Field: "tag_trackNumber", Old: "1", New: "2"},
+			{Field: "tag_year", Old: "1999", New: "2000"},
+		},
+	}}, d.Changed)
+	assert.False(t, d.Empty())
+}
+
+func TestDiff_Identical(t *testing.T) {
+	t.Parallel()
+
+	b := &Backup{Items: []Item{{Key: "id:1", Name: "a.mp3", Duration: Duration(12.3)}}}
+
+	assert.True(t, Diff(b, b).Empty())
+}
+
+func TestReadRoundtrip(t *testing.T) {
+	t.Parallel()
+
+	genre := "Jazz"
+	track := 4
+	b := &Backup{
+		Items:     []Item{{Key: "id:1", Name: "a.mp3", Genre: &genre, TrackNumber: &track, Duration: Duration(61.5)}},
+		Playlists: []Playlist{},
+	}
+
+	path := filepath.Join(t.TempDir(), "lib.cbbackup")
+	require.NoError(t, Write(path, b, WriteOptions{}))
+
+	got, err := Read(path)
+	require.NoError(t, err)
+	assert.Equal(t, b, got)
+}
@@ -2,7 +2,12 @@
 package backup
 
 import (
+	"fmt"
+	"math"
+	"path"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Backup represents the top-level structure of a .cbbackup file.
@@ -11,8 +16,13 @@ type Backup struct {
 	Playlists []Playlist `json:"playlists"`
 }
 
-// Playlist represents a CloudBeats playlist. We generate an empty slice.
-type Playlist struct{}
+// Playlist represents a CloudBeats playlist: a name and its tracks, in play
+// order, referenced by Item.Key. Playlists are only generated on request (see
+// BuildPlaylists); otherwise the slice is empty.
+type Playlist struct {
+	Name  string   `json:"name"`
+	Items []string `json:"items"`
+}
 
 // Item represents a single audio file entry in the backup.
 // JSON keys are alphabetically ordered to match the CloudBeats format.
@@ -31,13 +41,113 @@ type Item struct {
 	TagName     string   `json:"tag_name"`
 	TrackNumber *int     `json:"tag_trackNumber,omitempty"`
 	Year        int      `json:"tag_year"`
+
+	// TrackTotal and DiscTotal have no field in the CloudBeats format; they
+	// are only carried through to the iTunes export. 0 means absent.
+	TrackTotal int `json:"-"`
+	DiscTotal  int `json:"-"`
+	// The sort names likewise have no CloudBeats field. Empty means absent.
+	ArtistSort      string `json:"-"`
+	AlbumArtistSort string `json:"-"`
+	AlbumSort       string `json:"-"`
+	// Folder is the Dropbox folder holding the file, for folder playlists.
+	Folder string `json:"-"`
+	// Start and Stop bound a chapter item within its file (see SplitChapters).
+	// Like the totals, only the iTunes export can express them. Zero Stop means
+	// the whole file.
+	Start time.Duration `json:"-"`
+	Stop  time.Duration `json:"-"`
 }
 
-// Duration is a float64 that always serializes with one decimal place (e.g. 294.0).
+// RemotePath is the item's full Dropbox path: Path holds its folder, or for
+// items this tool builds (which leave Path empty), Folder does. It is just Name
+// for an item read back from a backup without a path.
+func (it Item) RemotePath() string {
+	return path.Join(it.Dir(), it.Name)
+}
+
+// Dir is the Dropbox folder holding the item, as far as it is known.
+func (it Item) Dir() string {
+	if it.Path != "" {
+		return it.Path
+	}
+	return it.Folder
+}
+
+// Duration is a float64 number of seconds that always serializes with a fixed
+// number of decimal places, one by default (e.g. 294.0); see SetDurationFormat.
 type Duration float64
 
-// MarshalJSON formats the duration with one decimal place.
+// DurationFormat is how Duration values are written.
+type DurationFormat struct {
+	// Decimals is the number of digits after the decimal point, from 0 (whole
+	// seconds) to 3 (milliseconds).
+	Decimals int
+	// Truncate drops the digits beyond Decimals instead of rounding.
+	Truncate bool
+}
+
+// DefaultDurationFormat rounds to one decimal place.
+var DefaultDurationFormat = DurationFormat{Decimals: 1}
+
+// durationFormat is the format used by Duration's String and MarshalJSON.
+var durationFormat = DefaultDurationFormat
+
+// SetDurationFormat changes how every Duration is written from now on. Call it
+// before building any output: it must not race with marshaling.
+func SetDurationFormat(f DurationFormat) {
+	durationFormat = f
+}
+
+// ParseDurationFormat parses a --duration-precision value: a number of decimal
+// places ("1"), optionally prefixed by "round:" or "truncate:".
+func ParseDurationFormat(s string) (DurationFormat, error) {
+	var f DurationFormat
+	mode, digits, ok := strings.Cut(s, ":")
+	if !ok {
+		mode, digits = "round", s
+	}
+	switch mode {
+	case "round":
+	case "truncate":
+		f.Truncate = true
+	default:
+		return DurationFormat{}, fmt.Errorf("unknown duration rounding %q (want round or truncate)", mode)
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 || n > 3 {
+		return DurationFormat{}, fmt.Errorf("invalid duration precision %q (want 0 to 3 decimal places)", digits)
+	}
+	f.Decimals = n
+	return f, nil
+}
+
+// Format formats d in seconds. Rounding is to the nearest value of the float,
+// as strconv does, so 294.95 (just below the half in binary) gives 294.9.
+// Truncation first takes d to the nearest millisecond, its precision in audio
+// tags, so that 294.9 does not become 294.8 for lack of an exact float64.
+func (f DurationFormat) Format(d Duration) string {
+	if !f.Truncate {
+		return strconv.FormatFloat(float64(d), 'f', f.Decimals, 64)
+	}
+	ms := int64(math.Round(float64(d) * 1000))
+	scale := int64(1)
+	for range f.Decimals {
+		scale *= 10
+	}
+	n := ms / (1000 / scale)
+	if f.Decimals == 0 {
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprintf("%d.%0*d", n/scale, f.Decimals, n%scale)
+}
+
+// String formats the duration in seconds with the current DurationFormat.
+func (d Duration) String() string {
+	return durationFormat.Format(d)
+}
+
+// MarshalJSON formats the duration with the current DurationFormat.
 func (d Duration) MarshalJSON() ([]byte, error) {
-	s := strconv.FormatFloat(float64(d), 'f', 1, 64)
-	return []byte(s), nil
+	return []byte(d.String()), nil
 }
@@ -30,3 +30,82 @@ func TestDuration_MarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestDurationFormat_Format(t *testing.T) {
+	t.Parallel()
+
+	round := func(n int) DurationFormat { return DurationFormat{Decimals: n} }
+	truncate := func(n int) DurationFormat { return DurationFormat{Decimals: n, Truncate: true} }
+	tests := []struct {
+		name   string
+		format DurationFormat
+		d      Duration
+		want   string
+	}{
+		// 294.95 is 294.94999... as a float64, so rounding does not go up
+		{"boundary rounds", round(1), 294.95, "294.9"},
+		{"boundary truncates", truncate(1), 294.95, "294.9"},
+		{"past the boundary rounds up", round(1), 294.951, "295.0"},
+		{"past the boundary truncates", truncate(1), 294.951, "294.9"},
+		{"above half rounds up", round(1), 294.96, "295.0"},
+		{"above half truncates", truncate(1), 294.96, "294.9"},
+		{"inexact float truncates to its millisecond", truncate(1), 294.9, "294.9"},
+		{"whole seconds round", round(0), 294.6, "295"},
+		{"whole seconds truncate", truncate(0), 294.999, "294"},
+		{"two decimals", round(2), 294.956, "294.96"},
+		{"milliseconds", truncate(3), 294.9554, "294.955"},
+		{"leading zero decimals", truncate(2), 1.009, "1.00"},
+		{"zero", round(1), 0, "0.0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, test.format.Format(test.d))
+		})
+	}
+}
+
+func TestParseDurationFormat(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    DurationFormat
+		wantErr bool
+	}{
+		{in: "1", want: DefaultDurationFormat},
+		{in: "0", want: DurationFormat{}},
+		{in: "round:3", want: DurationFormat{Decimals: 3}},
+		{in: "truncate:1", want: DurationFormat{Decimals: 1, Truncate: true}},
+		{in: "4", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "floor:1", wantErr: true},
+		{in: "truncate", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := ParseDurationFormat(test.in)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+// Not parallel: changes the package-level duration format.
+func TestSetDurationFormat(t *testing.T) {
+	t.Cleanup(func() { SetDurationFormat(DefaultDurationFormat) })
+
+	SetDurationFormat(DurationFormat{Decimals: 0, Truncate: true})
+	got, err := Duration(294.96).MarshalJSON()
+	require.NoError(t, err)
+	assert.Equal(t, "294", string(got))
+}
@@ -0,0 +1,139 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// ItemOptions controls how audio metadata is mapped onto backup items.
+type ItemOptions struct {
+	// UnknownAsEmpty leaves artist, album, and album artist blank instead of "Unknown".
+	UnknownAsEmpty bool
+	// PrimaryGenre keeps only the first genre of a multi-value genre ("Electronic; House" becomes "Electronic").
+	PrimaryGenre bool
+	// TitleTemplate, if set, replaces the filename ReadFile falls back to when a
+	// file has no title tag.
+	TitleTemplate *TitleTemplate
+	// ClassicalTitles titles tracks that have work and movement tags after
+	// them, as "Work: II. Movement", instead of using their title tag.
+	ClassicalTitles bool
+}
+
+// NewItem builds the backup item for a Dropbox file from its audio metadata.
+func NewItem(accountID string, entry dropbox.Entry, meta tags.AudioMeta, opts ItemOptions) Item {
+	item := Item{
+		AccountID:   accountID,
+		Key:         ItemKey(entry),
+		Name:        entry.Name,
+		Path:        "",
+		Service:     "dropbox",
+		Album:       meta.Album,
+		AlbumArtist: meta.AlbumArtist,
+		Artist:      meta.Artist,
+		DiskNumber:  meta.DiskNumber,
+		Duration:    Duration(meta.Duration.Seconds()),
+		TagName:     meta.Title,
+		Year:        meta.Year,
+		TrackTotal:  meta.TrackTotal,
+		DiscTotal:   meta.DiscTotal,
+		Folder:      folderOf(entry.PathDisplay),
+
+		ArtistSort:      meta.ArtistSort,
+		AlbumArtistSort: meta.AlbumArtistSort,
+		AlbumSort:       meta.AlbumSort,
+	}
+	if opts.TitleTemplate != nil && isFilenameTitle(meta.Title, entry.Name) {
+		item.TagName = opts.TitleTemplate.Render(entry.Name, item.Folder)
+	}
+	if title, ok := classicalTitle(meta); opts.ClassicalTitles && ok {
+		item.TagName = title
+	}
+	genre := meta.Genre
+	if opts.PrimaryGenre {
+		genre = tags.PrimaryGenre(genre)
+	}
+	if genre != "" {
+		item.Genre = &genre
+	}
+	if meta.TrackNumber >= 0 {
+		item.TrackNumber = &meta.TrackNumber
+	}
+
+	if opts.UnknownAsEmpty {
+		item.Artist = blankUnknown(item.Artist)
+		item.Album = blankUnknown(item.Album)
+		item.AlbumArtist = blankUnknown(item.AlbumArtist)
+	}
+
+	return item
+}
+
+// ItemKey is the Key of entry's item: its Dropbox ID, or for an entry without
+// one (hand-built listings, older test fixtures) a hash of its case-preserved
+// path. Hashing PathDisplay rather than PathLower keeps files that differ only
+// in case apart, as they are on case-sensitive file systems.
+func ItemKey(entry dropbox.Entry) string {
+	if entry.ID != "" || entry.PathDisplay == "" {
+		return entry.ID
+	}
+	sum := sha256.Sum256([]byte(entry.PathDisplay))
+	return "path:" + hex.EncodeToString(sum[:16])
+}
+
+// isFilenameTitle reports whether title is the filename fallback for name, i.e.
+// the file had no title tag.
+func isFilenameTitle(title, name string) bool {
+	return strings.EqualFold(title, strings.TrimSuffix(name, path.Ext(name)))
+}
+
+// romanPrefix matches a movement name that already starts with its number, as
+// in "II. Andante".
+var romanPrefix = regexp.MustCompile(`^[IVXLC]+\.\s`)
+
+// classicalTitle composes "Work: II. Movement" from meta's classical tags,
+// leaving out the number when it is absent or already in the movement name.
+// It reports false unless both the work and the movement are tagged.
+func classicalTitle(meta tags.AudioMeta) (string, bool) {
+	work, movement := strings.TrimSpace(meta.Work), strings.TrimSpace(meta.Movement)
+	if work == "" || movement == "" {
+		return "", false
+	}
+	if meta.MovementNumber > 0 && !romanPrefix.MatchString(movement) {
+		movement = roman(meta.MovementNumber) + ". " + movement
+	}
+	return work + ": " + movement, true
+}
+
+// roman writes n (1 to 399) in Roman numerals; larger numbers stay in digits,
+// as no work has that many movements.
+func roman(n int) string {
+	if n >= 400 {
+		return strconv.Itoa(n)
+	}
+	numerals := []struct {
+		value  int
+		symbol string
+	}{{100, "C"}, {90, "XC"}, {50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"}}
+	var b strings.Builder
+	for _, r := range numerals {
+		for n >= r.value {
+			b.WriteString(r.symbol)
+			n -= r.value
+		}
+	}
+	return b.String()
+}
+
+func blankUnknown(s string) string {
+	if s == tags.Unknown {
+		return ""
+	}
+	return s
+}
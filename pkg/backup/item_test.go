@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestNewItem_TaglessFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "untagged.mp3")
+	require.NoError(t, os.WriteFile(path, nil, 0o644))
+
+	meta, err := tags.ReadFile(path, tags.ReadOptions{})
+	require.NoError(t, err)
+
+	entry := dropbox.Entry{ID: "id:1", Name: "untagged.mp3"}
+
+	tests := []struct {
+		name       string
+		opts       ItemOptions
+		wantArtist string
+		wantAlbum  string
+	}{
+		{"default keeps Unknown", ItemOptions{}, "Unknown", "Unknown"},
+		{"unknown as empty", ItemOptions{UnknownAsEmpty: true}, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			item := NewItem("dbid:1", entry, meta, test.opts)
+
+			assert.Equal(t, "id:1", item.Key)
+			assert.Equal(t, "untagged", item.TagName)
+			assert.Equal(t, test.wantArtist, item.Artist)
+			assert.Equal(t, test.wantAlbum, item.Album)
+			assert.Equal(t, test.wantAlbum, item.AlbumArtist)
+			assert.Nil(t, item.TrackNumber)
+			assert.Nil(t, item.Genre)
+		})
+	}
+}
+
+func TestNewItem_PrimaryGenre(t *testing.T) {
+	t.Parallel()
+
+	meta := tags.AudioMeta{Title: "Track", Genre: "Electronic; House", TrackNumber: -1}
+	entry := dropbox.Entry{ID: "id:1", Name: "track.flac"}
+
+	full := NewItem("dbid:1", entry, meta, ItemOptions{})
+	require.NotNil(t, full.Genre)
+	assert.Equal(t, "Electronic; House", *full.Genre)
+
+	primary := NewItem("dbid:1", entry, meta, ItemOptions{PrimaryGenre: true})
+	require.NotNil(t, primary.Genre)
+	assert.Equal(t, "Electronic", *primary.Genre)
+}
+
+func TestNewItem_ClassicalTitles(t *testing.T) {
+	t.Parallel()
+
+	entry := dropbox.Entry{ID: "id:1", Name: "02 Andante.flac"}
+	tests := []struct {
+		name string
+		meta tags.AudioMeta
+		want string
+	}{
+		{
+			name: "work, number, and movement",
+			meta: tags.AudioMeta{Title: "Andante", Work: "Symphony No. 5", Movement: "Andante", MovementNumber: 2},
+			want: "Symphony No. 5: II. Andante",
+		},
+		{
+			name: "number already in the movement name",
+			meta: tags.AudioMeta{Title: "Andante", Work: "Symphony No. 5", Movement: "II. Andante", MovementNumber: 2},
+			want: "Symphony No. 5: II. Andante",
+		},
+		{
+			name: "no movement number",
+			meta: tags.AudioMeta{Title: "Aria", Work: "Goldberg Variations", Movement: "Aria"},
+			want: "Goldberg Variations: Aria",
+		},
+		{
+			name: "many movements",
+			meta: tags.AudioMeta{Title: "Var. 14", Work: "Goldberg Variations", Movement: "Variatio 14", MovementNumber: 15},
+			want: "Goldberg Variations: XV. Variatio 14",
+		},
+		{
+			name: "work without movement keeps the title",
+			meta: tags.AudioMeta{Title: "Lacrimosa", Work: "Requiem"},
+			want: "Lacrimosa",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			test.meta.TrackNumber = -1
+			assert.Equal(t, test.want, NewItem("dbid:1", entry, test.meta, ItemOptions{ClassicalTitles: true}).TagName)
+			assert.Equal(t, test.meta.Title, NewItem("dbid:1", entry, test.meta, ItemOptions{}).TagName, "off by default")
+		})
+	}
+}
+
+func TestItemKey(t *testing.T) {
+	t.Parallel()
+
+	withID := dropbox.Entry{ID: "id:abc", PathDisplay: "/Music/Song.mp3"}
+	upper := dropbox.Entry{Name: "Song.mp3", PathLower: "/music/song.mp3", PathDisplay: "/Music/Song.mp3"}
+	lower := dropbox.Entry{Name: "song.mp3", PathLower: "/music/song.mp3", PathDisplay: "/Music/song.mp3"}
+
+	assert.Equal(t, "id:abc", ItemKey(withID), "the Dropbox ID wins")
+	assert.NotEqual(t, ItemKey(upper), ItemKey(lower), "case variants get distinct keys")
+	assert.Equal(t, ItemKey(upper), ItemKey(upper), "keys are stable")
+	assert.Regexp(t, `^path:[0-9a-f]{32}$`, ItemKey(upper))
+	assert.Empty(t, ItemKey(dropbox.Entry{}))
+
+	items := []Item{
+		NewItem("dbid:1", upper, tags.AudioMeta{TrackNumber: -1}, ItemOptions{}),
+		NewItem("dbid:1", lower, tags.AudioMeta{TrackNumber: -1}, ItemOptions{}),
+	}
+	assert.Len(t, Dedup(items), 2, "ID-less case variants are not collapsed as duplicates")
+}
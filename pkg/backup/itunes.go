@@ -0,0 +1,115 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const plistHeader = xml.Header +
+	`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n"
+
+// WriteITunesXML writes items to w as an iTunes Library XML plist.
+// Each item becomes an entry in the top-level "Tracks" dict, keyed by its 1-based track ID.
+func WriteITunesXML(w io.Writer, items []Item) error {
+	pw := &plistWriter{w: bufio.NewWriter(w)}
+
+	pw.raw(plistHeader)
+	pw.raw("<plist version=\"1.0\">\n<dict>\n")
+	pw.integer("Major Version", 1)
+	pw.integer("Minor Version", 1)
+	pw.key("Tracks")
+	pw.raw("<dict>\n")
+
+	for i, it := range items {
+		id := i + 1
+		pw.key(strconv.Itoa(id))
+		pw.raw("<dict>\n")
+		pw.integer("Track ID", id)
+		pw.str("Name", it.TagName)
+		pw.str("Artist", it.Artist)
+		pw.str("Album Artist", it.AlbumArtist)
+		pw.str("Album", it.Album)
+		if it.ArtistSort != "" {
+			pw.str("Sort Artist", it.ArtistSort)
+		}
+		if it.AlbumArtistSort != "" {
+			pw.str("Sort Album Artist", it.AlbumArtistSort)
+		}
+		if it.AlbumSort != "" {
+			pw.str("Sort Album", it.AlbumSort)
+		}
+		if it.Genre != nil {
+			pw.str("Genre", *it.Genre)
+		}
+		pw.integer("Total Time", int(float64(it.Duration)*1000))
+		if it.Stop > 0 {
+			pw.integer("Start Time", int(it.Start.Milliseconds()))
+			pw.integer("Stop Time", int(it.Stop.Milliseconds()))
+		}
+		pw.integer("Disc Number", it.DiskNumber)
+		if it.DiscTotal > 0 {
+			pw.integer("Disc Count", it.DiscTotal)
+		}
+		if it.TrackNumber != nil {
+			pw.integer("Track Number", *it.TrackNumber)
+		}
+		if it.TrackTotal > 0 {
+			pw.integer("Track Count", it.TrackTotal)
+		}
+		if it.Year > 0 {
+			pw.integer("Year", it.Year)
+		}
+		pw.raw("</dict>\n")
+	}
+
+	pw.raw("</dict>\n</dict>\n</plist>\n")
+
+	if pw.err != nil {
+		return fmt.Errorf("writing iTunes XML: %w", pw.err)
+	}
+	if err := pw.w.Flush(); err != nil {
+		return fmt.Errorf("flushing iTunes XML: %w", err)
+	}
+	return nil
+}
+
+// plistWriter emits plist elements, remembering the first write error.
+type plistWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (pw *plistWriter) raw(s string) {
+	if pw.err != nil {
+		return
+	}
+	_, pw.err = pw.w.WriteString(s)
+}
+
+func (pw *plistWriter) escaped(s string) {
+	if pw.err != nil {
+		return
+	}
+	pw.err = xml.EscapeText(pw.w, []byte(s))
+}
+
+func (pw *plistWriter) key(k string) {
+	pw.raw("<key>")
+	pw.escaped(k)
+	pw.raw("</key>")
+}
+
+func (pw *plistWriter) str(k, v string) {
+	pw.key(k)
+	pw.raw("<string>")
+	pw.escaped(v)
+	pw.raw("</string>\n")
+}
+
+func (pw *plistWriter) integer(k string, v int) {
+	pw.key(k)
+	pw.raw("<integer>" + strconv.Itoa(v) + "</integer>\n")
+}
@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteITunesXML(t *testing.T) {
+	t.Parallel()
+
+	genre := "Rock & Roll"
+	track := 7
+	items := []Item{
+		{
+			TagName:     "Song <Live>",
+			Artist:      "Artist",
+			AlbumArtist: "Artist",
+			Album:       "Album",
+			Genre:       &genre,
+			TrackNumber: &track,
+			DiskNumber:  1,
+			TrackTotal:  12,
+			ArtistSort:  "Artist, The",
+			Year:        2001,
+			Duration:    Duration(294.5),
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteITunesXML(&buf, items))
+
+	// The whole document must be well-formed XML.
+	var keys []string
+	dec := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	inKey := false
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			inKey = tok.Name.Local == "key"
+		case xml.CharData:
+			if inKey {
+				keys = append(keys, string(tok))
+			}
+		case xml.EndElement:
+			inKey = false
+		}
+	}
+
+	for _, k := range []string{"Tracks", "Track ID", "Name", "Artist", "Album", "Genre", "Total Time", "Track Number", "Year"} {
+		assert.Contains(t, keys, k)
+	}
+
+	out := buf.String()
+	assert.Contains(t, out, "<string>Song &lt;Live&gt;</string>")
+	assert.Contains(t, out, "<string>Rock &amp; Roll</string>")
+	assert.Contains(t, out, "<key>Total Time</key><integer>294500</integer>")
+	assert.Contains(t, out, "<key>Track Number</key><integer>7</integer>")
+	assert.Contains(t, out, "<key>Track Count</key><integer>12</integer>")
+	assert.Contains(t, out, "<key>Year</key><integer>2001</integer>")
+	assert.NotContains(t, out, "Disc Count", "absent totals are omitted")
+	assert.Contains(t, out, "<key>Sort Artist</key><string>Artist, The</string>")
+	assert.NotContains(t, out, "Sort Album", "absent sort names are omitted")
+}
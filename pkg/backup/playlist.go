@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// GroupBy selects the field BuildPlaylists groups items by.
+type GroupBy string
+
+// Supported groupings.
+const (
+	// GroupByNone generates no playlists.
+	GroupByNone GroupBy = ""
+	// GroupByAlbum makes one playlist per album name and album artist.
+	GroupByAlbum GroupBy = "album"
+	// GroupByArtist makes one playlist per track artist.
+	GroupByArtist GroupBy = "artist"
+	// GroupByGenre makes one playlist per primary genre.
+	GroupByGenre GroupBy = "genre"
+	// GroupByFolder makes one playlist per Dropbox folder.
+	GroupByFolder GroupBy = "folder"
+)
+
+// ParseGroupBy validates s as a GroupBy. The empty string means no playlists.
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch g := GroupBy(s); g {
+	case GroupByNone, GroupByAlbum, GroupByArtist, GroupByGenre, GroupByFolder:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unknown grouping %q (want album, artist, genre, or folder)", s)
+	}
+}
+
+// groupKey returns the value it is grouped under, or "" when the field is
+// untagged. Albums are told apart by album artist too, which qualifier returns
+// ("" when untagged), so two artists' "Greatest Hits" are separate playlists.
+func (by GroupBy) groupKey(it Item) (key, qualifier string) {
+	var v string
+	switch by {
+	case GroupByAlbum:
+		v = it.Album
+		if !isMissing(it.AlbumArtist) {
+			qualifier = it.AlbumArtist
+		}
+	case GroupByArtist:
+		v = it.Artist
+	case GroupByGenre:
+		if it.Genre != nil {
+			v = tags.PrimaryGenre(*it.Genre)
+		}
+	case GroupByFolder:
+		v = strings.TrimPrefix(it.Folder, "/")
+	}
+	if v == tags.Unknown || v == "" {
+		return "", ""
+	}
+	return v, qualifier
+}
+
+// BuildPlaylists returns one playlist per distinct value of the by field, named
+// after it and sorted by name, with untagged items collected in a final
+// "Unknown" playlist. Albums are grouped by album artist as well; when several
+// share a title, their album artist is added to the name, as in
+// "Greatest Hits (Queen)". Within a playlist, items are in album order (see
+// newPlaylist). GroupByNone returns no playlists.
+func BuildPlaylists(items []Item, by GroupBy) []Playlist {
+	playlists := []Playlist{}
+	if by == GroupByNone {
+		return playlists
+	}
+
+	type group struct{ key, qualifier string }
+	groups := make(map[group][]Item)
+	qualifiers := make(map[string]int)
+	for _, it := range items {
+		key, qualifier := by.groupKey(it)
+		g := group{key, qualifier}
+		if _, ok := groups[g]; !ok {
+			qualifiers[key]++
+		}
+		groups[g] = append(groups[g], it)
+	}
+
+	named := make(map[string][]Item, len(groups))
+	names := make([]string, 0, len(groups))
+	for g, members := range groups {
+		if g.key == "" {
+			continue
+		}
+		name := g.key
+		if qualifiers[g.key] > 1 && g.qualifier != "" {
+			name += " (" + g.qualifier + ")"
+		}
+		if _, ok := named[name]; !ok {
+			names = append(names, name)
+		}
+		named[name] = append(named[name], members...)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := strings.ToLower(names[i]), strings.ToLower(names[j])
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		playlists = append(playlists, newPlaylist(name, named[name]))
+	}
+	if unknown := groups[group{}]; len(unknown) > 0 {
+		playlists = append(playlists, newPlaylist(tags.Unknown, unknown))
+	}
+	return playlists
+}
+
+// newPlaylist orders members for playback, by disc, then track number (untracked
+// last), then title, with the file name as a final tie-break so the order never
+// depends on discovery order, and records their keys.
+func newPlaylist(name string, members []Item) Playlist {
+	sort.SliceStable(members, func(i, j int) bool {
+		a, b := members[i], members[j]
+		if a.DiskNumber != b.DiskNumber {
+			return a.DiskNumber < b.DiskNumber
+		}
+		if at, bt := trackOrder(a), trackOrder(b); at != bt {
+			return at < bt
+		}
+		if a.TagName != b.TagName {
+			return a.TagName < b.TagName
+		}
+		return a.Name < b.Name
+	})
+
+	keys := make([]string, len(members))
+	for i, it := range members {
+		keys[i] = it.Key
+	}
+	return Playlist{Name: name, Items: keys}
+}
+
+// trackOrder sorts untracked items after every numbered track.
+func trackOrder(it Item) int {
+	if it.TrackNumber == nil {
+		return int(^uint(0) >> 1)
+	}
+	return *it.TrackNumber
+}
+
+// folderOf returns the Dropbox folder containing p, or "" if p is unknown.
+func folderOf(p string) string {
+	if p == "" {
+		return ""
+	}
+	return path.Dir(p)
+}
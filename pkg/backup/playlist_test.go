@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func playlistItem(key, name, album, genre string, disc int, track *int) Item {
+	it := Item{Key: key, Name: name, Album: album, Artist: "Artist", DiskNumber: disc, TrackNumber: track}
+	if genre != "" {
+		it.Genre = &genre
+	}
+	return it
+}
+
+func intPtr(n int) *int { return &n }
+
+func TestBuildPlaylists_ByAlbum(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		playlistItem("d2t1", "2-01.flac", "Double", "Rock", 2, intPtr(1)),
+		playlistItem("single", "single.mp3", "beta", "Pop", 1, intPtr(1)),
+		playlistItem("d1t2", "1-02.flac", "Double", "Rock", 1, intPtr(2)),
+		playlistItem("untracked", "bonus.flac", "Double", "Rock", 2, nil),
+		playlistItem("d1t1", "1-01.flac", "Double", "Rock", 1, intPtr(1)),
+		playlistItem("loose", "loose.mp3", tags.Unknown, "", 1, nil),
+		playlistItem("blank", "blank.mp3", "", "", 1, nil),
+	}
+
+	got := BuildPlaylists(items, GroupByAlbum)
+	assert.Equal(t, []Playlist{
+		{Name: "beta", Items: []string{"single"}},
+		{Name: "Double", Items: []string{"d1t1", "d1t2", "d2t1", "untracked"}},
+		{Name: tags.Unknown, Items: []string{"blank", "loose"}},
+	}, got)
+}
+
+func TestBuildPlaylists_SameAlbumTitle(t *testing.T) {
+	t.Parallel()
+
+	album := func(key, albumArtist string, n int) Item {
+		it := playlistItem(key, key+".mp3", "Greatest Hits", "", 1, intPtr(n))
+		it.AlbumArtist = albumArtist
+		return it
+	}
+	items := []Item{
+		album("q2", "Queen", 2),
+		album("a1", "ABBA", 1),
+		album("q1", "Queen", 1),
+		album("u1", tags.Unknown, 1),
+		playlistItem("o1", "o1.mp3", "Other", "", 1, intPtr(1)),
+	}
+
+	assert.Equal(t, []Playlist{
+		{Name: "Greatest Hits", Items: []string{"u1"}},
+		{Name: "Greatest Hits (ABBA)", Items: []string{"a1"}},
+		{Name: "Greatest Hits (Queen)", Items: []string{"q1", "q2"}},
+		{Name: "Other", Items: []string{"o1"}},
+	}, BuildPlaylists(items, GroupByAlbum))
+}
+
+func TestBuildPlaylists_TwoDiscAlbumOrder(t *testing.T) {
+	t.Parallel()
+
+	track := func(key, title string, disc int, n *int) Item {
+		it := playlistItem(key, key+".flac", "Live", "", disc, n)
+		it.TagName = title
+		return it
+	}
+	// Discovery order as a filesystem walk might return it.
+	items := []Item{
+		track("d2-untracked-b", "Encore B", 2, nil),
+		track("d2t2", "Closer", 2, intPtr(2)),
+		track("d1t10", "Tenth", 1, intPtr(10)),
+		track("d2t1", "Opener 2", 2, intPtr(1)),
+		track("d1t2", "Second", 1, intPtr(2)),
+		track("d2-untracked-a", "Encore A", 2, nil),
+		track("d1t1", "First", 1, intPtr(1)),
+		track("d1t2-dup", "Another Second", 1, intPtr(2)),
+	}
+
+	got := BuildPlaylists(items, GroupByAlbum)
+	require.Len(t, got, 1)
+	assert.Equal(t, []string{
+		"d1t1", "d1t2-dup", "d1t2", "d1t10",
+		"d2t1", "d2t2", "d2-untracked-a", "d2-untracked-b",
+	}, got[0].Items)
+}
+
+func TestBuildPlaylists_ByGenre(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		playlistItem("b2", "b2.flac", "B", "House", 2, intPtr(1)),
+		playlistItem("a1", "a1.flac", "A", "Electronic; House", 1, intPtr(3)),
+		playlistItem("b1", "b1.flac", "B", "House", 1, intPtr(9)),
+		playlistItem("a2", "a2.flac", "A", "Electronic", 1, intPtr(1)),
+	}
+
+	got := BuildPlaylists(items, GroupByGenre)
+	require.Len(t, got, 2)
+	assert.Equal(t, Playlist{Name: "Electronic", Items: []string{"a2", "a1"}}, got[0])
+	assert.Equal(t, Playlist{Name: "House", Items: []string{"b1", "b2"}}, got[1])
+
+	// Grouping must not reorder the caller's items.
+	assert.Equal(t, "b2", items[0].Key)
+}
+
+func TestBuildPlaylists_ByFolderAndNone(t *testing.T) {
+	t.Parallel()
+
+	items := []Item{
+		{Key: "2", Name: "02.mp3", Folder: "/Music/Album", TrackNumber: intPtr(2)},
+		{Key: "1", Name: "01.mp3", Folder: "/Music/Album", TrackNumber: intPtr(1)},
+		{Key: "x", Name: "x.mp3"},
+	}
+
+	assert.Equal(t, []Playlist{
+		{Name: "Music/Album", Items: []string{"1", "2"}},
+		{Name: tags.Unknown, Items: []string{"x"}},
+	}, BuildPlaylists(items, GroupByFolder))
+
+	none := BuildPlaylists(items, GroupByNone)
+	assert.NotNil(t, none, "an empty slice keeps the JSON playlists key an array")
+	assert.Empty(t, none)
+}
+
+func TestParseGroupBy(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []string{"", "album", "artist", "genre", "folder"} {
+		g, err := ParseGroupBy(s)
+		require.NoError(t, err)
+		assert.Equal(t, GroupBy(s), g)
+	}
+	_, err := ParseGroupBy("year")
+	assert.ErrorContains(t, err, "unknown grouping")
+}
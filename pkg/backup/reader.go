@@ -0,0 +1,21 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Read parses the .cbbackup file at path.
+func Read(path string) (*Backup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading backup file: %w", err)
+	}
+
+	var b Backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parsing backup file: %w", err)
+	}
+	return &b, nil
+}
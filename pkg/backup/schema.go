@@ -0,0 +1,61 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema encodes a Backup for one revision of the CloudBeats import format.
+// Revisions differ in how items are laid out (field names, value formatting),
+// so each one owns its marshaling instead of sharing a single struct.
+type Schema interface {
+	// Version names the revision, as accepted by ParseSchema.
+	Version() string
+	// Marshal encodes b as a .cbbackup document.
+	Marshal(b *Backup) ([]byte, error)
+}
+
+// LatestVersion is the ParseSchema alias for the newest supported revision.
+const LatestVersion = "latest"
+
+// schemaV1 is the layout current CloudBeats releases import: the Backup and Item
+// structs as tagged, with durations in seconds written in the configured
+// DurationFormat (one decimal place by default; see SetDurationFormat).
+type schemaV1 struct{}
+
+func (schemaV1) Version() string { return "1" }
+
+func (schemaV1) Marshal(b *Backup) ([]byte, error) {
+	return json.Marshal(b)
+}
+
+// schemas lists the supported revisions by version.
+var schemas = map[string]Schema{
+	"1": schemaV1{},
+}
+
+// Latest is the schema used unless another revision is requested.
+var Latest Schema = schemaV1{}
+
+// ParseSchema returns the schema for version, or Latest for "" and "latest".
+func ParseSchema(version string) (Schema, error) {
+	if version == "" || version == LatestVersion {
+		return Latest, nil
+	}
+	if s, ok := schemas[version]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown CloudBeats schema version %q (want %s)", version, strings.Join(SchemaVersions(), ", "))
+}
+
+// SchemaVersions returns the supported versions, sorted, followed by the latest alias.
+func SchemaVersions() []string {
+	versions := make([]string, 0, len(schemas)+1)
+	for v := range schemas {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+	return append(versions, LatestVersion)
+}
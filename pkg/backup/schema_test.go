@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenBackup exercises every field a schema revision has to lay out.
+func goldenBackup() *Backup {
+	genre := "Jazz"
+	track := 3
+	return &Backup{
+		Items: []Item{
+			{
+				AccountID: "dbid:golden", Key: "id:AAAA", Name: "03 So What.flac", Service: "dropbox",
+				Album: "Kind of Blue", AlbumArtist: "Miles Davis", Artist: "Miles Davis",
+				DiskNumber: 1, Duration: Duration(562), Genre: &genre, TagName: "So What",
+				TrackNumber: &track, Year: 1959,
+				// Fields outside the CloudBeats format must not leak into it.
+				TrackTotal: 5, DiscTotal: 1, Folder: "/Music/Kind of Blue", Stop: time.Minute,
+			},
+			{
+				AccountID: "dbid:golden", Key: "id:BBBB", Name: "untagged.mp3", Service: "dropbox",
+				Album: "Unknown", AlbumArtist: "Unknown", Artist: "Unknown",
+				DiskNumber: 1, Duration: Duration(61.25), TagName: "untagged",
+			},
+		},
+		Playlists: []Playlist{{Name: "Kind of Blue", Items: []string{"id:AAAA"}}},
+	}
+}
+
+func TestSchemaGolden(t *testing.T) {
+	t.Parallel()
+
+	for _, version := range SchemaVersions() {
+		if version == LatestVersion {
+			continue
+		}
+		t.Run("v"+version, func(t *testing.T) {
+			t.Parallel()
+
+			schema, err := ParseSchema(version)
+			require.NoError(t, err)
+			assert.Equal(t, version, schema.Version())
+
+			got, err := schema.Marshal(goldenBackup())
+			require.NoError(t, err)
+
+			golden := filepath.Join("testdata", "schema-v"+version+".cbbackup")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, got, 0o644))
+			}
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err, "run go test ./pkg/backup -update to create it")
+			assert.Equal(t, string(want), string(got))
+		})
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	t.Parallel()
+
+	for _, v := range []string{"", LatestVersion} {
+		s, err := ParseSchema(v)
+		require.NoError(t, err)
+		assert.Equal(t, Latest, s)
+	}
+
+	_, err := ParseSchema("0")
+	assert.ErrorContains(t, err, "want 1, latest")
+}
+
+func TestWrite_DefaultsToLatestSchema(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "out.cbbackup")
+	require.NoError(t, Write(path, goldenBackup(), WriteOptions{}))
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	want, err := Latest.Marshal(goldenBackup())
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
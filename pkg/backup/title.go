@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+// TitleData is what a TitleTemplate can refer to.
+type TitleData struct {
+	// Filename is the file name without its extension: "01 - Song Name".
+	Filename string
+	// Stripped is Filename without a leading track or disc-track number: "Song Name".
+	Stripped string
+	// Folder is the name of the folder holding the file.
+	Folder string
+}
+
+// TitleTemplate renders the title of files that have no title tag, in place of
+// the bare filename, e.g. "{{.Stripped}}" or "{{.Folder}} - {{.Stripped}}".
+type TitleTemplate struct {
+	tmpl *template.Template
+}
+
+// ParseTitleTemplate parses text as a text/template over TitleData. References
+// to fields TitleData does not have are reported here rather than per file.
+func ParseTitleTemplate(text string) (*TitleTemplate, error) {
+	tmpl, err := template.New("title").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing title template: %w", err)
+	}
+	t := &TitleTemplate{tmpl: tmpl}
+	if _, err := t.execute(TitleData{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Render returns the title for the file name in the Dropbox folder dir. It
+// falls back to the filename if the template fails or renders only whitespace.
+func (t *TitleTemplate) Render(name, dir string) string {
+	data := titleData(name, dir)
+	title, err := t.execute(data)
+	if err != nil || strings.TrimSpace(title) == "" {
+		return data.Filename
+	}
+	return title
+}
+
+func (t *TitleTemplate) execute(data TitleData) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("executing title template: %w", err)
+	}
+	return b.String(), nil
+}
+
+func titleData(name, dir string) TitleData {
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	folder := path.Base(dir)
+	if folder == "/" || folder == "." {
+		folder = ""
+	}
+	return TitleData{Filename: stem, Stripped: tags.StripTrackPrefix(stem), Folder: folder}
+}
@@ -0,0 +1,73 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+)
+
+func TestParseTitleTemplate_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, text := range []string{"{{.Stripped", "{{.Artist}}"} {
+		_, err := ParseTitleTemplate(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestTitleTemplate_Render(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		template string
+		name     string
+		dir      string
+		want     string
+	}{
+		{"{{.Stripped}}", "01 - Song Name.mp3", "/Music/Album", "Song Name"},
+		{"{{.Stripped}}", "01. Song Name.flac", "/Music/Album", "Song Name"},
+		{"{{.Stripped}}", "1-01 Song Name.m4a", "/Music/Album", "Song Name"},
+		{"{{.Stripped}}", "Song Name.mp3", "/Music/Album", "Song Name"},
+		{"{{.Folder}} - {{.Stripped}}", "03 Intro.mp3", "/Music/Live 1999", "Live 1999 - Intro"},
+		{"{{.Folder}}", "03 Intro.mp3", "/", "03 Intro"},
+		{"{{.Filename}}", "03 Intro.mp3", "/Music", "03 Intro"},
+	}
+	for _, test := range tests {
+		t.Run(test.template+" "+test.name, func(t *testing.T) {
+			t.Parallel()
+			tmpl, err := ParseTitleTemplate(test.template)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, tmpl.Render(test.name, test.dir))
+		})
+	}
+}
+
+func TestNewItem_TitleTemplate(t *testing.T) {
+	t.Parallel()
+
+	tmpl, err := ParseTitleTemplate("{{.Stripped}}")
+	require.NoError(t, err)
+	entry := dropbox.Entry{ID: "id:1", Name: "01 - Song Name.mp3", PathDisplay: "/Music/Album/01 - Song Name.mp3"}
+
+	tests := []struct {
+		name  string
+		title string
+		opts  ItemOptions
+		want  string
+	}{
+		{"no template keeps filename", "01 - Song Name", ItemOptions{}, "01 - Song Name"},
+		{"filename fallback", "01 - Song Name", ItemOptions{TitleTemplate: tmpl}, "Song Name"},
+		{"title tag kept", "Real Title", ItemOptions{TitleTemplate: tmpl}, "Real Title"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			item := NewItem("dbid:1", entry, tags.AudioMeta{Title: test.title, TrackNumber: -1}, test.opts)
+			assert.Equal(t, test.want, item.TagName)
+		})
+	}
+}
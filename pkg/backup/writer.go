@@ -1,18 +1,68 @@
 package backup
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 )
 
+// WriteOptions controls how Write persists the backup file.
+type WriteOptions struct {
+	// Sync flushes the file to stable storage before Write returns, so the backup
+	// survives an immediate unmount or power loss. It costs a disk flush per write.
+	Sync bool
+	// Schema selects the CloudBeats format revision to write. Nil means Latest.
+	Schema Schema
+}
+
+// CheckWritable reports whether a file can be written at path, by creating and
+// removing a temporary file next to it. It is meant to run before any costly
+// work whose result would otherwise be lost to a bad output path.
+func CheckWritable(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return fmt.Errorf("output path %s is a directory", path)
+	}
+
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, ".cbbackup-probe-*")
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("output directory %s does not exist", dir)
+	}
+	if err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", dir, err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
 // Write serializes the backup as minified JSON and writes it to the given path.
-func Write(path string, b *Backup) error {
-	data, err := json.Marshal(b)
+func Write(path string, b *Backup, opts WriteOptions) error {
+	schema := opts.Schema
+	if schema == nil {
+		schema = Latest
+	}
+	data, err := schema.Marshal(b)
 	if err != nil {
 		return fmt.Errorf("marshaling backup: %w", err)
 	}
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("writing backup file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("writing backup file: %w", err)
+	}
+	if opts.Sync {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("syncing backup file: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
 		return fmt.Errorf("writing backup file: %w", err)
 	}
 	return nil
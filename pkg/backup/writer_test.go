@@ -0,0 +1,98 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		opts WriteOptions
+	}{
+		{"buffered", WriteOptions{}},
+		{"synced", WriteOptions{Sync: true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "out.cbbackup")
+			want := &Backup{
+				Items:     []Item{{Key: "id:1", Name: "song.mp3"}},
+				Playlists: []Playlist{},
+			}
+
+			require.NoError(t, Write(path, want, test.opts))
+
+			got, err := Read(path)
+			require.NoError(t, err)
+			require.Len(t, got.Items, 1)
+			assert.Equal(t, "id:1", got.Items[0].Key)
+		})
+	}
+}
+
+func TestCheckWritable(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T) string // returns the output path
+		wantErr string
+	}{
+		{
+			name:  "writable directory",
+			setup: func(t *testing.T) string { return filepath.Join(t.TempDir(), "out.cbbackup") },
+		},
+		{
+			name:    "missing directory",
+			setup:   func(t *testing.T) string { return filepath.Join(t.TempDir(), "missing", "out.cbbackup") },
+			wantErr: "does not exist",
+		},
+		{
+			name: "read-only directory",
+			setup: func(t *testing.T) string {
+				dir := filepath.Join(t.TempDir(), "ro")
+				require.NoError(t, os.Mkdir(dir, 0o555))
+				t.Cleanup(func() { _ = os.Chmod(dir, 0o755) })
+				if f, err := os.CreateTemp(dir, "probe"); err == nil {
+					_ = f.Close()
+					t.Skip("directory permissions are not enforced for this user (e.g. root)")
+				}
+				return filepath.Join(dir, "out.cbbackup")
+			},
+			wantErr: "is not writable",
+		},
+		{
+			name:    "path is a directory",
+			setup:   func(t *testing.T) string { return t.TempDir() },
+			wantErr: "is a directory",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := test.setup(t)
+			err := CheckWritable(path)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			entries, err := os.ReadDir(filepath.Dir(path))
+			require.NoError(t, err)
+			assert.Empty(t, entries, "the probe file is removed")
+		})
+	}
+}
@@ -3,11 +3,20 @@ package cache
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog"
 
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/clock"
 	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
 )
 
@@ -17,27 +26,175 @@ type fileKey struct {
 }
 
 type entry struct {
-	Key  fileKey        `json:"key"`
-	Meta tags.AudioMeta `json:"meta"`
+	Key      fileKey        `json:"key"`
+	Meta     tags.AudioMeta `json:"meta"`
+	Schema   int            `json:"schema,omitempty"`    // metaSchema when Meta was read
+	LastUsed int64          `json:"last_used,omitempty"` // UnixNano of the last Store or Lookup hit
+	Lyrics   bool           `json:"lyrics,omitempty"`    // Meta was read with lyrics extraction
+}
+
+// metaSchema versions the tags.AudioMeta fields read from the files. Bump it
+// when a field is added, so that entries read without it miss and the files
+// are parsed again:
+//
+//	1: track and disc totals
+//	2: artist, album artist, and album sort names
+//	3: encoder delay and padding
+//	4: field sources
+//	5: work, movement, and grouping
+const metaSchema = 5
+
+// EvictionPolicy bounds the cache size. Zero fields disable the corresponding limit.
+type EvictionPolicy struct {
+	// MaxEntries keeps at most this many entries, dropping the least recently used.
+	MaxEntries int
+	// MaxAge drops entries not used for longer than this.
+	MaxAge time.Duration
+}
+
+// lastUsedResolution is how stale LastUsed must be before a hit updates it.
+// Eviction works in days, and updating it on every hit would rewrite the
+// whole cache file after a run where nothing changed.
+const lastUsedResolution = 24 * time.Hour
+
+// relativeVersion marks a cache file saved with keys relative to a single
+// root, which Load still reads; rootsVersion marks one saved with keys
+// relative to each library root it has seen.
+const (
+	relativeVersion = 2
+	rootsVersion    = 3
+)
+
+// cacheFile is the layout of a cache saved by SetRelativeRoot. Other caches are
+// a bare map of absolute path to entry, which Load also reads.
+type cacheFile struct {
+	Version int `json:"version"`
+	// Root is the root Entries are relative to (relativeVersion only).
+	Root string `json:"root,omitempty"`
+	// Roots holds the entries under each root, keyed relative to it
+	// (rootsVersion only).
+	Roots map[string]map[string]entry `json:"roots,omitempty"`
+	// Entries holds the files outside every root, by absolute path, and with
+	// relativeVersion also those under Root, relative to it.
+	Entries map[string]entry `json:"entries"`
 }
 
 // TagCache caches audio metadata keyed by file path and validated by size+mtime.
 type TagCache struct {
 	path    string
+	mu      sync.Mutex
 	entries map[string]entry // key = absolute file path
 	dirty   bool
+	noSave  bool // no writable location was found; Save is a no-op
+	policy  EvictionPolicy
+	lyrics  bool
+	clock   clock.Clock
 	logger  zerolog.Logger
+	// root is the library root set by SetRelativeRoot, if any.
+	root string
+	// roots are the library roots keys are saved relative to: root and those
+	// of the libraries the cache file was saved with before.
+	roots map[string]bool
+	// writeData, if set, replaces (*os.File).Write when saving, so tests can
+	// simulate a write failing part-way (e.g. disk full).
+	writeData func(f *os.File, b []byte) (int, error)
+	// warnedMTime is set once an implausible modification time has been reported.
+	warnedMTime bool
+}
+
+// mtimeFutureSlack is how far ahead of the clock a modification time may be
+// before it is treated as skewed rather than a timezone or sync artifact.
+const mtimeFutureSlack = 24 * time.Hour
+
+// appDir names the tool's directory inside the user cache and temp directories.
+const appDir = "cloudbeats-backup-generator"
+
+// DefaultPath returns the standard location of the tag cache file.
+func DefaultPath() string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, appDir, "cache.json")
+	}
+	return filepath.Join(fallbackDir(os.TempDir()), "cache.json")
+}
+
+// Dirs returns every directory the cache may write to: the default location's
+// directory and the temp-dir fallback used when it is not writable.
+func Dirs() []string {
+	dirs := []string{filepath.Dir(DefaultPath())}
+	if fallback := fallbackDir(os.TempDir()); fallback != dirs[0] {
+		dirs = append(dirs, fallback)
+	}
+	return dirs
+}
+
+// fallbackDir is the current user's directory for the cache in the temp
+// directory tmp, which other users share. On Unix it is named after the user ID.
+func fallbackDir(tmp string) string {
+	name := appDir
+	if uid := os.Getuid(); uid >= 0 {
+		name += "-" + strconv.Itoa(uid)
+	}
+	return filepath.Join(tmp, name)
+}
+
+// privateDir creates dir, readable by the current user only, or checks that an
+// existing one is theirs alone (see checkPrivate), so that another user of the
+// machine can neither plant cache entries nor read the library listing.
+func privateDir(dir string) error {
+	if err := os.Mkdir(dir, 0o700); err != nil && !os.IsExist(err) {
+		return err
+	}
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return checkPrivate(dir, info)
 }
 
 // Load reads the cache from path. Returns an empty cache on any error.
+// If path's directory is not writable, the cache is saved to a fallback file in
+// a private per-user directory of the temp directory instead (and read from
+// there if it exists), or not saved at all if that fails too, so the run does
+// not lose its work at Save time.
 func Load(path string, logger zerolog.Logger) *TagCache {
+	return load(path, os.TempDir(), logger)
+}
+
+// load is Load with the fallback cache kept under tmp instead of the system
+// temp directory.
+func load(path, tmp string, logger zerolog.Logger) *TagCache {
 	tc := &TagCache{
 		path:    path,
 		entries: make(map[string]entry),
+		clock:   clock.Real{},
 		logger:  logger,
 	}
 
-	data, err := os.ReadFile(path)
+	readPath := path
+	if err := probeWritable(filepath.Dir(path)); err != nil {
+		fallback := filepath.Join(fallbackDir(tmp), filepath.Base(path))
+		fallbackErr := privateDir(filepath.Dir(fallback))
+		if fallbackErr == nil {
+			fallbackErr = probeWritable(filepath.Dir(fallback))
+		}
+		if fallbackErr == nil {
+			logger.Warn().Err(err).Str("fallback", fallback).
+				Msg("tag cache location is not writable, using a temporary cache instead")
+			tc.path = fallback
+			if _, err := os.Stat(fallback); err == nil {
+				readPath = fallback
+			}
+		} else {
+			logger.Warn().Err(err).AnErr("fallback_error", fallbackErr).
+				Msg("tag cache location is not writable, cache updates will not be saved")
+			tc.noSave = true
+		}
+	}
+
+	data, err := os.ReadFile(readPath)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			logger.Warn().Err(err).Msg("reading tag cache file")
@@ -45,24 +202,206 @@ func Load(path string, logger zerolog.Logger) *TagCache {
 		return tc
 	}
 
-	if err := json.Unmarshal(data, &tc.entries); err != nil {
+	if err := tc.parse(data); err != nil {
 		logger.Warn().Err(err).Msg("parsing tag cache file")
 		tc.entries = make(map[string]entry)
+		tc.roots = nil
+	}
+
+	// Entries written before usage tracking count as used now, so they are not evicted at once.
+	now := tc.now().UnixNano()
+	for k, e := range tc.entries {
+		if e.LastUsed == 0 {
+			e.LastUsed = now
+			tc.entries[k] = e
+		}
 	}
 
 	return tc
 }
 
+// parse reads a cache file in any layout, resolving relative keys against the
+// root they were saved under.
+func (tc *TagCache) parse(data []byte) error {
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil || (file.Version != relativeVersion && file.Version != rootsVersion) {
+		// Absolute paths never collide with the envelope's field names.
+		return json.Unmarshal(data, &tc.entries)
+	}
+	if file.Version == relativeVersion {
+		file.Roots = map[string]map[string]entry{file.Root: file.Entries}
+	}
+	tc.roots = make(map[string]bool, len(file.Roots))
+	for root, entries := range file.Roots {
+		tc.roots[root] = true
+		for k, e := range entries {
+			if filepath.IsAbs(k) {
+				tc.entries[k] = e
+				continue
+			}
+			tc.entries[filepath.Join(root, filepath.FromSlash(k))] = e
+		}
+	}
+	if file.Version == rootsVersion {
+		maps.Copy(tc.entries, file.Entries)
+	}
+	return nil
+}
+
+// probeWritable checks that files can be created in dir, creating dir if needed.
+func probeWritable(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return err
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// SetEvictionPolicy sets the limits applied when the cache is saved.
+func (tc *TagCache) SetEvictionPolicy(p EvictionPolicy) {
+	tc.policy = p
+}
+
+// SetClock replaces the clock used to stamp and age entries. Meant for tests.
+func (tc *TagCache) SetClock(c clock.Clock) {
+	tc.clock = c
+}
+
+// now returns the current time from tc's clock, or the system clock if none is set.
+func (tc *TagCache) now() time.Time {
+	if tc.clock == nil {
+		return time.Now()
+	}
+	return tc.clock.Now()
+}
+
+// SetLyrics declares whether metadata is read with lyrics extraction.
+// When enabled, entries read without lyrics miss so they are re-parsed; when
+// disabled, cached lyrics are dropped so they do not linger in the cache.
+func (tc *TagCache) SetLyrics(enabled bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.lyrics = enabled
+	if enabled {
+		return
+	}
+	for k, e := range tc.entries {
+		if e.Lyrics || e.Meta.Lyrics != "" {
+			e.Meta.Lyrics = ""
+			e.Lyrics = false
+			tc.entries[k] = e
+			tc.dirty = true
+		}
+	}
+}
+
+// SetRelativeRoot makes Save key the entries under root by their path
+// relative to it, so the cache stays warm when the library is moved or mounted
+// elsewhere. Files outside every root keep absolute keys. Entries of other
+// libraries the cache was saved with stay under their own root, unless that
+// root no longer exists: the library is then taken to have moved to root, and
+// its entries move with it (they only hit if a file there has the same size
+// and modification time).
+func (tc *TagCache) SetRelativeRoot(root string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tc.root = filepath.Clean(root)
+	if tc.roots == nil {
+		tc.roots = make(map[string]bool)
+	}
+	if !tc.roots[tc.root] {
+		// Save at least once in the new layout, even if nothing else changes.
+		tc.roots[tc.root] = true
+		tc.dirty = true
+	}
+
+	gone := make([]string, 0, len(tc.roots))
+	for r := range tc.roots {
+		if _, err := os.Stat(r); err != nil && r != tc.root {
+			gone = append(gone, r)
+		}
+	}
+	sort.Strings(gone)
+	moved := make(map[string]entry)
+	for _, r := range gone {
+		delete(tc.roots, r)
+		for path, e := range tc.entries {
+			rel, ok := relativeTo(r, path)
+			if !ok || tc.ownerRoot(path) != "" {
+				continue
+			}
+			delete(tc.entries, path)
+			if dest := filepath.Join(tc.root, filepath.FromSlash(rel)); !hasKey(moved, dest) {
+				moved[dest] = e
+			}
+		}
+		tc.dirty = true
+	}
+	for path, e := range moved {
+		if !hasKey(tc.entries, path) {
+			tc.entries[path] = e
+		}
+	}
+}
+
+// hasKey reports whether entries holds path.
+func hasKey(entries map[string]entry, path string) bool {
+	_, ok := entries[path]
+	return ok
+}
+
+// ownerRoot returns the innermost of tc.roots that contains path, or "" if
+// none does. The caller must hold tc.mu.
+func (tc *TagCache) ownerRoot(path string) string {
+	owner := ""
+	for r := range tc.roots {
+		if _, ok := relativeTo(r, path); ok && len(r) > len(owner) {
+			owner = r
+		}
+	}
+	return owner
+}
+
+// relativeTo returns path relative to root, slash-separated, and false if it
+// is outside the root.
+func relativeTo(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
 // Len returns the number of entries in the cache.
 func (tc *TagCache) Len() int {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
 	return len(tc.entries)
 }
 
-// Lookup returns cached metadata if the file's size and mtime match the cached entry.
-// It is goroutine-safe (read-only map access + os.Stat).
+// Path returns the file the cache is saved to: the path given to Load, or the
+// temp-dir fallback used instead. It is empty when the cache is not saved.
+func (tc *TagCache) Path() string {
+	if tc.noSave {
+		return ""
+	}
+	return tc.path
+}
+
+// Lookup returns cached metadata if the file's size and mtime match the cached
+// entry and it was read with the current metaSchema, and records the hit as a
+// use of the entry if it was last used over a day ago. It is goroutine-safe.
 func (tc *TagCache) Lookup(filePath string) (tags.AudioMeta, bool) {
+	tc.mu.Lock()
 	e, ok := tc.entries[filePath]
-	if !ok {
+	tc.mu.Unlock()
+	if !ok || e.Schema != metaSchema || (tc.lyrics && !e.Lyrics) {
 		return tags.AudioMeta{}, false
 	}
 
@@ -71,10 +410,21 @@ func (tc *TagCache) Lookup(filePath string) (tags.AudioMeta, bool) {
 		return tags.AudioMeta{}, false
 	}
 
+	tc.mu.Lock()
+	tc.checkMTime(filePath, info.ModTime())
+	tc.mu.Unlock()
 	if info.Size() != e.Key.Size || info.ModTime().UnixNano() != e.Key.ModTime {
 		return tags.AudioMeta{}, false
 	}
 
+	tc.mu.Lock()
+	if now := tc.now().UnixNano(); now-e.LastUsed >= int64(lastUsedResolution) {
+		e.LastUsed = now
+		tc.entries[filePath] = e
+		tc.dirty = true
+	}
+	tc.mu.Unlock()
+
 	return e.Meta, true
 }
 
@@ -86,19 +436,72 @@ func (tc *TagCache) Store(filePath string, meta tags.AudioMeta) {
 		return
 	}
 
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.checkMTime(filePath, info.ModTime())
 	tc.entries[filePath] = entry{
 		Key: fileKey{
 			Size:    info.Size(),
 			ModTime: info.ModTime().UnixNano(),
 		},
-		Meta: meta,
+		Meta:     meta,
+		Schema:   metaSchema,
+		LastUsed: tc.now().UnixNano(),
+		Lyrics:   tc.lyrics,
 	}
 	tc.dirty = true
 }
 
-// Save writes the cache to disk if it has been modified.
+// checkMTime warns, once per cache, about a modification time that cannot be
+// real: at or before the Unix epoch, or in the future. Some file systems (FAT)
+// and restore tools produce them, and the cache then cannot tell whether the
+// file changed. The caller must hold tc.mu.
+func (tc *TagCache) checkMTime(filePath string, mtime time.Time) {
+	if tc.warnedMTime || (mtime.Unix() > 0 && !mtime.After(tc.now().Add(mtimeFutureSlack))) {
+		return
+	}
+	tc.warnedMTime = true
+	tc.logger.Warn().Str("file", filePath).Time("mtime", mtime).
+		Msg("file modification time is implausible (at the epoch or in the future), so the tag cache " +
+			"cannot tell whether files changed; use --cache-bypass for the affected folders or --no-cache")
+}
+
+// Export writes every cached entry to w as a pretty-printed manifest readable by
+// tags.LoadManifest, sorted by path.
+func (tc *TagCache) Export(w io.Writer) error {
+	tc.mu.Lock()
+	manifest := make([]tags.ManifestEntry, 0, len(tc.entries))
+	for path, e := range tc.entries {
+		manifest = append(manifest, tags.ManifestEntry{
+			Path:  path,
+			Size:  e.Key.Size,
+			MTime: time.Unix(0, e.Key.ModTime).UTC(),
+			Meta:  e.Meta,
+		})
+	}
+	tc.mu.Unlock()
+
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].Path < manifest[j].Path })
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return fmt.Errorf("exporting tag cache: %w", err)
+	}
+	return nil
+}
+
+// Save applies the eviction policy and writes the cache to disk if it has been modified.
 func (tc *TagCache) Save() error {
-	if !tc.dirty {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	if evicted := tc.evict(tc.now()); evicted > 0 {
+		tc.logger.Debug().Int("evicted", evicted).Msg("evicted tag cache entries")
+		tc.dirty = true
+	}
+
+	if !tc.dirty || tc.noSave {
 		return nil
 	}
 
@@ -106,10 +509,99 @@ func (tc *TagCache) Save() error {
 		return err
 	}
 
-	data, err := json.Marshal(tc.entries)
+	var data []byte
+	var err error
+	if len(tc.roots) == 0 {
+		data, err = json.Marshal(tc.entries)
+	} else {
+		file := cacheFile{Version: rootsVersion, Roots: make(map[string]map[string]entry, len(tc.roots)), Entries: make(map[string]entry)}
+		for root := range tc.roots {
+			file.Roots[root] = make(map[string]entry)
+		}
+		for path, e := range tc.entries {
+			root := tc.ownerRoot(path)
+			if root == "" {
+				file.Entries[path] = e
+				continue
+			}
+			rel, _ := relativeTo(root, path)
+			file.Roots[root][rel] = e
+		}
+		data, err = json.Marshal(file)
+	}
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(tc.path, data, 0o644)
+	write := tc.writeData
+	if write == nil {
+		write = (*os.File).Write
+	}
+	return writeAtomic(tc.path, data, write)
+}
+
+// writeAtomic writes data to a temporary file next to path and renames it into
+// place, so a crash or a full disk mid-write leaves the previous file intact
+// instead of a truncated one that Load would have to discard. The data goes
+// through write.
+func writeAtomic(path string, data []byte, write func(*os.File, []byte) (int, error)) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary cache file: %w", err)
+	}
+	tmp := f.Name()
+	if _, err := write(f, data); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing tag cache: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing tag cache: %w", err)
+	}
+	// CreateTemp makes the file owner-only; keep the cache readable as before
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing tag cache: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replacing tag cache: %w", err)
+	}
+	return nil
+}
+
+// evict removes entries per the eviction policy and returns how many were removed.
+// The caller must hold tc.mu.
+func (tc *TagCache) evict(now time.Time) int {
+	before := len(tc.entries)
+
+	if tc.policy.MaxAge > 0 {
+		cutoff := now.Add(-tc.policy.MaxAge).UnixNano()
+		for k, e := range tc.entries {
+			if e.LastUsed < cutoff {
+				delete(tc.entries, k)
+			}
+		}
+	}
+
+	if tc.policy.MaxEntries > 0 && len(tc.entries) > tc.policy.MaxEntries {
+		keys := make([]string, 0, len(tc.entries))
+		for k := range tc.entries {
+			keys = append(keys, k)
+		}
+		// Most recently used first; ties broken by path for determinism.
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := tc.entries[keys[i]], tc.entries[keys[j]]
+			if a.LastUsed != b.LastUsed {
+				return a.LastUsed > b.LastUsed
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys[tc.policy.MaxEntries:] {
+			delete(tc.entries, k)
+		}
+	}
+
+	return before - len(tc.entries)
 }
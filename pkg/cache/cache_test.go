@@ -1,9 +1,15 @@
 package cache
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"maps"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -11,7 +17,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/clock"
 	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags/tagstest"
 )
 
 var nopLogger = zerolog.Nop()
@@ -105,13 +113,26 @@ func TestLookup(t *testing.T) {
 			lookup: filePath,
 			entries: map[string]entry{
 				filePath: {
-					Key:  fileKey{Size: info.Size(), ModTime: info.ModTime().UnixNano()},
-					Meta: cachedMeta,
+					Key:    fileKey{Size: info.Size(), ModTime: info.ModTime().UnixNano()},
+					Meta:   cachedMeta,
+					Schema: metaSchema,
 				},
 			},
 			wantMeta: cachedMeta,
 			wantOK:   true,
 		},
+		{
+			name:   "miss on entry read with an older schema",
+			lookup: filePath,
+			entries: map[string]entry{
+				filePath: {
+					Key:    fileKey{Size: info.Size(), ModTime: info.ModTime().UnixNano()},
+					Meta:   cachedMeta,
+					Schema: metaSchema - 1,
+				},
+			},
+			wantOK: false,
+		},
 		{
 			name:   "miss on different size",
 			lookup: filePath,
@@ -205,6 +226,49 @@ func TestStoreAndSaveRoundtrip(t *testing.T) {
 	assert.Equal(t, meta, got)
 }
 
+func TestExportRoundtripThroughManifest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.flac")
+	second := filepath.Join(dir, "b.mp3")
+	require.NoError(t, os.WriteFile(first, []byte("flac content"), 0o644))
+	require.NoError(t, os.WriteFile(second, []byte("mp3"), 0o644))
+
+	metas := map[string]tags.AudioMeta{
+		first:  {Title: "First", Artist: "Band", TrackNumber: 1, Duration: 3 * time.Minute},
+		second: {Title: "Second", Artist: "Band", TrackNumber: -1, Lyrics: "la la la"},
+	}
+	tc := Load(filepath.Join(dir, "cache.json"), nopLogger)
+	for path, meta := range metas {
+		tc.Store(path, meta)
+	}
+
+	exportPath := filepath.Join(dir, "export.json")
+	f, err := os.Create(exportPath)
+	require.NoError(t, err)
+	require.NoError(t, tc.Export(f))
+	require.NoError(t, f.Close())
+
+	m, err := tags.LoadManifest(exportPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{first, second}, m.Paths(), "entries are sorted by path")
+	for path, want := range metas {
+		got, ok := m.Lookup(path)
+		require.True(t, ok, path)
+		assert.Equal(t, want, got)
+	}
+
+	var raw []map[string]any
+	data, err := os.ReadFile(exportPath)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &raw))
+	info, err := os.Stat(first)
+	require.NoError(t, err)
+	assert.EqualValues(t, info.Size(), raw[0]["size"])
+	assert.Equal(t, info.ModTime().UTC().Format(time.RFC3339Nano), raw[0]["mtime"])
+}
+
 func TestSaveNoop(t *testing.T) {
 	t.Parallel()
 
@@ -218,3 +282,602 @@ func TestSaveNoop(t *testing.T) {
 	_, err := os.Stat(cachePath)
 	assert.True(t, os.IsNotExist(err))
 }
+
+func TestSaveEviction(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	day := 24 * time.Hour
+	entries := func() map[string]entry {
+		return map[string]entry{
+			"/music/new.mp3":     {LastUsed: now.Add(-1 * day).UnixNano()},
+			"/music/recent.mp3":  {LastUsed: now.Add(-10 * day).UnixNano()},
+			"/music/old.mp3":     {LastUsed: now.Add(-100 * day).UnixNano()},
+			"/music/ancient.mp3": {LastUsed: now.Add(-400 * day).UnixNano()},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		policy EvictionPolicy
+		want   []string
+	}{
+		{
+			name:   "no policy keeps everything",
+			policy: EvictionPolicy{},
+			want:   []string{"/music/ancient.mp3", "/music/new.mp3", "/music/old.mp3", "/music/recent.mp3"},
+		},
+		{
+			name:   "max age drops stale entries",
+			policy: EvictionPolicy{MaxAge: 90 * day},
+			want:   []string{"/music/new.mp3", "/music/recent.mp3"},
+		},
+		{
+			name:   "max entries keeps most recently used",
+			policy: EvictionPolicy{MaxEntries: 3},
+			want:   []string{"/music/new.mp3", "/music/old.mp3", "/music/recent.mp3"},
+		},
+		{
+			name:   "both limits",
+			policy: EvictionPolicy{MaxEntries: 1, MaxAge: 90 * day},
+			want:   []string{"/music/new.mp3"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cachePath := filepath.Join(t.TempDir(), "cache.json")
+			tc := &TagCache{path: cachePath, entries: entries(), logger: nopLogger}
+			tc.SetEvictionPolicy(test.policy)
+			require.NoError(t, tc.Save())
+
+			got := make([]string, 0, len(tc.entries))
+			for k := range tc.entries {
+				got = append(got, k)
+			}
+			assert.ElementsMatch(t, test.want, got)
+
+			if len(test.want) < 4 {
+				assert.Equal(t, len(test.want), Load(cachePath, nopLogger).Len())
+			}
+		})
+	}
+}
+
+func TestLookupUpdatesLastUsed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "song.mp3")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0o644))
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+
+	key := fileKey{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		lastUsed  time.Time
+		wantDirty bool
+	}{
+		{"stale entry is stamped", now.Add(-25 * time.Hour), true},
+		{"entry used today is left alone", now.Add(-time.Hour), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc := &TagCache{entries: map[string]entry{
+				filePath: {Key: key, Schema: metaSchema, LastUsed: test.lastUsed.UnixNano()},
+			}}
+			tc.SetClock(clock.NewFake(now))
+
+			_, ok := tc.Lookup(filePath)
+			require.True(t, ok)
+			assert.Equal(t, test.wantDirty, tc.dirty, "a warm run must not rewrite the cache")
+			want := test.lastUsed
+			if test.wantDirty {
+				want = now
+			}
+			assert.Equal(t, want.UnixNano(), tc.entries[filePath].LastUsed)
+		})
+	}
+}
+
+func TestLookupLyrics(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "song.mp3")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0o644))
+	info, err := os.Stat(filePath)
+	require.NoError(t, err)
+	key := fileKey{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		entry      entry
+		wantHit    bool
+		wantLyrics string
+	}{
+		{"enabled misses entry read without lyrics", true, entry{Key: key, Schema: metaSchema}, false, ""},
+		{"enabled hits entry read with lyrics", true, entry{Key: key, Meta: tags.AudioMeta{Lyrics: "la la"}, Schema: metaSchema, Lyrics: true}, true, "la la"},
+		{"disabled drops cached lyrics", false, entry{Key: key, Meta: tags.AudioMeta{Lyrics: "la la"}, Schema: metaSchema, Lyrics: true}, true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			tc := &TagCache{entries: map[string]entry{filePath: test.entry}}
+			tc.SetLyrics(test.enabled)
+
+			meta, ok := tc.Lookup(filePath)
+			require.Equal(t, test.wantHit, ok)
+			assert.Equal(t, test.wantLyrics, meta.Lyrics)
+			if !test.enabled {
+				assert.Empty(t, tc.entries[filePath].Meta.Lyrics, "dropped from the stored entry too")
+				assert.False(t, tc.entries[filePath].Lyrics, "a later run with lyrics re-reads the file")
+			}
+		})
+	}
+}
+
+func TestEvictionWithFakeClock(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "song.mp3")
+	require.NoError(t, os.WriteFile(filePath, []byte("data"), 0o644))
+
+	day := 24 * time.Hour
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	tc := Load(filepath.Join(dir, "cache.json"), nopLogger)
+	tc.SetClock(fake)
+	tc.SetEvictionPolicy(EvictionPolicy{MaxAge: 30 * day})
+
+	tc.Store(filePath, tags.AudioMeta{Title: "Song"})
+	assert.Equal(t, fake.Now().UnixNano(), tc.entries[filePath].LastUsed)
+
+	// A hit within the window refreshes the entry
+	fake.Advance(20 * day)
+	_, ok := tc.Lookup(filePath)
+	require.True(t, ok)
+	fake.Advance(20 * day)
+	require.NoError(t, tc.Save())
+	assert.Equal(t, 1, tc.Len())
+
+	// Unused past MaxAge
+	fake.Advance(31 * day)
+	require.NoError(t, tc.Save())
+	assert.Equal(t, 0, tc.Len())
+}
+
+func TestLoad_UnwritableLocation(t *testing.T) {
+	t.Parallel()
+
+	song := filepath.Join(t.TempDir(), "song.mp3")
+	require.NoError(t, os.WriteFile(song, []byte("data"), 0o644))
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T) string // returns the unwritable cache path
+	}{
+		{
+			name: "read-only directory",
+			setup: func(t *testing.T) string {
+				dir := filepath.Join(t.TempDir(), "ro")
+				require.NoError(t, os.Mkdir(dir, 0o755))
+				require.NoError(t, os.Chmod(dir, 0o555))
+				t.Cleanup(func() { _ = os.Chmod(dir, 0o755) })
+				if probeWritable(dir) == nil {
+					t.Skip("directory permissions are not enforced for this user (e.g. root)")
+				}
+				return filepath.Join(dir, "cache.json")
+			},
+		},
+		{
+			name: "parent is a file",
+			setup: func(t *testing.T) string {
+				blocker := filepath.Join(t.TempDir(), "blocker")
+				require.NoError(t, os.WriteFile(blocker, nil, 0o644))
+				return filepath.Join(blocker, "cache.json")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := test.setup(t)
+			tmp := t.TempDir()
+			fallback := filepath.Join(fallbackDir(tmp), "cache.json")
+
+			tc := load(path, tmp, nopLogger)
+			tc.Store(song, tags.AudioMeta{Title: "Song"})
+			require.NoError(t, tc.Save())
+			assert.FileExists(t, fallback)
+			assert.NoFileExists(t, path)
+			if runtime.GOOS != "windows" {
+				info, err := os.Stat(filepath.Dir(fallback))
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+			}
+
+			// The next run picks up the fallback cache
+			assert.Equal(t, 1, load(path, tmp, nopLogger).Len())
+		})
+	}
+
+	t.Run("fallback directory open to other users", func(t *testing.T) {
+		t.Parallel()
+		if runtime.GOOS == "windows" {
+			t.Skip("permission bits are not checked on Windows")
+		}
+
+		blocker := filepath.Join(t.TempDir(), "blocker")
+		require.NoError(t, os.WriteFile(blocker, nil, 0o644))
+		tmp := t.TempDir()
+		// Another user could have created it first and planted entries.
+		require.NoError(t, os.Mkdir(fallbackDir(tmp), 0o777))
+		require.NoError(t, os.Chmod(fallbackDir(tmp), 0o777))
+
+		tc := load(filepath.Join(blocker, "cache.json"), tmp, nopLogger)
+		assert.True(t, tc.noSave)
+		assert.Empty(t, tc.Path())
+	})
+
+	t.Run("nowhere writable", func(t *testing.T) {
+		t.Parallel()
+
+		blocker := filepath.Join(t.TempDir(), "blocker")
+		require.NoError(t, os.WriteFile(blocker, nil, 0o644))
+
+		tc := load(filepath.Join(blocker, "cache.json"), blocker, nopLogger)
+		tc.Store(song, tags.AudioMeta{Title: "Song"})
+		require.NoError(t, tc.Save())
+		assert.True(t, tc.noSave)
+	})
+}
+
+func TestPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T) (cachePath, tmp string)
+		want  func(cachePath, tmp string) string
+	}{
+		{
+			name: "writable location",
+			setup: func(t *testing.T) (string, string) {
+				return filepath.Join(t.TempDir(), "cache.json"), t.TempDir()
+			},
+			want: func(cachePath, _ string) string { return cachePath },
+		},
+		{
+			name: "temp-dir fallback",
+			setup: func(t *testing.T) (string, string) {
+				blocker := filepath.Join(t.TempDir(), "blocker")
+				require.NoError(t, os.WriteFile(blocker, nil, 0o644))
+				return filepath.Join(blocker, "cache.json"), t.TempDir()
+			},
+			want: func(_, tmp string) string {
+				return filepath.Join(fallbackDir(tmp), "cache.json")
+			},
+		},
+		{
+			name: "nowhere writable",
+			setup: func(t *testing.T) (string, string) {
+				blocker := filepath.Join(t.TempDir(), "blocker")
+				require.NoError(t, os.WriteFile(blocker, nil, 0o644))
+				return filepath.Join(blocker, "cache.json"), blocker
+			},
+			want: func(string, string) string { return "" },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			cachePath, tmp := test.setup(t)
+			tc := load(cachePath, tmp, nopLogger)
+			assert.Equal(t, test.want(cachePath, tmp), tc.Path())
+		})
+	}
+}
+
+func BenchmarkTagCacheLookup(b *testing.B) {
+	paths := tagstest.Fixtures(b, 200)
+	tc := Load(filepath.Join(b.TempDir(), "cache.json"), nopLogger)
+	for _, p := range paths {
+		tc.Store(p, tags.AudioMeta{Title: filepath.Base(p)})
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, ok := tc.Lookup(paths[i%len(paths)]); !ok {
+				b.Error("expected a cache hit")
+			}
+			i++
+		}
+	})
+}
+
+func TestSave_WriteFailureKeepsPreviousCache(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+	first := filepath.Join(dir, "first.flac")
+	second := filepath.Join(dir, "second.flac")
+	require.NoError(t, os.WriteFile(first, []byte("one"), 0o644))
+	require.NoError(t, os.WriteFile(second, []byte("two"), 0o644))
+
+	tc := Load(cachePath, nopLogger)
+	tc.Store(first, tags.AudioMeta{Title: "First"})
+	require.NoError(t, tc.Save())
+	before, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+
+	// The disk fills up half-way through the next save
+	errDiskFull := errors.New("no space left on device")
+	tc.writeData = func(f *os.File, b []byte) (int, error) {
+		n, _ := f.Write(b[:len(b)/2])
+		return n, errDiskFull
+	}
+	tc.Store(second, tags.AudioMeta{Title: "Second"})
+	err = tc.Save()
+	require.ErrorIs(t, err, errDiskFull)
+
+	after, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	assert.Equal(t, before, after, "the previous cache is untouched")
+	left, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, left, 3, "no temporary file is left behind")
+
+	reloaded := Load(cachePath, nopLogger)
+	_, ok := reloaded.Lookup(first)
+	assert.True(t, ok, "the warm cache survives")
+
+	// Once the write goes through, the new entry is saved
+	tc.writeData = nil
+	require.NoError(t, tc.Save())
+	reloaded = Load(cachePath, nopLogger)
+	assert.Equal(t, 2, reloaded.Len())
+	info, err := os.Stat(cachePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+}
+
+func TestImplausibleMTimeWarning(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		mtime    time.Time
+		wantWarn bool
+	}{
+		{"plausible", now.Add(-48 * time.Hour), false},
+		{"slightly ahead (timezone)", now.Add(3 * time.Hour), false},
+		{"far future", now.AddDate(5, 0, 0), true},
+		{"epoch zero", time.Unix(0, 0), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			var files []string
+			for _, name := range []string{"a.mp3", "b.mp3"} {
+				path := filepath.Join(dir, name)
+				require.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+				require.NoError(t, os.Chtimes(path, test.mtime, test.mtime))
+				files = append(files, path)
+			}
+
+			var buf bytes.Buffer
+			tc := Load(filepath.Join(dir, "cache.json"), zerolog.New(&buf))
+			tc.SetClock(clock.NewFake(now))
+			for _, f := range files {
+				tc.Store(f, tags.AudioMeta{Title: "t"})
+				_, ok := tc.Lookup(f)
+				assert.True(t, ok, "the cache still works, it just cannot be trusted")
+			}
+
+			warnings := strings.Count(buf.String(), "modification time is implausible")
+			if test.wantWarn {
+				assert.Equal(t, 1, warnings, "warned once per run")
+				assert.Contains(t, buf.String(), "--no-cache")
+			} else {
+				assert.Zero(t, warnings)
+			}
+		})
+	}
+}
+
+func TestRelativeRoot_Relocation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		saveRelative bool
+		loadRelative bool
+		move         bool
+		wantHit      bool
+	}{
+		{"relative keys survive a move", true, true, true, true},
+		{"relative keys in place", true, true, false, true},
+		{"relative cache read with absolute keys in place", true, false, false, true},
+		{"absolute keys miss after a move", false, false, true, false},
+		{"absolute cache upgraded to relative in place", false, true, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			cachePath := filepath.Join(dir, "cache.json")
+			oldRoot := filepath.Join(dir, "old", "Music")
+			newRoot := filepath.Join(dir, "new", "Library")
+			rel := filepath.Join("Artist", "Album", "01 Song.flac")
+			require.NoError(t, os.MkdirAll(filepath.Join(oldRoot, "Artist", "Album"), 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(oldRoot, rel), []byte("flac content"), 0o644))
+
+			meta := tags.AudioMeta{Title: "Song", Artist: "Artist", Album: "Album"}
+			tc := Load(cachePath, nopLogger)
+			if test.saveRelative {
+				tc.SetRelativeRoot(oldRoot)
+			}
+			tc.Store(filepath.Join(oldRoot, rel), meta)
+			require.NoError(t, tc.Save())
+
+			root := oldRoot
+			if test.move {
+				// A rename keeps size and mtime, like moving the library to another disk would.
+				require.NoError(t, os.MkdirAll(filepath.Dir(newRoot), 0o755))
+				require.NoError(t, os.Rename(oldRoot, newRoot))
+				root = newRoot
+			}
+
+			tc2 := Load(cachePath, nopLogger)
+			if test.loadRelative {
+				tc2.SetRelativeRoot(root)
+			}
+			got, ok := tc2.Lookup(filepath.Join(root, rel))
+			require.Equal(t, test.wantHit, ok)
+			if ok {
+				assert.Equal(t, meta, got)
+			}
+		})
+	}
+}
+
+func TestRelativeRoot_SavedKeys(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+	root := filepath.Join(dir, "Music")
+	inside := filepath.Join(root, "Artist", "song.mp3")
+	outside := filepath.Join(dir, "Elsewhere", "other.mp3")
+	for _, path := range []string{inside, outside} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+	}
+
+	tc := Load(cachePath, nopLogger)
+	tc.SetRelativeRoot(root)
+	tc.Store(inside, tags.AudioMeta{Title: "Inside"})
+	tc.Store(outside, tags.AudioMeta{Title: "Outside"})
+	require.NoError(t, tc.Save())
+
+	data, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	var file cacheFile
+	require.NoError(t, json.Unmarshal(data, &file))
+	assert.Equal(t, rootsVersion, file.Version)
+	require.Contains(t, file.Roots, root)
+	assert.Contains(t, file.Roots[root], "Artist/song.mp3", "keys are slash-separated on every OS")
+	assert.Len(t, file.Roots[root], 1)
+	assert.Equal(t, []string{outside}, slices.Collect(maps.Keys(file.Entries)), "files outside the root keep absolute keys")
+
+	// The export resolves relative keys back to absolute paths.
+	tc2 := Load(cachePath, nopLogger)
+	var buf bytes.Buffer
+	require.NoError(t, tc2.Export(&buf))
+	var manifest []tags.ManifestEntry
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &manifest))
+	var paths []string
+	for _, m := range manifest {
+		paths = append(paths, m.Path)
+	}
+	assert.ElementsMatch(t, []string{inside, outside}, paths)
+}
+
+func TestRelativeRoot_AlternatingLibraries(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+	roots := []string{filepath.Join(dir, "Music"), filepath.Join(dir, "Audiobooks")}
+	files := make([]string, len(roots))
+	for i, root := range roots {
+		files[i] = filepath.Join(root, "Artist", "01.mp3")
+		require.NoError(t, os.MkdirAll(filepath.Dir(files[i]), 0o755))
+		require.NoError(t, os.WriteFile(files[i], []byte(strings.Repeat("x", i+1)), 0o644))
+	}
+
+	// Each run caches its own library, then the other library's run comes back
+	for run := range 4 {
+		i := run % 2
+		tc := Load(cachePath, nopLogger)
+		tc.SetRelativeRoot(roots[i])
+		_, ok := tc.Lookup(files[i])
+		assert.Equal(t, run >= 2, ok, "run %d", run)
+		if !ok {
+			tc.Store(files[i], tags.AudioMeta{Title: roots[i]})
+		}
+		require.NoError(t, tc.Save())
+	}
+
+	tc := Load(cachePath, nopLogger)
+	for i := range roots {
+		got, ok := tc.Lookup(files[i])
+		require.True(t, ok)
+		assert.Equal(t, roots[i], got.Title)
+	}
+}
+
+func TestRelativeRoot_LegacyFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache.json")
+	root := filepath.Join(dir, "Library")
+	path := filepath.Join(root, "Artist", "01.mp3")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0o644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	// A single-root cache saved for a library that has since moved
+	legacy := cacheFile{
+		Version: relativeVersion,
+		Root:    filepath.Join(dir, "Old"),
+		Entries: map[string]entry{"Artist/01.mp3": {
+			Key:    fileKey{Size: info.Size(), ModTime: info.ModTime().UnixNano()},
+			Meta:   tags.AudioMeta{Title: "Song"},
+			Schema: metaSchema,
+		}},
+	}
+	data, err := json.Marshal(legacy)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(cachePath, data, 0o644))
+
+	tc := Load(cachePath, nopLogger)
+	tc.SetRelativeRoot(root)
+	got, ok := tc.Lookup(path)
+	require.True(t, ok)
+	assert.Equal(t, "Song", got.Title)
+	require.NoError(t, tc.Save())
+
+	data, err = os.ReadFile(cachePath)
+	require.NoError(t, err)
+	var file cacheFile
+	require.NoError(t, json.Unmarshal(data, &file))
+	assert.Equal(t, rootsVersion, file.Version, "the cache is upgraded even though no entry changed")
+	assert.Equal(t, []string{root}, slices.Collect(maps.Keys(file.Roots)))
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cache
+
+import "io/fs"
+
+// checkPrivate accepts any directory: the temp directory is already per-user
+// on Windows, and its permission bits say nothing about other users.
+func checkPrivate(string, fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package clock
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	assert.Equal(t, start, f.Now())
+
+	assert.Equal(t, start.Add(time.Hour), f.Advance(time.Hour))
+	assert.Equal(t, start.Add(time.Hour), f.Advance(-time.Minute), "negative durations are ignored")
+
+	fired := <-f.After(30 * time.Second)
+	assert.Equal(t, start.Add(time.Hour+30*time.Second), fired)
+	assert.Equal(t, fired, f.Now())
+
+	f.Set(start)
+	assert.Equal(t, start, f.Now())
+}
+
+func ExampleFake() {
+	c := NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	deadline := c.Now().Add(90 * 24 * time.Hour)
+
+	c.Advance(100 * 24 * time.Hour)
+	fmt.Println(c.Now().After(deadline))
+	// Output: true
+}
@@ -24,23 +24,32 @@ type Credentials struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// Dir returns the directory holding the tool's configuration, including credentials.
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("determining config directory: %w", err)
+	}
+	return filepath.Join(dir, appDir), nil
+}
+
 // Load reads stored credentials from the default config path.
 // Returns (nil, nil) if the file does not exist.
 func Load() (*Credentials, error) {
-	dir, err := os.UserConfigDir()
+	dir, err := Dir()
 	if err != nil {
-		return nil, fmt.Errorf("determining config directory: %w", err)
+		return nil, err
 	}
-	return loadFrom(filepath.Join(dir, appDir, credsFile))
+	return loadFrom(filepath.Join(dir, credsFile))
 }
 
 // Save writes credentials to the default config path.
 func Save(creds *Credentials) error {
-	dir, err := os.UserConfigDir()
+	dir, err := Dir()
 	if err != nil {
-		return fmt.Errorf("determining config directory: %w", err)
+		return err
 	}
-	return saveTo(filepath.Join(dir, appDir, credsFile), creds)
+	return saveTo(filepath.Join(dir, credsFile), creds)
 }
 
 func loadFrom(path string) (*Credentials, error) {
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 const (
@@ -52,7 +53,10 @@ func exchangeAuthorizationCode(ctx context.Context, endpoint, appKey, appSecret,
 		"client_id":     {appKey},
 		"client_secret": {appSecret},
 	}
+	return exchangeCode(ctx, endpoint, form)
+}
 
+func exchangeCode(ctx context.Context, endpoint string, form url.Values) (string, string, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
 	if err != nil {
 		return "", "", fmt.Errorf("creating code exchange request: %w", err)
@@ -67,7 +71,8 @@ func exchangeAuthorizationCode(ctx context.Context, endpoint, appKey, appSecret,
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", "", fmt.Errorf("code exchange failed (HTTP %d): %s", resp.StatusCode, string(body))
+		return "", "", fmt.Errorf("code exchange failed (HTTP %d): %s", resp.StatusCode,
+			redact(string(body), form.Get("code"), form.Get("client_secret"), form.Get("code_verifier")))
 	}
 
 	var tok authCodeResponse
@@ -87,43 +92,54 @@ func exchangeAuthorizationCode(ctx context.Context, endpoint, appKey, appSecret,
 }
 
 // RefreshAccessToken exchanges a refresh token for a new short-lived access token.
+// appSecret may be empty for refresh tokens obtained through the PKCE flow.
 func RefreshAccessToken(ctx context.Context, appKey, appSecret, refreshToken string) (string, error) {
+	token, _, err := refreshAccessToken(ctx, tokenEndpoint, appKey, appSecret, refreshToken)
+	return token, err
+}
+
+// RefreshAccessTokenWithExpiry is like RefreshAccessToken but also returns how
+// long the new token is valid for, as reported by Dropbox (zero if it did not say).
+func RefreshAccessTokenWithExpiry(ctx context.Context, appKey, appSecret, refreshToken string) (string, time.Duration, error) {
 	return refreshAccessToken(ctx, tokenEndpoint, appKey, appSecret, refreshToken)
 }
 
-func refreshAccessToken(ctx context.Context, endpoint, appKey, appSecret, refreshToken string) (string, error) {
+func refreshAccessToken(ctx context.Context, endpoint, appKey, appSecret, refreshToken string) (string, time.Duration, error) {
 	form := url.Values{
 		"grant_type":    {"refresh_token"},
 		"refresh_token": {refreshToken},
 		"client_id":     {appKey},
-		"client_secret": {appSecret},
+	}
+	if appSecret != "" {
+		form.Set("client_secret", appSecret)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("creating token refresh request: %w", err)
+		return "", 0, fmt.Errorf("creating token refresh request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("requesting token refresh: %w", err)
+		return "", 0, fmt.Errorf("requesting token refresh: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("token refresh failed (HTTP %d): %s. Check your app key, app secret, and refresh token", resp.StatusCode, string(body))
+		return "", 0, fmt.Errorf("token refresh failed (HTTP %d): %s. Check your app key, app secret, and refresh token",
+			resp.StatusCode, redact(string(body), refreshToken, appSecret))
 	}
 
 	var tok tokenResponse
 	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
-		return "", fmt.Errorf("decoding token refresh response: %w", err)
+		return "", 0, fmt.Errorf("decoding token refresh response: %w", err)
 	}
 
 	if tok.AccessToken == "" {
-		return "", fmt.Errorf("empty access token in refresh response")
+		return "", 0, fmt.Errorf("empty access token in refresh response")
 	}
 
-	return tok.AccessToken, nil
+	return tok.AccessToken, time.Duration(tok.ExpiresIn) * time.Second, nil
 }
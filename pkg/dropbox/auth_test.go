@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -101,6 +102,7 @@ func TestRefreshAccessToken(t *testing.T) {
 		statusCode int
 		body       string
 		wantToken  string
+		wantExpiry time.Duration
 		wantErr    string
 	}{
 		{
@@ -108,6 +110,13 @@ func TestRefreshAccessToken(t *testing.T) {
 			statusCode: http.StatusOK,
 			body:       `{"access_token":"sl.new-token","expires_in":14400,"token_type":"bearer"}`,
 			wantToken:  "sl.new-token",
+			wantExpiry: 4 * time.Hour,
+		},
+		{
+			name:       "no lifetime reported",
+			statusCode: http.StatusOK,
+			body:       `{"access_token":"sl.new-token","token_type":"bearer"}`,
+			wantToken:  "sl.new-token",
 		},
 		{
 			name:       "invalid credentials",
@@ -148,7 +157,7 @@ func TestRefreshAccessToken(t *testing.T) {
 			}))
 			defer srv.Close()
 
-			token, err := refreshAccessToken(context.Background(), srv.URL, "test-key", "test-secret", "test-refresh")
+			token, expiry, err := refreshAccessToken(context.Background(), srv.URL, "test-key", "test-secret", "test-refresh")
 
 			if test.wantErr != "" {
 				require.Error(t, err)
@@ -158,6 +167,37 @@ func TestRefreshAccessToken(t *testing.T) {
 
 			require.NoError(t, err)
 			assert.Equal(t, test.wantToken, token)
+			assert.Equal(t, test.wantExpiry, expiry)
 		})
 	}
 }
+
+func TestAuthErrors_RedactSecrets(t *testing.T) {
+	t.Parallel()
+
+	// An error body that echoes what was submitted must not leak it.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"bad request: ` + r.PostForm.Encode() + `"}`))
+	}))
+	defer srv.Close()
+
+	_, _, err := exchangeAuthorizationCode(context.Background(), srv.URL, "test-key", "app-secret-123", "auth-code-456")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "code exchange failed (HTTP 400)")
+	assert.NotContains(t, err.Error(), "app-secret-123")
+	assert.NotContains(t, err.Error(), "auth-code-456")
+
+	_, _, err = exchangeAuthorizationCodePKCE(context.Background(), srv.URL, "test-key", "verifier-789", "auth-code-456")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "verifier-789")
+	assert.NotContains(t, err.Error(), "auth-code-456")
+
+	_, _, err = refreshAccessToken(context.Background(), srv.URL, "test-key", "app-secret-123", "refresh-token-abc")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token refresh failed (HTTP 400)")
+	assert.Contains(t, err.Error(), "test-key", "the app key is not a secret")
+	assert.NotContains(t, err.Error(), "app-secret-123")
+	assert.NotContains(t, err.Error(), "refresh-token-abc")
+}
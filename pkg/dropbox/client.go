@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -13,29 +14,125 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/clock"
 )
 
 const (
 	apiBase        = "https://api.dropboxapi.com/2"
+	contentBase    = "https://content.dropboxapi.com/2"
 	initialBackoff = 1 * time.Second
 	maxBackoff     = 60 * time.Second
 	maxRetries     = 10
+
+	// DefaultCallTimeout bounds each attempt of a quick RPC call, body included.
+	DefaultCallTimeout = 30 * time.Second
+	// DefaultListTimeout bounds each attempt of a list_folder page, which Dropbox
+	// can take a long time to build for a large folder.
+	DefaultListTimeout = 2 * time.Minute
+	// DefaultUploadTimeout bounds each attempt of an upload request: a whole
+	// file of up to 150 MB, or one chunk of an upload session, over what may be
+	// a slow uplink.
+	DefaultUploadTimeout = 15 * time.Minute
 )
 
 // Client is a Dropbox API client.
 type Client struct {
-	token  string
-	http   *http.Client
-	logger zerolog.Logger
+	token       string
+	baseURL     string
+	contentURL  string
+	http        *http.Client
+	timeout     time.Duration
+	listTimeout time.Duration
+	clock       clock.Clock
+	limiter     *Limiter
+	logger      zerolog.Logger
+	// pathRoot, if set, is sent as the Dropbox-API-Path-Root header.
+	pathRoot string
+	// chunkSize is the size of each UploadSession request; tests lower it to
+	// exercise several chunks with little data.
+	chunkSize int
+	// uploadTimeout replaces timeout for the content endpoints that upload files.
+	uploadTimeout time.Duration
 }
 
 // NewClient creates a new Dropbox API client.
 func NewClient(token string, logger zerolog.Logger) *Client {
+	c := NewClientWithBaseURL(token, apiBase, logger)
+	c.contentURL = contentBase
+	return c
+}
+
+// NewClientWithBaseURL creates a Dropbox API client that talks to baseURL instead of
+// the public API endpoint, for both RPC and content (upload) calls. It is mainly
+// useful for pointing the client at a test server.
+func NewClientWithBaseURL(token, baseURL string, logger zerolog.Logger) *Client {
 	return &Client{
-		token:  token,
-		http:   &http.Client{Timeout: 30 * time.Second},
-		logger: logger,
+		token:         token,
+		baseURL:       baseURL,
+		contentURL:    baseURL,
+		http:          &http.Client{},
+		timeout:       DefaultCallTimeout,
+		listTimeout:   DefaultListTimeout,
+		uploadTimeout: DefaultUploadTimeout,
+		clock:         clock.Real{},
+		logger:        logger,
+		chunkSize:     uploadChunkSize,
+	}
+}
+
+// SetToken replaces the access token, e.g. after a refresh. It must not be
+// called while requests are in flight.
+func (c *Client) SetToken(token string) {
+	c.token = token
+}
+
+// SetPathRoot makes every request resolve paths against the namespace with
+// the given numeric ID, such as a team space root, instead of the user's home
+// namespace. An empty ID restores the default.
+func (c *Client) SetPathRoot(namespaceID string) error {
+	if namespaceID == "" {
+		c.pathRoot = ""
+		return nil
+	}
+	if _, err := strconv.ParseUint(namespaceID, 10, 64); err != nil {
+		return fmt.Errorf("namespace ID %q must be numeric", namespaceID)
 	}
+	header, err := json.Marshal(map[string]string{".tag": "root", "root": namespaceID})
+	if err != nil {
+		return fmt.Errorf("encoding path root: %w", err)
+	}
+	c.pathRoot = string(header)
+	return nil
+}
+
+// SetListTimeout sets how long each list_folder and list_folder/continue
+// request may take, separately from the timeout of other calls.
+func (c *Client) SetListTimeout(d time.Duration) {
+	c.listTimeout = d
+}
+
+// timeoutFor returns the per-attempt timeout for endpoint.
+func (c *Client) timeoutFor(endpoint string) time.Duration {
+	switch endpoint {
+	case "/files/list_folder", "/files/list_folder/continue":
+		return c.listTimeout
+	case "/files/upload", "/files/upload_session/start", "/files/upload_session/append_v2", "/files/upload_session/finish":
+		return c.uploadTimeout
+	default:
+		return c.timeout
+	}
+}
+
+// SetClock replaces the clock used to wait between rate-limited retries. Meant for tests.
+func (c *Client) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// SetLimiter makes every request, retries included, wait for l first. The same
+// Limiter may be shared by several clients; nil removes the limit.
+func (c *Client) SetLimiter(l *Limiter) {
+	c.limiter = l
 }
 
 // GetAccountID retrieves the current user's account ID.
@@ -58,14 +155,46 @@ func (c *Client) GetAccountID(ctx context.Context) (string, error) {
 	return account.AccountID, nil
 }
 
+// GetMetadata returns the entry at remotePath, a file or a folder. Unlike the
+// parent folders in a listing's path_display, its Name has the casing Dropbox
+// stores.
+func (c *Client) GetMetadata(ctx context.Context, remotePath string) (Entry, error) {
+	reqBody, err := json.Marshal(map[string]string{"path": remotePath})
+	if err != nil {
+		return Entry{}, fmt.Errorf("marshaling get_metadata request: %w", err)
+	}
+
+	body, err := c.apiCall(ctx, "/files/get_metadata", string(reqBody))
+	if err != nil {
+		if errors.Is(err, ErrPathNotFound) {
+			return Entry{}, fmt.Errorf("getting metadata of %q: %w", displayPath(remotePath), err)
+		}
+		return Entry{}, err
+	}
+	defer func() { _ = body.Close() }()
+
+	var entry Entry
+	if err := json.NewDecoder(body).Decode(&entry); err != nil {
+		return Entry{}, fmt.Errorf("decoding get_metadata response: %w", err)
+	}
+	return entry, nil
+}
+
 // ListFolder lists all file entries under the given remote path (recursive).
 // remotePath should be "" for the Dropbox root, not "/".
 func (c *Client) ListFolder(ctx context.Context, remotePath string) ([]Entry, error) {
-	c.logger.Debug().Str("remote_path", remotePath).Msg("listing Dropbox folder")
+	return c.ListFolderSince(ctx, remotePath, time.Time{})
+}
+
+// ListFolderSince is like ListFolder but skips files whose server_modified time is
+// before modifiedSince. A zero modifiedSince keeps every file.
+func (c *Client) ListFolderSince(ctx context.Context, remotePath string, modifiedSince time.Time) ([]Entry, error) {
+	c.logger.Debug().Str("remote_path", remotePath).Time("modified_since", modifiedSince).Msg("listing Dropbox folder")
 
 	payload := map[string]any{
-		"path":      remotePath,
-		"recursive": true,
+		"path":            remotePath,
+		"recursive":       true,
+		"include_deleted": false,
 	}
 	reqBody, err := json.Marshal(payload)
 	if err != nil {
@@ -74,6 +203,9 @@ func (c *Client) ListFolder(ctx context.Context, remotePath string) ([]Entry, er
 
 	body, err := c.apiCall(ctx, "/files/list_folder", string(reqBody))
 	if err != nil {
+		if errors.Is(err, ErrPathNotFound) {
+			return nil, fmt.Errorf("listing %q: %w", displayPath(remotePath), err)
+		}
 		return nil, err
 	}
 	defer func() { _ = body.Close() }()
@@ -109,50 +241,118 @@ func (c *Client) ListFolder(ctx context.Context, remotePath string) ([]Entry, er
 		c.logger.Debug().Int("entries", len(page)).Bool("has_more", resp.HasMore).Msg("received continuation page")
 	}
 
+	if !modifiedSince.IsZero() {
+		listed := len(entries)
+		entries = filterModifiedSince(entries, modifiedSince)
+		c.logger.Debug().Int("skipped", listed-len(entries)).Msg("skipped files not modified since cutoff")
+	}
+
 	c.logger.Info().Int("total_files", len(entries)).Msg("Dropbox listing complete")
 	return entries, nil
 }
 
+// filterModifiedSince keeps entries modified at or after since.
+func filterModifiedSince(entries []Entry, since time.Time) []Entry {
+	recent := entries[:0]
+	for _, e := range entries {
+		if !e.ServerModified.Before(since) {
+			recent = append(recent, e)
+		}
+	}
+	return recent
+}
+
+// filterFiles keeps only file entries. Folders are not needed for matching, and
+// deleted entries can still show up (e.g. deleted-then-restored files) even
+// though include_deleted is false.
 func filterFiles(entries []Entry) []Entry {
 	files := make([]Entry, 0, len(entries))
 	for _, e := range entries {
-		if e.Tag == "file" {
+		switch e.Tag {
+		case "file":
 			files = append(files, e)
+		case "deleted", "folder":
+			// skipped
 		}
 	}
 	return files
 }
 
+// displayPath returns remotePath as shown to users ("/" for the Dropbox root).
+func displayPath(remotePath string) string {
+	if remotePath == "" {
+		return "/"
+	}
+	return remotePath
+}
+
+// apiCall makes an RPC call to endpoint with a JSON body.
 func (c *Client) apiCall(ctx context.Context, endpoint, body string) (io.ReadCloser, error) {
+	return c.do(ctx, c.baseURL, endpoint, []byte(body), "application/json", "")
+}
+
+// contentCall makes a content-upload call to endpoint: the file goes in the body
+// and the JSON arguments in the Dropbox-API-Arg header.
+func (c *Client) contentCall(ctx context.Context, endpoint, arg string, content []byte) (io.ReadCloser, error) {
+	return c.do(ctx, c.contentURL, endpoint, content, "application/octet-stream", arg)
+}
+
+// do sends body to base+endpoint, waiting for the limiter and retrying rate limits
+// and transient errors. apiArg, if set, is sent as the Dropbox-API-Arg header.
+func (c *Client) do(ctx context.Context, base, endpoint string, body []byte, contentType, apiArg string) (io.ReadCloser, error) {
 	backoff := initialBackoff
 	retries := 0
 
 	for {
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBase+endpoint, bytes.NewBufferString(body))
+		if c.limiter != nil {
+			if d := c.limiter.reserve(c.clock.Now()); d > 0 {
+				if err := c.wait(ctx, d); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// The timeout covers reading the body too, so it is only released when the
+		// caller closes it.
+		reqCtx, cancel := context.WithTimeout(ctx, c.timeoutFor(endpoint))
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, base+endpoint, bytes.NewReader(body))
 		if err != nil {
+			cancel()
 			return nil, fmt.Errorf("creating request for %s: %w", endpoint, err)
 		}
 		req.Header.Set("Authorization", "Bearer "+c.token)
-		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Type", contentType)
+		if apiArg != "" {
+			req.Header.Set("Dropbox-API-Arg", apiArg)
+		}
+		if c.pathRoot != "" {
+			req.Header.Set("Dropbox-API-Path-Root", c.pathRoot)
+		}
 
 		resp, err := c.http.Do(req)
 		if err != nil {
+			cancel()
 			return nil, fmt.Errorf("requesting %s: %w", endpoint, err)
 		}
 
-		switch resp.StatusCode {
-		case http.StatusOK:
-			return resp.Body, nil
+		if resp.StatusCode == http.StatusOK {
+			return cancelOnClose{resp.Body, cancel}, nil
+		}
 
+		switch resp.StatusCode {
 		case http.StatusUnauthorized:
+			respBody, _ := io.ReadAll(resp.Body)
 			_ = resp.Body.Close()
-			return nil, fmt.Errorf("dropbox authentication failed (401). " +
-				"Your token may be invalid or expired. " +
-				"Use --app-key/--app-secret/--refresh-token for automatic renewal, " +
-				"or generate a new token at https://www.dropbox.com/developers/apps")
+			cancel()
+			return nil, fmt.Errorf("dropbox authentication failed: %w. "+
+				"Your token may be invalid or expired. "+
+				"Use --app-key/--app-secret/--refresh-token for automatic renewal, "+
+				"or generate a new token at https://www.dropbox.com/developers/apps",
+				newAPIError(resp.StatusCode, endpoint, respBody))
 
 		case http.StatusTooManyRequests:
 			_ = resp.Body.Close()
+			cancel()
 			retries++
 			if retries > maxRetries {
 				return nil, fmt.Errorf("rate limit retries exhausted for %s after %d attempts", endpoint, maxRetries)
@@ -165,18 +365,58 @@ func (c *Client) apiCall(ctx context.Context, endpoint, body string) (io.ReadClo
 			}
 			c.logger.Warn().Dur("wait", wait).Int("attempt", retries).Msg("rate limited by Dropbox, waiting")
 
-			select {
-			case <-ctx.Done():
-				return nil, ctx.Err()
-			case <-time.After(wait):
+			if err := c.wait(ctx, wait); err != nil {
+				return nil, err
 			}
-
-			backoff = time.Duration(math.Min(float64(backoff*2), float64(maxBackoff)))
+			backoff = nextBackoff(backoff)
 
 		default:
 			respBody, _ := io.ReadAll(resp.Body)
 			_ = resp.Body.Close()
-			return nil, fmt.Errorf("dropbox API error %d on %s: %s", resp.StatusCode, endpoint, string(respBody))
+			cancel()
+			apiErr := newAPIError(resp.StatusCode, endpoint, respBody)
+			if !apiErr.Retryable() {
+				return nil, apiErr
+			}
+
+			retries++
+			if retries > maxRetries {
+				return nil, fmt.Errorf("retries exhausted for %s after %d attempts: %w", endpoint, maxRetries, apiErr)
+			}
+			c.logger.Warn().Str("error", apiErr.Summary).Dur("wait", backoff).Int("attempt", retries).
+				Msg("transient Dropbox error, retrying")
+
+			if err := c.wait(ctx, backoff); err != nil {
+				return nil, err
+			}
+			backoff = nextBackoff(backoff)
 		}
 	}
 }
+
+// cancelOnClose releases a request's timeout once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// wait blocks for d on the client's clock, or until ctx is canceled.
+func (c *Client) wait(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.clock.After(d):
+		return nil
+	}
+}
+
+// nextBackoff doubles backoff, capped at maxBackoff.
+func nextBackoff(backoff time.Duration) time.Duration {
+	return time.Duration(math.Min(float64(backoff*2), float64(maxBackoff)))
+}
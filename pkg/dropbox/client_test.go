@@ -0,0 +1,368 @@
+package dropbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/clock"
+)
+
+func TestListFolder_PathNotFound(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/files/list_folder", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error_summary": "path/not_found/..", "error": {".tag": "path", "path": {".tag": "not_found"}}}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	_, err := client.ListFolder(context.Background(), "/Music/Missing")
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrPathNotFound))
+	assert.Contains(t, err.Error(), `"/Music/Missing"`)
+}
+
+func TestAPICall_APIError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantSummary string
+		wantTag     string
+		wantErr     string
+	}{
+		{
+			name:        "expired access token",
+			statusCode:  http.StatusUnauthorized,
+			body:        `{"error_summary": "expired_access_token/", "error": {".tag": "expired_access_token"}}`,
+			wantSummary: "expired_access_token/",
+			wantTag:     "expired_access_token",
+			wantErr:     "dropbox authentication failed: dropbox API error 401 on /users/get_current_account: expired_access_token/",
+		},
+		{
+			name:        "too many write operations",
+			statusCode:  http.StatusConflict,
+			body:        `{"error_summary": "too_many_write_operations/..", "error": {".tag": "too_many_write_operations"}}`,
+			wantSummary: "too_many_write_operations/..",
+			wantTag:     "too_many_write_operations",
+			wantErr:     "dropbox API error 409 on /users/get_current_account: too_many_write_operations/..",
+		},
+		{
+			name:       "unstructured body",
+			statusCode: http.StatusInternalServerError,
+			body:       `upstream failure`,
+			wantErr:    "dropbox API error 500 on /users/get_current_account: upstream failure",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(test.statusCode)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer srv.Close()
+
+			client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+			client.SetClock(clock.NewFake(time.Now())) // retryable errors retry without sleeping
+			_, err := client.GetAccountID(context.Background())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, test.statusCode, apiErr.StatusCode)
+			assert.Equal(t, test.wantSummary, apiErr.Summary)
+			assert.Equal(t, test.wantTag, apiErr.Tag)
+			assert.False(t, errors.Is(err, ErrPathNotFound))
+		})
+	}
+}
+
+func TestListFolder_SkipsDeletedAndFolders(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, false, req["include_deleted"])
+		assert.Equal(t, true, req["recursive"])
+
+		_, _ = w.Write([]byte(`{"entries": [
+			{".tag": "folder", "name": "Rock", "path_lower": "/music/rock", "path_display": "/Music/Rock", "id": "id:f"},
+			{".tag": "file", "name": "a.mp3", "path_lower": "/music/rock/a.mp3", "path_display": "/Music/Rock/a.mp3", "id": "id:1"},
+			{".tag": "deleted", "name": "gone.mp3", "path_lower": "/music/rock/gone.mp3", "path_display": "/Music/Rock/gone.mp3"},
+			{".tag": "file", "name": "b.mp3", "path_lower": "/music/rock/b.mp3", "path_display": "/Music/Rock/b.mp3", "id": "id:2"}
+		], "cursor": "c", "has_more": false}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	entries, err := client.ListFolder(context.Background(), "/Music")
+	require.NoError(t, err)
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, "id:1", entries[0].ID)
+	assert.Equal(t, "id:2", entries[1].ID)
+}
+
+func TestListFolderSince(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"entries": [
+			{".tag": "file", "name": "old.mp3", "id": "id:old", "server_modified": "2023-01-15T10:00:00Z"},
+			{".tag": "file", "name": "edge.mp3", "id": "id:edge", "server_modified": "2024-06-01T00:00:00Z"},
+			{".tag": "folder", "name": "Rock", "id": "id:folder"},
+			{".tag": "file", "name": "new.mp3", "id": "id:new", "server_modified": "2024-09-30T18:45:12Z"}
+		], "has_more": false}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+
+	all, err := client.ListFolder(context.Background(), "/Music")
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	since := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	recent, err := client.ListFolderSince(context.Background(), "/Music", since)
+	require.NoError(t, err)
+
+	require.Len(t, recent, 2)
+	assert.Equal(t, "id:edge", recent[0].ID)
+	assert.Equal(t, "id:new", recent[1].ID)
+	assert.Equal(t, time.Date(2024, 9, 30, 18, 45, 12, 0, time.UTC), recent[1].ServerModified)
+}
+
+func TestAPICall_RateLimitBackoff(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			// No Retry-After: falls back to the initial backoff, doubled
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{"account_id": "dbid:1"}`))
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	client.SetClock(fake)
+
+	id, err := client.GetAccountID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "dbid:1", id)
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Equal(t, 30*time.Second+2*initialBackoff, fake.Now().Sub(start))
+}
+
+func TestAPICall_RetryableConflict(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		summary   string
+		wantCalls int32
+		wantErr   bool
+	}{
+		{"transient conflict is retried", "too_many_write_operations/..", 2, false},
+		{"other conflicts fail at once", "path/malformed_path/..", 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if calls.Add(1) == 1 {
+					w.WriteHeader(http.StatusConflict)
+					_, _ = w.Write([]byte(`{"error_summary": "` + test.summary + `", "error": {".tag": "other"}}`))
+					return
+				}
+				_, _ = w.Write([]byte(`{"entries": [], "cursor": "c", "has_more": false}`))
+			}))
+			defer srv.Close()
+
+			client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+			client.SetClock(clock.NewFake(time.Now()))
+
+			_, err := client.ListFolder(context.Background(), "/Music")
+			if test.wantErr {
+				var apiErr *APIError
+				require.ErrorAs(t, err, &apiErr)
+				assert.False(t, apiErr.Retryable())
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, test.wantCalls, calls.Load())
+		})
+	}
+}
+
+func TestAPICall_RetryableConflictExhausted(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error_summary": "too_many_requests/", "error": {".tag": "too_many_requests"}}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	client.SetClock(clock.NewFake(time.Now()))
+
+	_, err := client.GetAccountID(context.Background())
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Contains(t, err.Error(), "retries exhausted")
+	assert.Equal(t, int32(maxRetries+1), calls.Load())
+}
+
+func TestTimeouts_ListingGetsLongerTimeout(t *testing.T) {
+	t.Parallel()
+
+	// Every response takes 200ms: too slow for a quick call, fine for a listing page.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		switch r.URL.Path {
+		case "/files/list_folder":
+			_, _ = w.Write([]byte(`{"entries": [{".tag": "file", "id": "id:1", "name": "a.mp3"}], "cursor": "c1", "has_more": true}`))
+		case "/files/list_folder/continue":
+			_, _ = w.Write([]byte(`{"entries": [{".tag": "file", "id": "id:2", "name": "b.mp3"}], "has_more": false}`))
+		default:
+			_, _ = w.Write([]byte(`{"account_id": "dbid:1"}`))
+		}
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	client.timeout = 50 * time.Millisecond
+	client.SetListTimeout(5 * time.Second)
+
+	assert.Equal(t, 5*time.Second, client.timeoutFor("/files/list_folder"))
+	assert.Equal(t, 5*time.Second, client.timeoutFor("/files/list_folder/continue"))
+	assert.Equal(t, 50*time.Millisecond, client.timeoutFor("/users/get_current_account"))
+
+	entries, err := client.ListFolder(context.Background(), "/Music")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	_, err = client.GetAccountID(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestListFolder_SharingInfo(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"entries": [
+			{".tag": "file", "name": "own.mp3", "path_lower": "/music/own.mp3", "path_display": "/Music/own.mp3", "id": "id:1"},
+			{".tag": "file", "name": "theirs.mp3", "path_lower": "/music/shared/theirs.mp3", "path_display": "/Music/Shared/theirs.mp3", "id": "id:2",
+				"sharing_info": {"read_only": true, "parent_shared_folder_id": "84528192421", "modified_by": "dbid:other"}}
+		], "cursor": "c", "has_more": false}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	entries, err := client.ListFolder(context.Background(), "/Music")
+	require.NoError(t, err)
+
+	require.Len(t, entries, 2)
+	assert.False(t, entries[0].Shared())
+	assert.Nil(t, entries[0].SharingInfo)
+	assert.True(t, entries[1].Shared())
+	assert.Equal(t, &SharingInfo{ReadOnly: true, ParentSharedFolderID: "84528192421", ModifiedBy: "dbid:other"}, entries[1].SharingInfo)
+}
+
+func TestSetPathRoot(t *testing.T) {
+	t.Parallel()
+
+	var header atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header.Store(r.Header.Get("Dropbox-API-Path-Root"))
+		_, _ = w.Write([]byte(`{"account_id": "dbid:1"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+
+	_, err := client.GetAccountID(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, header.Load(), "no header by default")
+
+	require.NoError(t, client.SetPathRoot("3235641"))
+	_, err = client.GetAccountID(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{".tag": "root", "root": "3235641"}`, header.Load().(string))
+
+	for _, bad := range []string{"abc", "-1", "12 34", "ns:3235641"} {
+		assert.Error(t, client.SetPathRoot(bad), bad)
+	}
+	assert.JSONEq(t, `{".tag": "root", "root": "3235641"}`, client.pathRoot, "an invalid ID keeps the previous root")
+
+	require.NoError(t, client.SetPathRoot(""))
+	_, err = client.GetAccountID(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, header.Load())
+}
+
+func TestGetMetadata(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/files/get_metadata", r.URL.Path)
+		var req map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req["path"] == "/missing" {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"error_summary": "path/not_found/..", "error": {".tag": "path", "path": {".tag": "not_found"}}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{".tag": "folder", "name": "Music", "path_lower": "/music", "path_display": "/Music", "id": "id:f"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+
+	entry, err := client.GetMetadata(context.Background(), "/music")
+	require.NoError(t, err)
+	assert.Equal(t, Entry{Tag: "folder", ID: "id:f", Name: "Music", PathLower: "/music", PathDisplay: "/Music"}, entry)
+
+	_, err = client.GetMetadata(context.Background(), "/missing")
+	require.ErrorIs(t, err, ErrPathNotFound)
+	assert.Contains(t, err.Error(), `"/missing"`)
+}
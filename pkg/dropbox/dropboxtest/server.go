@@ -0,0 +1,165 @@
+// Package dropboxtest provides an in-process mock of the Dropbox API for tests.
+package dropboxtest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+)
+
+// Token is the bearer token the mock server accepts.
+const Token = "test-token"
+
+// MockServer serves canned Dropbox API responses.
+// list_folder returns Pages[0]; each list_folder/continue call returns the next page.
+type MockServer struct {
+	*httptest.Server
+
+	AccountID string
+	Pages     [][]dropbox.Entry
+
+	mu        sync.Mutex
+	calls     map[string]int
+	listPaths []string
+	overrides map[string]http.HandlerFunc
+}
+
+// NewMockServer starts a mock Dropbox API server that is closed when t finishes.
+func NewMockServer(t testing.TB, accountID string, pages ...[]dropbox.Entry) *MockServer {
+	t.Helper()
+
+	m := &MockServer{
+		AccountID: accountID,
+		Pages:     pages,
+		calls:     make(map[string]int),
+		overrides: make(map[string]http.HandlerFunc),
+	}
+	m.Server = httptest.NewServer(http.HandlerFunc(m.serve))
+	t.Cleanup(m.Close)
+	return m
+}
+
+// Client returns a Dropbox client pointed at the mock server.
+func (m *MockServer) Client(logger zerolog.Logger) *dropbox.Client {
+	return dropbox.NewClientWithBaseURL(Token, m.URL, logger)
+}
+
+// HandleFunc overrides the response for endpoint (e.g. "/files/list_folder").
+func (m *MockServer) HandleFunc(endpoint string, h http.HandlerFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.overrides[endpoint] = h
+}
+
+// Calls returns how many requests were made to endpoint.
+func (m *MockServer) Calls(endpoint string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[endpoint]
+}
+
+// ListPaths returns the paths requested via list_folder, in order.
+func (m *MockServer) ListPaths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.listPaths...)
+}
+
+func (m *MockServer) serve(w http.ResponseWriter, r *http.Request) {
+	endpoint := r.URL.Path
+
+	m.mu.Lock()
+	m.calls[endpoint]++
+	override := m.overrides[endpoint]
+	m.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer "+Token {
+		http.Error(w, `{"error_summary":"invalid_access_token/"}`, http.StatusUnauthorized)
+		return
+	}
+	if override != nil {
+		override(w, r)
+		return
+	}
+
+	switch endpoint {
+	case "/users/get_current_account":
+		writeJSON(w, dropbox.Account{AccountID: m.AccountID})
+	case "/files/list_folder":
+		var req struct {
+			Path string `json:"path"`
+		}
+		if err := decode(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		m.listPaths = append(m.listPaths, req.Path)
+		m.mu.Unlock()
+		m.writePage(w, 0)
+	case "/files/list_folder/continue":
+		var req struct {
+			Cursor string `json:"cursor"`
+		}
+		if err := decode(r.Body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		page, err := strconv.Atoi(strings.TrimPrefix(req.Cursor, "cursor-"))
+		if err != nil || page <= 0 || page >= len(m.Pages) {
+			http.Error(w, `{"error_summary":"reset/"}`, http.StatusConflict)
+			return
+		}
+		m.writePage(w, page)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *MockServer) writePage(w http.ResponseWriter, page int) {
+	resp := dropbox.ListFolderResponse{Entries: []dropbox.Entry{}}
+	if page < len(m.Pages) {
+		resp.Entries = m.Pages[page]
+	}
+	if page+1 < len(m.Pages) {
+		resp.HasMore = true
+		resp.Cursor = "cursor-" + strconv.Itoa(page+1)
+	}
+	writeJSON(w, resp)
+}
+
+func decode(r io.Reader, v any) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// File returns a file entry whose lowercase path and name are derived from pathDisplay.
+func File(id, pathDisplay string) dropbox.Entry {
+	return dropbox.Entry{
+		Tag:         "file",
+		ID:          id,
+		Name:        pathDisplay[strings.LastIndex(pathDisplay, "/")+1:],
+		PathLower:   strings.ToLower(pathDisplay),
+		PathDisplay: pathDisplay,
+	}
+}
+
+// Folder returns a folder entry for pathDisplay.
+func Folder(pathDisplay string) dropbox.Entry {
+	e := File("", pathDisplay)
+	e.Tag = "folder"
+	return e
+}
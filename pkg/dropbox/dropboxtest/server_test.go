@@ -0,0 +1,81 @@
+package dropboxtest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/matcher"
+)
+
+func TestMockServer_GetAccountID(t *testing.T) {
+	t.Parallel()
+
+	srv := NewMockServer(t, "dbid:123")
+
+	id, err := srv.Client(zerolog.Nop()).GetAccountID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "dbid:123", id)
+}
+
+func TestMockServer_ListFolderPagination(t *testing.T) {
+	t.Parallel()
+
+	srv := NewMockServer(t, "dbid:123",
+		[]dropbox.Entry{Folder("/Music/Rock"), File("id:1", "/Music/Rock/a.mp3")},
+		[]dropbox.Entry{File("id:2", "/Music/Rock/b.flac")},
+		[]dropbox.Entry{File("id:3", "/Music/cover.jpg")},
+	)
+
+	entries, err := srv.Client(zerolog.Nop()).ListFolder(context.Background(), "/Music")
+	require.NoError(t, err)
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	assert.Equal(t, []string{"id:1", "id:2", "id:3"}, ids)
+	assert.Equal(t, []string{"/Music"}, srv.ListPaths())
+	assert.Equal(t, 1, srv.Calls("/files/list_folder"))
+	assert.Equal(t, 2, srv.Calls("/files/list_folder/continue"))
+}
+
+func TestMockServer_ListFolderThenMatch(t *testing.T) {
+	t.Parallel()
+
+	srv := NewMockServer(t, "dbid:123",
+		[]dropbox.Entry{File("id:1", "/Music/Rock/Song.mp3")},
+		[]dropbox.Entry{File("id:2", "/Music/Jazz/Tune.flac"), File("id:3", "/Music/Jazz/Remote only.mp3")},
+	)
+
+	entries, err := srv.Client(zerolog.Nop()).ListFolder(context.Background(), "/Music")
+	require.NoError(t, err)
+
+	local := []string{"/home/me/Music/Rock/song.mp3", "/home/me/Music/Jazz/Tune.flac", "/home/me/Music/Local only.mp3"}
+	result := matcher.Match("/home/me/Music", "/Music", local, entries, matcher.MatchOptions{})
+
+	require.Len(t, result.Matched, 2)
+	assert.Equal(t, "id:1", result.Matched[0].Entry.ID)
+	assert.Equal(t, "id:2", result.Matched[1].Entry.ID)
+	assert.Equal(t, []string{"/home/me/Music/Local only.mp3"}, result.UnmatchedLocal)
+	require.Len(t, result.UnmatchedDropbox, 1)
+	assert.Equal(t, "id:3", result.UnmatchedDropbox[0].ID)
+}
+
+func TestMockServer_HandleFuncOverride(t *testing.T) {
+	t.Parallel()
+
+	srv := NewMockServer(t, "dbid:123")
+	srv.HandleFunc("/users/get_current_account", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	_, err := srv.Client(zerolog.Nop()).GetAccountID(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "dropbox API error 500")
+}
@@ -0,0 +1,84 @@
+package dropbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrPathNotFound is returned when the requested Dropbox path does not exist.
+var ErrPathNotFound = errors.New("path not found in Dropbox")
+
+// APIError is a non-success response from the Dropbox API.
+// Summary and Tag come from Dropbox's structured error body when one is present,
+// e.g. {"error_summary": "path/not_found/..", "error": {".tag": "path"}}.
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	Summary    string // error_summary, e.g. "expired_access_token/"
+	Tag        string // error[".tag"], e.g. "expired_access_token"
+	Body       string // raw body, kept when it is not structured JSON
+}
+
+func (e *APIError) Error() string {
+	detail := e.Summary
+	if detail == "" {
+		detail = e.Body
+	}
+	return fmt.Sprintf("dropbox API error %d on %s: %s", e.StatusCode, e.Endpoint, detail)
+}
+
+// Is makes errors.Is(err, ErrPathNotFound) match path/not_found API errors.
+func (e *APIError) Is(target error) bool {
+	return target == ErrPathNotFound && e.HasSummaryPrefix("path/not_found")
+}
+
+// HasSummaryPrefix reports whether the error summary starts with prefix,
+// e.g. "path/not_found" or "too_many_write_operations".
+func (e *APIError) HasSummaryPrefix(prefix string) bool {
+	return strings.HasPrefix(e.Summary, prefix)
+}
+
+// retryableSummaries are 409 error summaries Dropbox documents as transient:
+// the request may succeed unchanged once account activity calms down.
+var retryableSummaries = []string{
+	"too_many_write_operations",
+	"too_many_requests",
+}
+
+// Retryable reports whether the request failed transiently and is worth retrying.
+func (e *APIError) Retryable() bool {
+	if e.StatusCode != http.StatusConflict {
+		return false
+	}
+	for _, prefix := range retryableSummaries {
+		if e.HasSummaryPrefix(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func newAPIError(statusCode int, endpoint string, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Endpoint:   endpoint,
+	}
+
+	var parsed struct {
+		ErrorSummary string `json:"error_summary"`
+		Error        struct {
+			Tag string `json:".tag"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.ErrorSummary == "" {
+		apiErr.Body = redact(string(body))
+		return apiErr
+	}
+
+	apiErr.Summary = parsed.ErrorSummary
+	apiErr.Tag = parsed.Error.Tag
+	return apiErr
+}
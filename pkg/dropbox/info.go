@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/rs/zerolog"
 )
 
 // infoJSON represents the structure of Dropbox's info.json file.
@@ -66,18 +68,58 @@ func readInfoJSON(path string) (string, error) {
 
 // ComputeRemotePath computes the Dropbox remote path from a local absolute path
 // and the Dropbox root path. Both paths are resolved via EvalSymlinks for consistency.
+// If a path cannot be resolved (e.g. a junction or NAS mount the user may not
+// traverse), it is used as-is and a warning is logged.
 // Returns "" if localAbs equals the root (Dropbox API expects "" for root, not "/").
-func ComputeRemotePath(localAbs, dropboxRoot string) (string, error) {
-	resolvedLocal, err := filepath.EvalSymlinks(localAbs)
+func ComputeRemotePath(localAbs, dropboxRoot string, logger zerolog.Logger) (string, error) {
+	return computeRemotePath(localAbs, dropboxRoot, filepath.EvalSymlinks, logger)
+}
+
+// computeRemotePath is ComputeRemotePath with symlinks resolved by
+// evalSymlinks, so tests can simulate resolution failures.
+func computeRemotePath(localAbs, dropboxRoot string, evalSymlinks func(string) (string, error), logger zerolog.Logger) (string, error) {
+	resolvedLocal, err := resolvePath(localAbs, evalSymlinks, logger)
 	if err != nil {
 		return "", fmt.Errorf("resolving local path %s: %w", localAbs, err)
 	}
 
-	resolvedRoot, err := filepath.EvalSymlinks(dropboxRoot)
+	resolvedRoot, err := resolvePath(dropboxRoot, evalSymlinks, logger)
 	if err != nil {
 		return "", fmt.Errorf("resolving Dropbox root %s: %w", dropboxRoot, err)
 	}
 
+	return relativeRemotePath(localAbs, dropboxRoot, resolvedLocal, resolvedRoot)
+}
+
+// ComputeRawRemotePath is like ComputeRemotePath but never resolves symlinks;
+// both paths are only made absolute and cleaned.
+func ComputeRawRemotePath(localAbs, dropboxRoot string) (string, error) {
+	rawLocal, err := filepath.Abs(localAbs)
+	if err != nil {
+		return "", fmt.Errorf("resolving local path %s: %w", localAbs, err)
+	}
+
+	rawRoot, err := filepath.Abs(dropboxRoot)
+	if err != nil {
+		return "", fmt.Errorf("resolving Dropbox root %s: %w", dropboxRoot, err)
+	}
+
+	return relativeRemotePath(localAbs, dropboxRoot, rawLocal, rawRoot)
+}
+
+// resolvePath resolves symlinks in path with evalSymlinks, falling back to the
+// absolute unresolved path.
+func resolvePath(path string, evalSymlinks func(string) (string, error), logger zerolog.Logger) (string, error) {
+	resolved, err := evalSymlinks(path)
+	if err == nil {
+		return resolved, nil
+	}
+
+	logger.Warn().Err(err).Str("path", path).Msg("could not resolve symlinks, using path as-is")
+	return filepath.Abs(path)
+}
+
+func relativeRemotePath(localAbs, dropboxRoot, resolvedLocal, resolvedRoot string) (string, error) {
 	// Normalize both to clean paths
 	resolvedLocal = filepath.Clean(resolvedLocal)
 	resolvedRoot = filepath.Clean(resolvedRoot)
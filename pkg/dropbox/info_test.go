@@ -1,10 +1,12 @@
 package dropbox
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -48,7 +50,7 @@ func TestComputeRemotePath(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			t.Parallel()
 
-			got, err := ComputeRemotePath(test.localAbs, test.dropboxRoot)
+			got, err := ComputeRemotePath(test.localAbs, test.dropboxRoot, zerolog.Nop())
 			if test.wantErr {
 				require.Error(t, err)
 				return
@@ -58,3 +60,27 @@ func TestComputeRemotePath(t *testing.T) {
 		})
 	}
 }
+
+func TestComputeRemotePath_EvalSymlinksFailure(t *testing.T) {
+	t.Parallel()
+
+	evalSymlinks := func(string) (string, error) {
+		return "", errors.New("access is denied")
+	}
+
+	got, err := computeRemotePath("/mnt/nas/Dropbox/Music/Rock", "/mnt/nas/Dropbox", evalSymlinks, zerolog.Nop())
+	require.NoError(t, err)
+	assert.Equal(t, "/Music/Rock", got)
+}
+
+func TestComputeRawRemotePath(t *testing.T) {
+	t.Parallel()
+
+	// Raw mode never touches the filesystem, so the paths need not exist.
+	got, err := ComputeRawRemotePath("/mnt/nas/Dropbox/Music/../Music/Jazz", "/mnt/nas/Dropbox/")
+	require.NoError(t, err)
+	assert.Equal(t, "/Music/Jazz", got)
+
+	_, err = ComputeRawRemotePath("/elsewhere/Music", "/mnt/nas/Dropbox")
+	require.Error(t, err)
+}
@@ -0,0 +1,38 @@
+package dropbox
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter caps the request rate of one or more Clients sharing it. It is a token
+// bucket holding a single token: requests are spaced at least 1/rps apart, and
+// an idle limiter lets the next request through at once. It is goroutine-safe.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time // earliest time the next request may start
+}
+
+// NewLimiter returns a Limiter allowing rps requests per second. A non-positive
+// rps returns nil, which Client treats as unlimited.
+func NewLimiter(rps float64) *Limiter {
+	if rps <= 0 {
+		return nil
+	}
+	return &Limiter{interval: time.Duration(float64(time.Second) / rps)}
+}
+
+// reserve claims the next request slot at time now and returns how long the
+// caller must wait before using it. Concurrent callers get successive slots.
+func (l *Limiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	return start.Sub(now)
+}
@@ -0,0 +1,88 @@
+package dropbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frozenClock never moves on its own; After records the wait and fires at once,
+// so every request reserves its slot against the same instant.
+type frozenClock struct {
+	now   time.Time
+	mu    sync.Mutex
+	waits []time.Duration
+}
+
+func (c *frozenClock) Now() time.Time { return c.now }
+
+func (c *frozenClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	c.waits = append(c.waits, d)
+	c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func TestLimiter_Reserve(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(4)
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Zero(t, l.reserve(t0))
+	assert.Equal(t, 250*time.Millisecond, l.reserve(t0))
+	assert.Equal(t, 400*time.Millisecond, l.reserve(t0.Add(100*time.Millisecond)))
+	assert.Zero(t, l.reserve(t0.Add(time.Second)), "an idle limiter does not hoard tokens beyond one")
+	assert.Equal(t, 250*time.Millisecond, l.reserve(t0.Add(time.Second)))
+
+	assert.Nil(t, NewLimiter(0), "non-positive rates mean unlimited")
+}
+
+func TestAPICall_SharedLimiterSerializesConcurrentCalls(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"account_id": "dbid:abc"}`))
+	}))
+	defer srv.Close()
+
+	const calls = 8
+	clk := &frozenClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := NewLimiter(10)
+
+	// Two clients sharing one limiter stay under a single ceiling.
+	clients := make([]*Client, 2)
+	for i := range clients {
+		clients[i] = NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+		clients[i].SetClock(clk)
+		clients[i].SetLimiter(limiter)
+	}
+
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := clients[i%2].GetAccountID(context.Background())
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// The first call goes straight through; each later one waits one more interval.
+	require.Len(t, clk.waits, calls-1)
+	sort.Slice(clk.waits, func(i, j int) bool { return clk.waits[i] < clk.waits[j] })
+	for i, d := range clk.waits {
+		assert.Equal(t, time.Duration(i+1)*100*time.Millisecond, d)
+	}
+}
@@ -0,0 +1,82 @@
+package dropbox
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	t.Parallel()
+
+	// Test vector from RFC 7636, Appendix B.
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", pkceChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestNewPKCEVerifier(t *testing.T) {
+	t.Parallel()
+
+	v1, err := NewPKCEVerifier()
+	require.NoError(t, err)
+	v2, err := NewPKCEVerifier()
+	require.NoError(t, err)
+
+	assert.Len(t, v1, 64)
+	assert.NotEqual(t, v1, v2)
+}
+
+func TestAuthorizationURLPKCE(t *testing.T) {
+	t.Parallel()
+
+	u, err := url.Parse(AuthorizationURLPKCE("my-app-key", "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+	require.NoError(t, err)
+
+	q := u.Query()
+	assert.Equal(t, "my-app-key", q.Get("client_id"))
+	assert.Equal(t, "offline", q.Get("token_access_type"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", q.Get("code_challenge"))
+}
+
+func TestExchangeAuthorizationCodePKCE(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "authorization_code", r.FormValue("grant_type"))
+		assert.Equal(t, "test-code", r.FormValue("code"))
+		assert.Equal(t, "test-key", r.FormValue("client_id"))
+		assert.Equal(t, "test-verifier", r.FormValue("code_verifier"))
+		_, hasSecret := r.PostForm["client_secret"]
+		assert.False(t, hasSecret)
+		_, _ = w.Write([]byte(`{"access_token":"sl.access","refresh_token":"rt.refresh"}`))
+	}))
+	defer srv.Close()
+
+	refreshToken, accessToken, err := exchangeAuthorizationCodePKCE(context.Background(), srv.URL, "test-key", "test-verifier", "test-code")
+	require.NoError(t, err)
+	assert.Equal(t, "rt.refresh", refreshToken)
+	assert.Equal(t, "sl.access", accessToken)
+}
+
+func TestRefreshAccessToken_WithoutSecret(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "test-key", r.FormValue("client_id"))
+		_, hasSecret := r.PostForm["client_secret"]
+		assert.False(t, hasSecret)
+		_, _ = w.Write([]byte(`{"access_token":"sl.new-token"}`))
+	}))
+	defer srv.Close()
+
+	token, _, err := refreshAccessToken(context.Background(), srv.URL, "test-key", "", "test-refresh")
+	require.NoError(t, err)
+	assert.Equal(t, "sl.new-token", token)
+}
@@ -0,0 +1,35 @@
+package dropbox
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redacted replaces credentials in logged and returned text.
+const redacted = "[REDACTED]"
+
+var (
+	// credentialField matches the value of a credential field in a JSON body
+	// ("refresh_token": "…") or a form ("client_secret=…").
+	credentialField = regexp.MustCompile(
+		`("(?:access_token|refresh_token|client_secret|code|code_verifier)"\s*:\s*")[^"]*(")` +
+			`|(\b(?:access_token|refresh_token|client_secret|code|code_verifier)=)[^&\s"]+`)
+	// bearerValue matches the credential after "Bearer".
+	bearerValue = regexp.MustCompile(`(?i)(bearer\s+)[^\s"',]+`)
+	// shortLivedToken matches a Dropbox short-lived access token.
+	shortLivedToken = regexp.MustCompile(`\bsl\.[A-Za-z0-9_-]{10,}`)
+)
+
+// redact masks credentials in s before it is logged or put in an error: each
+// non-empty secret verbatim, and anything shaped like one (credential fields,
+// bearer values, short-lived access tokens) whatever its value.
+func redact(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	s = credentialField.ReplaceAllString(s, "${1}${3}"+redacted+"${2}")
+	s = bearerValue.ReplaceAllString(s, "${1}"+redacted)
+	return shortLivedToken.ReplaceAllString(s, redacted)
+}
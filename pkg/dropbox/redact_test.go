@@ -0,0 +1,35 @@
+package dropbox
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		in      string
+		secrets []string
+		want    string
+	}{
+		{"known secret", `invalid client secret "s3cr3t"`, []string{"s3cr3t"}, `invalid client secret "[REDACTED]"`},
+		{"empty secret ignored", "nothing to hide", []string{""}, "nothing to hide"},
+		{"json fields", `{"refresh_token": "abc", "client_secret":"def", "error":"invalid_grant"}`, nil,
+			`{"refresh_token": "[REDACTED]", "client_secret":"[REDACTED]", "error":"invalid_grant"}`},
+		{"form fields", "grant_type=refresh_token&refresh_token=abc&client_id=key&client_secret=def", nil,
+			"grant_type=refresh_token&refresh_token=[REDACTED]&client_id=key&client_secret=[REDACTED]"},
+		{"form code but not error_code", "code=abc&error_code=42", nil, "code=[REDACTED]&error_code=42"},
+		{"bearer value", "Authorization: Bearer opaque-value", nil, "Authorization: Bearer [REDACTED]"},
+		{"short-lived token", "token sl.AbCdEf0123456789_- expired", nil, "token [REDACTED] expired"},
+		{"nothing sensitive", `{"error_summary": "path/not_found/.."}`, nil, `{"error_summary": "path/not_found/.."}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.want, redact(test.in, test.secrets...))
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package dropbox
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// traceBodyLimit caps how much of each request and response body is logged.
+const traceBodyLimit = 2048
+
+// EnableTrace logs every HTTP request the client makes: method, endpoint, status,
+// and duration at info level, plus headers and truncated bodies at trace level.
+// The bearer token is redacted wherever it appears.
+func (c *Client) EnableTrace() {
+	next := c.http.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	c.http.Transport = &traceTransport{next: next, logger: c.logger}
+}
+
+// traceTransport is an http.RoundTripper that logs the requests it forwards to next.
+type traceTransport struct {
+	next   http.RoundTripper
+	logger zerolog.Logger
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	redact := func(s string) string { return redact(s, token) }
+
+	if e := t.logger.Trace(); e.Enabled() {
+		e.Str("method", req.Method).Str("url", req.URL.String()).
+			Strs("headers", redactHeaders(req.Header, redact)).
+			Str("body", redact(requestBody(req))).
+			Msg("Dropbox HTTP request")
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.logger.Info().Str("method", req.Method).Str("endpoint", req.URL.Path).
+			Dur("elapsed", elapsed).Str("error", redact(err.Error())).Msg("Dropbox HTTP request failed")
+		return nil, err
+	}
+
+	t.logger.Info().Str("method", req.Method).Str("endpoint", req.URL.Path).
+		Int("status", resp.StatusCode).Dur("elapsed", elapsed).Msg("Dropbox HTTP request")
+	if e := t.logger.Trace(); e.Enabled() {
+		e.Int("status", resp.StatusCode).
+			Strs("headers", redactHeaders(resp.Header, redact)).
+			Str("body", redact(peekBody(resp))).
+			Msg("Dropbox HTTP response")
+	}
+	return resp, nil
+}
+
+// redactHeaders formats h as sorted "Name: value" lines, hiding Authorization
+// entirely and the token anywhere else.
+func redactHeaders(h http.Header, redact func(string) string) []string {
+	lines := make([]string, 0, len(h))
+	for _, name := range sortedKeys(h) {
+		for _, v := range h[name] {
+			if name == "Authorization" {
+				v = redacted
+			}
+			lines = append(lines, name+": "+redact(v))
+		}
+	}
+	return lines
+}
+
+func sortedKeys(h http.Header) []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// requestBody returns the start of req's body without consuming it. Uploaded
+// file content is only measured.
+func requestBody(req *http.Request) string {
+	if !isText(req.Header) {
+		return strconv.FormatInt(req.ContentLength, 10) + " bytes"
+	}
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = body.Close() }()
+	b, _ := io.ReadAll(io.LimitReader(body, traceBodyLimit+1))
+	return truncateBody(b)
+}
+
+// peekBody returns the start of resp's body and puts what it read back in front
+// of the rest, so the caller still sees the whole body.
+func peekBody(resp *http.Response) string {
+	if !isText(resp.Header) {
+		return ""
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, traceBodyLimit+1))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), resp.Body), resp.Body}
+	if err != nil {
+		return ""
+	}
+	return truncateBody(b)
+}
+
+// isText reports whether a body with these headers is worth logging: Dropbox
+// sends JSON, or plain text for some errors.
+func isText(h http.Header) bool {
+	ct := h.Get("Content-Type")
+	return strings.HasPrefix(ct, "application/json") || strings.HasPrefix(ct, "text/")
+}
+
+func truncateBody(b []byte) string {
+	if len(b) > traceBodyLimit {
+		return string(b[:traceBodyLimit]) + "…"
+	}
+	return string(b)
+}
@@ -0,0 +1,77 @@
+package dropbox
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnableTrace_RedactsToken(t *testing.T) {
+	t.Parallel()
+
+	const token = "sl.secret-token-value"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// A response echoing the token must not leak it either.
+		_, _ = w.Write([]byte(`{"account_id": "dbid:1", "echo": "` + r.Header.Get("Authorization") + `"}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := NewClientWithBaseURL(token, srv.URL, zerolog.New(&buf).Level(zerolog.TraceLevel))
+	c.EnableTrace()
+
+	id, err := c.GetAccountID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "dbid:1", id, "the traced response body is still read in full")
+
+	out := buf.String()
+	assert.NotContains(t, out, token)
+	assert.Contains(t, out, "Authorization: [REDACTED]")
+	assert.Contains(t, out, `"endpoint":"/users/get_current_account"`)
+	assert.Contains(t, out, `"status":200`)
+	assert.Contains(t, out, `Bearer [REDACTED]`, "the echoed token is redacted in the body")
+}
+
+func TestEnableTrace_InfoLevelOmitsDetails(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"account_id": "dbid:1"}`))
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := NewClientWithBaseURL("tok", srv.URL, zerolog.New(&buf).Level(zerolog.InfoLevel))
+	c.EnableTrace()
+
+	_, err := c.GetAccountID(context.Background())
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `"method":"POST"`)
+	assert.NotContains(t, lines[0], "headers")
+	assert.NotContains(t, lines[0], "body")
+}
+
+func TestRequestBody_BinaryIsMeasured(t *testing.T) {
+	t.Parallel()
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.invalid", bytes.NewReader(make([]byte, 5000)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	assert.Equal(t, "5000 bytes", requestBody(req))
+
+	req.Header.Set("Content-Type", "application/json")
+	body := requestBody(req)
+	assert.Len(t, body, traceBodyLimit+len("…"))
+}
@@ -1,5 +1,7 @@
 package dropbox
 
+import "time"
+
 // Account represents the response from /users/get_current_account.
 type Account struct {
 	AccountID string `json:"account_id"`
@@ -14,9 +16,26 @@ type ListFolderResponse struct {
 
 // Entry represents a file or folder entry from Dropbox.
 type Entry struct {
-	Tag         string `json:".tag"`
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	PathLower   string `json:"path_lower"`
-	PathDisplay string `json:"path_display"`
+	Tag            string    `json:".tag"`
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	PathLower      string    `json:"path_lower"`
+	PathDisplay    string    `json:"path_display"`
+	ContentHash    string    `json:"content_hash,omitempty"`
+	Size           int64     `json:"size,omitempty"`
+	ServerModified time.Time `json:"server_modified"`
+	// SharingInfo is set for files inside a shared folder.
+	SharingInfo *SharingInfo `json:"sharing_info,omitempty"`
+}
+
+// SharingInfo describes the shared folder a file belongs to.
+type SharingInfo struct {
+	ReadOnly             bool   `json:"read_only"`
+	ParentSharedFolderID string `json:"parent_shared_folder_id"`
+	ModifiedBy           string `json:"modified_by,omitempty"`
+}
+
+// Shared reports whether the entry lives in a shared folder.
+func (e Entry) Shared() bool {
+	return e.SharingInfo != nil
 }
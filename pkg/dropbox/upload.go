@@ -0,0 +1,130 @@
+package dropbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// MaxUploadSize is the largest file Upload accepts; larger ones need UploadSession.
+const MaxUploadSize = 150 << 20
+
+// Upload writes the contents of r to path in Dropbox, replacing any existing
+// file, and returns the new file's metadata. r is read fully before sending so
+// retries can resend it; files over 150 MiB are rejected (see UploadSession).
+func (c *Client) Upload(ctx context.Context, path string, r io.Reader) (Entry, error) {
+	content, err := io.ReadAll(io.LimitReader(r, MaxUploadSize+1))
+	if err != nil {
+		return Entry{}, fmt.Errorf("reading upload content: %w", err)
+	}
+	if len(content) > MaxUploadSize {
+		return Entry{}, fmt.Errorf("uploading %s: file exceeds the %d MiB single-request limit", path, MaxUploadSize>>20)
+	}
+
+	c.logger.Debug().Str("path", path).Int("bytes", len(content)).Msg("uploading to Dropbox")
+	var entry Entry
+	if err := c.contentJSON(ctx, "/files/upload", uploadCommit(path), content, &entry); err != nil {
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// uploadChunkSize is the size of each upload session request.
+const uploadChunkSize = 8 << 20
+
+// uploadCursor locates the next chunk of an upload session.
+type uploadCursor struct {
+	SessionID string `json:"session_id"`
+	Offset    int64  `json:"offset"`
+}
+
+// UploadSession is like Upload but streams r in chunks through an upload session
+// (start, append, finish), so files of any size can be uploaded. Each chunk is
+// retried on rate limits and transient errors like any other request.
+func (c *Client) UploadSession(ctx context.Context, path string, r io.Reader) (Entry, error) {
+	var started struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := c.contentJSON(ctx, "/files/upload_session/start", map[string]any{"close": false}, nil, &started); err != nil {
+		return Entry{}, err
+	}
+	cursor := uploadCursor{SessionID: started.SessionID}
+
+	chunk := make([]byte, c.chunkSize)
+	for {
+		n, err := io.ReadFull(r, chunk)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return Entry{}, fmt.Errorf("reading upload content: %w", err)
+		}
+
+		if last {
+			c.logger.Debug().Str("path", path).Int64("bytes", cursor.Offset+int64(n)).Msg("finishing upload session")
+			var entry Entry
+			arg := map[string]any{"cursor": cursor, "commit": uploadCommit(path)}
+			if err := c.contentJSON(ctx, "/files/upload_session/finish", arg, chunk[:n], &entry); err != nil {
+				return Entry{}, err
+			}
+			return entry, nil
+		}
+
+		arg := map[string]any{"cursor": cursor, "close": false}
+		if err := c.contentJSON(ctx, "/files/upload_session/append_v2", arg, chunk[:n], nil); err != nil {
+			return Entry{}, fmt.Errorf("uploading chunk at offset %d: %w", cursor.Offset, err)
+		}
+		cursor.Offset += int64(n)
+	}
+}
+
+// uploadCommit describes where and how an uploaded file is saved: at path,
+// replacing any existing file, without notifying the user's devices.
+func uploadCommit(path string) map[string]any {
+	return map[string]any{
+		"path":       path,
+		"mode":       "overwrite",
+		"autorename": false,
+		"mute":       true,
+	}
+}
+
+// contentJSON makes a content call with arg as Dropbox-API-Arg and decodes the
+// JSON response into out, unless out is nil.
+func (c *Client) contentJSON(ctx context.Context, endpoint string, arg any, content []byte, out any) error {
+	argJSON, err := json.Marshal(arg)
+	if err != nil {
+		return fmt.Errorf("marshaling %s arguments: %w", endpoint, err)
+	}
+
+	body, err := c.contentCall(ctx, endpoint, headerSafeJSON(argJSON), content)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s response: %w", endpoint, err)
+	}
+	return nil
+}
+
+// headerSafeJSON escapes non-ASCII characters in a JSON document as \uXXXX so it
+// can travel in an HTTP header, as Dropbox-API-Arg requires.
+func headerSafeJSON(b []byte) string {
+	var sb strings.Builder
+	for _, r := range string(b) {
+		if r < 0x80 {
+			sb.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&sb, `\u%04x`, u)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,200 @@
+package dropbox
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/clock"
+)
+
+func TestUpload(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/files/upload", r.URL.Path)
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/octet-stream", r.Header.Get("Content-Type"))
+
+		rawArg := r.Header.Get("Dropbox-API-Arg")
+		for _, c := range rawArg {
+			assert.Less(t, c, rune(0x80), "Dropbox-API-Arg must be ASCII")
+		}
+		var arg struct {
+			Path string `json:"path"`
+			Mode string `json:"mode"`
+		}
+		assert.NoError(t, json.Unmarshal([]byte(rawArg), &arg))
+		assert.Equal(t, "/Apps/CloudBeats/Bibliothèque 🎵.cbbackup", arg.Path)
+		assert.Equal(t, "overwrite", arg.Mode)
+
+		content, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"items": [], "playlists": []}`, string(content))
+
+		// A transient failure first: the content must be resent intact.
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{".tag": "file", "id": "id:up", "name": "Bibliothèque 🎵.cbbackup",
+			"path_display": "/Apps/CloudBeats/Bibliothèque 🎵.cbbackup", "size": 30}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	client.SetClock(clock.NewFake(time.Now()))
+
+	entry, err := client.Upload(context.Background(), "/Apps/CloudBeats/Bibliothèque 🎵.cbbackup",
+		strings.NewReader(`{"items": [], "playlists": []}`))
+	require.NoError(t, err)
+	assert.Equal(t, "id:up", entry.ID)
+	assert.Equal(t, int64(30), entry.Size)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestUpload_Timeout(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A slow uplink: longer than an RPC call may take
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		_, _ = w.Write([]byte(`{".tag": "file", "id": "id:up", "name": "lib.cbbackup"}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	client.timeout = 50 * time.Millisecond
+	client.uploadTimeout = 5 * time.Second
+
+	for _, endpoint := range []string{"/files/upload", "/files/upload_session/start", "/files/upload_session/append_v2", "/files/upload_session/finish"} {
+		assert.Equal(t, 5*time.Second, client.timeoutFor(endpoint), endpoint)
+	}
+
+	entry, err := client.Upload(context.Background(), "/lib.cbbackup", strings.NewReader("{}"))
+	require.NoError(t, err)
+	assert.Equal(t, "id:up", entry.ID)
+}
+
+func TestUpload_APIError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(`{"error_summary": "path/insufficient_space/..", "error": {".tag": "path"}}`))
+	}))
+	defer srv.Close()
+
+	client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+	_, err := client.Upload(context.Background(), "/backup.cbbackup", strings.NewReader("{}"))
+
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.True(t, apiErr.HasSummaryPrefix("path/insufficient_space"))
+}
+
+func TestUploadSession(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		content     string
+		wantAppends int
+	}{
+		{"several chunks and a short tail", "0123456789", 2},
+		{"exact multiple of the chunk size", "01234567", 2},
+		{"empty file", "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			type cursorArg struct {
+				Cursor uploadCursor `json:"cursor"`
+				Commit struct {
+					Path string `json:"path"`
+					Mode string `json:"mode"`
+				} `json:"commit"`
+			}
+
+			var (
+				mu        sync.Mutex
+				received  []byte
+				appends   int
+				committed string
+				throttled bool
+			)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				var arg cursorArg
+				assert.NoError(t, json.Unmarshal([]byte(r.Header.Get("Dropbox-API-Arg")), &arg))
+				chunk, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+
+				switch r.URL.Path {
+				case "/files/upload_session/start":
+					assert.Empty(t, chunk)
+					_, _ = w.Write([]byte(`{"session_id": "sess-1"}`))
+				case "/files/upload_session/append_v2":
+					// The first append is throttled once and must be resent unchanged.
+					if !throttled {
+						throttled = true
+						w.WriteHeader(http.StatusTooManyRequests)
+						return
+					}
+					assert.Equal(t, "sess-1", arg.Cursor.SessionID)
+					assert.Equal(t, int64(len(received)), arg.Cursor.Offset, "chunks arrive in order")
+					received = append(received, chunk...)
+					appends++
+					_, _ = w.Write([]byte("null"))
+				case "/files/upload_session/finish":
+					assert.Equal(t, int64(len(received)), arg.Cursor.Offset)
+					assert.Equal(t, "overwrite", arg.Commit.Mode)
+					received = append(received, chunk...)
+					committed = arg.Commit.Path
+					_, _ = w.Write([]byte(`{".tag": "file", "id": "id:big", "path_display": "/Backups/big.cbbackup"}`))
+				default:
+					t.Errorf("unexpected endpoint %s", r.URL.Path)
+				}
+			}))
+			defer srv.Close()
+
+			client := NewClientWithBaseURL("token", srv.URL, zerolog.Nop())
+			client.SetClock(clock.NewFake(time.Now()))
+			client.chunkSize = 4
+
+			entry, err := client.UploadSession(context.Background(), "/Backups/big.cbbackup", strings.NewReader(test.content))
+			require.NoError(t, err)
+			assert.Equal(t, "id:big", entry.ID)
+			assert.Equal(t, test.content, string(received))
+			assert.Equal(t, test.wantAppends, appends)
+			assert.Equal(t, "/Backups/big.cbbackup", committed)
+		})
+	}
+}
+
+func TestHeaderSafeJSON(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `{"path":"/caf\u00e9 \ud83c\udfb5"}`, headerSafeJSON([]byte(`{"path":"/café 🎵"}`)))
+	assert.Equal(t, `{"path":"/plain"}`, headerSafeJSON([]byte(`{"path":"/plain"}`)))
+}
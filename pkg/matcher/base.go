@@ -0,0 +1,32 @@
+package matcher
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// SkipPaths moves matched files whose Dropbox path is one of paths from
+// r.Matched to r.InBase, so only files missing from a base backup are
+// processed. Paths compare like Dropbox does: case-insensitively, after NFC
+// normalization. Unlike key-based resume this ignores entry IDs, so a library
+// merged in from another account is still recognized.
+func (r *ScanResult) SkipPaths(paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	skip := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		skip[strings.ToLower(norm.NFC.String(p))] = true
+	}
+
+	kept := r.Matched[:0]
+	for _, mf := range r.Matched {
+		if skip[mf.Entry.PathLower] {
+			r.InBase = append(r.InBase, mf)
+			continue
+		}
+		kept = append(kept, mf)
+	}
+	r.Matched = kept
+}
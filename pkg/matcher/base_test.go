@@ -0,0 +1,71 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+)
+
+func TestSkipPaths(t *testing.T) {
+	t.Parallel()
+
+	matched := func(paths ...string) []MatchedFile {
+		var mfs []MatchedFile
+		for _, p := range paths {
+			mfs = append(mfs, MatchedFile{LocalPath: "/local" + p, Entry: dropbox.Entry{PathLower: p}})
+		}
+		return mfs
+	}
+
+	tests := []struct {
+		name       string
+		base       []string
+		wantKept   []MatchedFile
+		wantInBase []MatchedFile
+	}{
+		{
+			name:     "no base",
+			wantKept: matched("/music/old/a.mp3", "/music/new/b.mp3"),
+		},
+		{
+			name:     "no overlap",
+			base:     []string{"/Music/Other/c.mp3"},
+			wantKept: matched("/music/old/a.mp3", "/music/new/b.mp3"),
+		},
+		{
+			name:       "overlap",
+			base:       []string{"/Music/Old/A.mp3"},
+			wantKept:   matched("/music/new/b.mp3"),
+			wantInBase: matched("/music/old/a.mp3"),
+		},
+		{
+			name:       "full overlap",
+			base:       []string{"/music/new/b.mp3", "/MUSIC/OLD/A.MP3"},
+			wantKept:   []MatchedFile{},
+			wantInBase: matched("/music/old/a.mp3", "/music/new/b.mp3"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			r := ScanResult{Matched: matched("/music/old/a.mp3", "/music/new/b.mp3")}
+			r.SkipPaths(test.base)
+			assert.Equal(t, test.wantKept, r.Matched)
+			assert.Equal(t, test.wantInBase, r.InBase)
+		})
+	}
+}
+
+func TestSkipPaths_NFD(t *testing.T) {
+	t.Parallel()
+
+	nfc := norm.NFC.String("/music/café.mp3")
+	r := ScanResult{Matched: []MatchedFile{{LocalPath: "/local/cafe.mp3", Entry: dropbox.Entry{PathLower: nfc}}}}
+	r.SkipPaths([]string{norm.NFD.String("/Music/Café.mp3")})
+
+	assert.Empty(t, r.Matched)
+	assert.Len(t, r.InBase, 1)
+}
@@ -0,0 +1,74 @@
+package matcher
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+)
+
+func FuzzMatch(f *testing.F) {
+	for _, seed := range []struct {
+		rel   string
+		flips uint64
+	}{
+		{"Song.mp3", 0},
+		{"café/Crème brûlée.flac", 0b1011},
+		{"Ärzte/Über/Straße.mp3", 0b110},
+		{"a/b/c/d.m4a", 0},
+		{"Björk/Homogenic/01 Hunter.ogg", 0xffff},
+	} {
+		f.Add(seed.rel, seed.flips)
+	}
+
+	f.Fuzz(func(t *testing.T, rel string, flips uint64) {
+		if !utf8.ValidString(rel) || strings.ContainsAny(rel, "\\\x00") {
+			t.Skip()
+		}
+		for _, seg := range strings.Split(rel, "/") {
+			if seg == "" || seg == "." || seg == ".." {
+				t.Skip()
+			}
+		}
+
+		const localDir = "/home/me/Dropbox/Music"
+		const remotePath = "/Music"
+
+		// Dropbox stores NFC names and reports them lowercased in path_lower.
+		display := remotePath + "/" + norm.NFC.String(rel)
+		entry := dropbox.Entry{
+			Tag:         "file",
+			ID:          "id:1",
+			Name:        filepath.Base(display),
+			PathLower:   strings.ToLower(display),
+			PathDisplay: display,
+		}
+
+		// The local copy may be NFD (macOS) and differ in ASCII letter case.
+		local := localDir + "/" + flipASCIICase(norm.NFD.String(rel), flips)
+
+		result := Match(localDir, remotePath, []string{local}, []dropbox.Entry{entry}, MatchOptions{})
+		if len(result.Matched) != 1 {
+			t.Fatalf("local %q did not match entry %q (key %q)", local, entry.PathLower, matchKey(strings.ToLower(remotePath), rel))
+		}
+	})
+}
+
+// flipASCIICase upper-cases the ASCII letters selected by the bits of mask.
+func flipASCIICase(s string, mask uint64) string {
+	b := []byte(s)
+	bit := 0
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' {
+			if mask&(1<<(bit%64)) != 0 {
+				b[i] = c - 'a' + 'A'
+			}
+			bit++
+		}
+	}
+	return string(b)
+}
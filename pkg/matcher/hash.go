@@ -0,0 +1,55 @@
+package matcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/worker"
+)
+
+// contentHashBlockSize is the block size of the Dropbox content hash algorithm.
+const contentHashBlockSize = 4 * 1024 * 1024
+
+// ContentHash computes the Dropbox content hash of the file at path: the SHA-256
+// of the concatenated SHA-256 digests of each 4 MiB block, hex-encoded.
+// The result is comparable with dropbox.Entry.ContentHash.
+func ContentHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	overall := sha256.New()
+	block := make([]byte, contentHashBlockSize)
+	for {
+		n, err := io.ReadFull(f, block)
+		if n > 0 {
+			sum := sha256.Sum256(block[:n])
+			overall.Write(sum[:])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+
+	return hex.EncodeToString(overall.Sum(nil)), nil
+}
+
+// HashFiles computes the content hash of each path using n concurrent workers.
+// Hashes and errors are returned in the same order as paths.
+func HashFiles(ctx context.Context, paths []string, n int, progress worker.ProgressFunc) ([]string, []error) {
+	return worker.Process(ctx, paths, n,
+		func(_ context.Context, path string) (string, error) {
+			return ContentHash(path)
+		},
+		progress,
+	)
+}
@@ -0,0 +1,68 @@
+package matcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentHash(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	// Two full blocks plus a partial one exercises the block boundaries.
+	data := bytes.Repeat([]byte("cloudbeats"), (2*contentHashBlockSize+1234)/10)
+	path := filepath.Join(dir, "big.flac")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	var digests []byte
+	for off := 0; off < len(data); off += contentHashBlockSize {
+		end := min(off+contentHashBlockSize, len(data))
+		sum := sha256.Sum256(data[off:end])
+		digests = append(digests, sum[:]...)
+	}
+	want := sha256.Sum256(digests)
+
+	got, err := ContentHash(path)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(want[:]), got)
+
+	// An empty file has no blocks, so its hash is the SHA-256 of nothing.
+	empty := filepath.Join(dir, "empty.mp3")
+	require.NoError(t, os.WriteFile(empty, nil, 0o644))
+	got, err = ContentHash(empty)
+	require.NoError(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", got)
+}
+
+func TestHashFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.mp3")
+	b := filepath.Join(dir, "b.mp3")
+	require.NoError(t, os.WriteFile(a, []byte("a"), 0o644))
+	require.NoError(t, os.WriteFile(b, []byte("b"), 0o644))
+
+	wantA, err := ContentHash(a)
+	require.NoError(t, err)
+	wantB, err := ContentHash(b)
+	require.NoError(t, err)
+
+	hashes, errs := HashFiles(context.Background(), []string{a, filepath.Join(dir, "missing.mp3"), b}, 2, nil)
+
+	assert.Equal(t, wantA, hashes[0])
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	assert.Equal(t, wantB, hashes[2])
+	assert.NoError(t, errs[2])
+	assert.NotEqual(t, wantA, wantB)
+}
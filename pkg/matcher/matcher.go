@@ -2,8 +2,13 @@
 package matcher
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/text/unicode/norm"
@@ -20,6 +25,7 @@ func IsAudioFile(name string) bool {
 var audioExtensions = map[string]bool{
 	".mp3":  true,
 	".m4a":  true,
+	".m4b":  true,
 	".flac": true,
 	".ogg":  true,
 	".opus": true,
@@ -45,36 +51,271 @@ type ScanResult struct {
 	Matched          []MatchedFile
 	UnmatchedLocal   []string
 	UnmatchedDropbox []dropbox.Entry
+	// Conflicts lists local files left unmatched because their basename is ambiguous (MatchByFilename only).
+	Conflicts []Conflict
+	// SizeMismatches lists matched files pulled out by CheckSizes because the
+	// local copy differs in size from Dropbox (e.g. still syncing).
+	SizeMismatches []SizeMismatch
+	// InBase lists matched files pulled out by SkipPaths because a base backup
+	// already has an item at their Dropbox path.
+	InBase []MatchedFile
+	// Shared lists matched files pulled out by SkipShared because they live in
+	// a shared folder.
+	Shared []MatchedFile
+	// OutOfRange lists local files pulled out of UnmatchedLocal by
+	// SkipOutOfRange because the listing left out older Dropbox files.
+	OutOfRange []string
+}
+
+// ScanOptions controls how ScanLocal walks the local directory.
+type ScanOptions struct {
+	// MaxDepth limits how many directory levels below the root are scanned.
+	// Files directly in the root are at depth 0. Zero means unlimited.
+	MaxDepth int
+	// OnSkip, if non-nil, is called for each entry skipped because it vanished
+	// or could not be read mid-scan (e.g. while Dropbox is still syncing).
+	OnSkip func(path string, err error)
+	// IncludeHidden scans dot-files and dot-directories, including macOS
+	// AppleDouble "._name" resource forks, which are skipped by default.
+	IncludeHidden bool
+	// Concurrency above 1 lists that many directories at once, which speeds up
+	// scans of network-mounted libraries. Results are sorted into the order of a
+	// serial scan, and OnSkip is never called concurrently.
+	Concurrency int
+
+	// walkDir replaces filepath.WalkDir for serial scans, so tests can
+	// simulate entries changing mid-scan.
+	walkDir func(root string, fn fs.WalkDirFunc) error
+	// readDir replaces os.ReadDir for parallel scans, so tests can simulate
+	// slow or failing directories.
+	readDir func(name string) ([]os.DirEntry, error)
+}
+
+// Includes reports whether a scan with these options picks up the file at rel,
+// a slash-separated path relative to the scanned root: it must lie within
+// MaxDepth and, unless IncludeHidden, neither it nor a folder above it may be
+// hidden. It lets files known only from elsewhere follow the same rules.
+func (o ScanOptions) Includes(rel string) bool {
+	parts := strings.Split(rel, "/")
+	if o.MaxDepth > 0 && len(parts)-1 > o.MaxDepth {
+		return false
+	}
+	if !o.IncludeHidden {
+		for _, part := range parts {
+			if isHidden(part) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // ScanLocal walks the directory recursively and returns paths of audio files.
-func ScanLocal(dir string) ([]string, error) {
+// Entries below dir that disappear or are unreadable during the walk are skipped;
+// an error on dir itself still fails the scan.
+func ScanLocal(dir string, opts ScanOptions) ([]string, error) {
+	files, _, err := ScanLocalStats(dir, opts)
+	return files, err
+}
+
+// ScanStats describes the non-audio files a scan passed over, and which audio
+// files are symlinks.
+type ScanStats struct {
+	// SkippedExtensions counts skipped files by lowercase extension ("" for none).
+	SkippedExtensions map[string]int
+	// Symlinks holds the audio files found that are symlinks, for
+	// MatchOptions.Symlinks. It is nil when there are none.
+	Symlinks map[string]bool
+}
+
+// ExtensionCount is a file extension and how many files had it.
+type ExtensionCount struct {
+	Ext   string
+	Count int
+}
+
+// TopSkipped returns up to n skipped extensions, most frequent first
+// (ties broken alphabetically). n <= 0 returns all of them.
+func (s ScanStats) TopSkipped(n int) []ExtensionCount {
+	counts := make([]ExtensionCount, 0, len(s.SkippedExtensions))
+	for ext, c := range s.SkippedExtensions {
+		counts = append(counts, ExtensionCount{Ext: ext, Count: c})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Ext < counts[j].Ext
+	})
+	if n > 0 && len(counts) > n {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// ScanLocalStats is like ScanLocal but also counts the non-audio files it skipped,
+// so users can spot formats the tool ignores. Hidden files are not counted.
+func ScanLocalStats(dir string, opts ScanOptions) ([]string, ScanStats, error) {
 	var files []string
+	stats := ScanStats{SkippedExtensions: make(map[string]int)}
 
-	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+	walk := opts.walkDir
+	if walk == nil {
+		walk = filepath.WalkDir
+	}
+	if opts.Concurrency > 1 {
+		walk = func(root string, fn fs.WalkDirFunc) error {
+			return walkDirParallel(root, opts.Concurrency, opts.readDir, fn)
+		}
+	}
+	err := walk(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
-			return err
+			if path == dir || !isTransientScanError(err) {
+				return err
+			}
+			if opts.OnSkip != nil {
+				opts.OnSkip(path, err)
+			}
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !opts.IncludeHidden && path != dir && isHidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
 		}
 		if d.IsDir() {
+			if opts.MaxDepth > 0 && path != dir && dirDepth(dir, path) > opts.MaxDepth {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 		ext := strings.ToLower(filepath.Ext(path))
 		if audioExtensions[ext] {
 			files = append(files, path)
+			if d.Type()&fs.ModeSymlink != 0 {
+				if stats.Symlinks == nil {
+					stats.Symlinks = make(map[string]bool)
+				}
+				stats.Symlinks[path] = true
+			}
+		} else {
+			stats.SkippedExtensions[ext]++
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, ScanStats{}, err
+	}
+	if opts.Concurrency > 1 {
+		sortWalkOrder(files)
+	}
+
+	return files, stats, nil
+}
+
+// isHidden reports whether name is a dot-file, which covers AppleDouble "._" forks.
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// isTransientScanError reports whether err on a single entry should be skipped
+// rather than abort the scan: the entry vanished or is not readable.
+func isTransientScanError(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission)
+}
+
+// matchKey builds the lookup key for a local path relative to the scanned directory,
+// comparable with Dropbox's path_lower: lowercase(remotePrefix/NFC(rel)) with forward slashes.
+// remotePrefix must already be lowercase.
+func matchKey(remotePrefix, rel string) string {
+	return keyWithSeparator(remotePrefix, rel, filepath.Separator)
+}
+
+// keyWithSeparator is matchKey for a rel using sep between path elements, so
+// Windows relative paths ("Artist\Album\01.mp3") can be checked on any OS.
+// Only sep is rewritten: on Unix a backslash is an ordinary filename character.
+func keyWithSeparator(remotePrefix, rel string, sep rune) string {
+	if sep != '/' {
+		rel = strings.ReplaceAll(rel, string(sep), "/")
+	}
+	// NFC normalize the local relative path (macOS uses NFD)
+	return remotePrefix + "/" + strings.ToLower(norm.NFC.String(rel))
+}
+
+// dirDepth returns how many levels path is below root (a direct child is 1).
+func dirDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// MatchMode selects how local files are paired with Dropbox entries.
+type MatchMode string
+
+// Supported match modes.
+const (
+	// MatchByPath pairs files by their path relative to the scanned folder.
+	MatchByPath MatchMode = "path"
+	// MatchByFilename pairs files by basename only, ignoring folder structure.
+	MatchByFilename MatchMode = "filename"
+)
+
+// ParseMatchMode validates s as a MatchMode.
+func ParseMatchMode(s string) (MatchMode, error) {
+	switch m := MatchMode(s); m {
+	case MatchByPath, MatchByFilename:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown match mode %q (want path or filename)", s)
 	}
+}
 
-	return files, nil
+// MatchOptions controls how Match pairs local files with Dropbox entries.
+type MatchOptions struct {
+	// Mode defaults to MatchByPath when empty.
+	Mode MatchMode
+	// ExtraRemotePaths are further Dropbox prefixes the local folder maps to
+	// (e.g. a shared folder listed separately). In MatchByPath mode each local
+	// file is looked up under remotePath first, then under each of these in order.
+	ExtraRemotePaths []string
+	// Transform, if set, rewrites each local file's path relative to the scanned
+	// folder before it is looked up, for layouts that differ from Dropbox in ways
+	// no mode covers (e.g. stripping a "FLAC/" level). It receives and returns a
+	// slash-separated path; in MatchByFilename mode only the base name of the
+	// result counts. Returning "" leaves the file unmatched.
+	Transform func(relPath string) string
+	// DropboxRoot, if set, is the local Dropbox folder. In MatchByPath mode,
+	// the local files in Symlinks are then looked up by their target's path
+	// below it rather than their own, without Transform. A symlink pointing
+	// outside DropboxRoot, or to a file also matched directly, is left unmatched.
+	DropboxRoot string
+	// Symlinks holds the local files that are symlinks, as ScanStats.Symlinks
+	// reports them. Only these are resolved, so matching does not stat every file.
+	Symlinks map[string]bool
 }
 
-// Match matches local files against Dropbox entries by relative path.
+// Conflict is a local file whose basename is ambiguous in MatchByFilename mode:
+// several Dropbox entries, or several local files, share it.
+type Conflict struct {
+	LocalPath  string
+	Candidates []dropbox.Entry
+}
+
+// Match matches local files against Dropbox entries by relative path, or by
+// basename when opts.Mode is MatchByFilename.
 // remotePath is the Dropbox remote path prefix (e.g. "/Music" or "" for root).
 // localDir is the local directory that was scanned.
-func Match(localDir, remotePath string, localFiles []string, entries []dropbox.Entry) ScanResult {
+func Match(localDir, remotePath string, localFiles []string, entries []dropbox.Entry, opts MatchOptions) ScanResult {
+	if opts.Mode == MatchByFilename {
+		return matchByFilename(localDir, localFiles, entries, opts.Transform)
+	}
+
 	// Build lookup from Dropbox entries: lowercase path → entry
 	dbLookup := make(map[string]dropbox.Entry, len(entries))
 	for _, e := range entries {
@@ -84,40 +325,163 @@ func Match(localDir, remotePath string, localFiles []string, entries []dropbox.E
 	matched := make(map[string]bool) // tracks which Dropbox paths were matched
 	var result ScanResult
 
-	remotePrefix := strings.ToLower(remotePath)
+	remotePrefixes := make([]string, 0, 1+len(opts.ExtraRemotePaths))
+	remotePrefixes = append(remotePrefixes, strings.ToLower(remotePath))
+	for _, p := range opts.ExtraRemotePaths {
+		remotePrefixes = append(remotePrefixes, strings.ToLower(p))
+	}
+
+	var dropboxRoot string
+	if opts.DropboxRoot != "" {
+		dropboxRoot = resolveRoot(opts.DropboxRoot)
+	}
+
+	// Find every file's key first, so a symlink can give way to the file it points to
+	keys := make([]string, len(localFiles)) // "" when the file has no match
+	links := make([]bool, len(localFiles))
+	direct := make(map[string]bool) // keys matched by files that are not symlinks
+	for i, localPath := range localFiles {
+		if dropboxRoot != "" && opts.Symlinks[localPath] {
+			links[i] = true
+			if key := symlinkKey(dropboxRoot, localPath); key != "" {
+				if _, found := dbLookup[key]; found {
+					keys[i] = key
+				}
+			}
+			continue
+		}
 
-	for _, localPath := range localFiles {
 		rel, err := filepath.Rel(localDir, localPath)
-		if err != nil {
+		if err == nil && opts.Transform != nil {
+			rel = filepath.FromSlash(opts.Transform(filepath.ToSlash(rel)))
+		}
+		if err != nil || rel == "" {
+			continue
+		}
+		for _, prefix := range remotePrefixes {
+			key := matchKey(prefix, rel)
+			if _, found := dbLookup[key]; found {
+				keys[i] = key
+				direct[key] = true
+				break
+			}
+		}
+	}
+
+	for i, localPath := range localFiles {
+		key := keys[i]
+		if key == "" || (links[i] && (direct[key] || matched[key])) {
 			result.UnmatchedLocal = append(result.UnmatchedLocal, localPath)
 			continue
 		}
+		result.Matched = append(result.Matched, MatchedFile{
+			LocalPath: localPath,
+			Entry:     dbLookup[key],
+		})
+		matched[key] = true
+	}
+
+	result.UnmatchedDropbox = unmatchedAudio(entries, matched)
+	return result
+}
+
+// resolveRoot resolves symlinks in the Dropbox folder path, as they are resolved
+// in symlink targets, falling back to the cleaned path.
+func resolveRoot(root string) string {
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		return resolved
+	}
+	return filepath.Clean(root)
+}
+
+// symlinkKey returns the lookup key of the target of the symlink localPath,
+// relative to dropboxRoot (already resolved). It is "" when the target cannot
+// be resolved or lies outside dropboxRoot.
+func symlinkKey(dropboxRoot, localPath string) string {
+	target, err := filepath.EvalSymlinks(localPath)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(dropboxRoot, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+	return matchKey("", rel)
+}
+
+// nameKey is the MatchByFilename lookup key: the lowercased, NFC-normalized basename.
+func nameKey(name string) string {
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// localNameKey is the MatchByFilename key of localPath: its basename, or that
+// of its transformed path below localDir. It is "" if the transform drops it.
+func localNameKey(localDir, localPath string, transform func(string) string) string {
+	if transform == nil {
+		return nameKey(filepath.Base(localPath))
+	}
+	rel, err := filepath.Rel(localDir, localPath)
+	if err != nil {
+		return nameKey(filepath.Base(localPath))
+	}
+	rel = transform(filepath.ToSlash(rel))
+	if rel == "" {
+		return ""
+	}
+	return nameKey(path.Base(rel))
+}
+
+// matchByFilename pairs local files with Dropbox entries sharing their basename.
+// Ambiguous basenames are reported as conflicts instead of being matched arbitrarily.
+func matchByFilename(localDir string, localFiles []string, entries []dropbox.Entry, transform func(string) string) ScanResult {
+	byName := make(map[string][]dropbox.Entry, len(entries))
+	for _, e := range entries {
+		key := nameKey(e.Name)
+		byName[key] = append(byName[key], e)
+	}
+
+	keys := make([]string, len(localFiles))
+	localCount := make(map[string]int, len(localFiles))
+	for i, localPath := range localFiles {
+		keys[i] = localNameKey(localDir, localPath, transform)
+		localCount[keys[i]]++
+	}
+
+	matched := make(map[string]bool) // tracks which Dropbox paths were matched
+	var result ScanResult
 
-		// NFC normalize the local relative path (macOS uses NFD)
-		nfcRel := norm.NFC.String(rel)
-		// Build the lookup key: lowercase(remotePath/nfcRel) with forward slashes
-		key := remotePrefix + "/" + strings.ToLower(filepath.ToSlash(nfcRel))
+	for i, localPath := range localFiles {
+		key := keys[i]
+		candidates := byName[key]
 
-		if entry, ok := dbLookup[key]; ok {
+		switch {
+		case key == "" || len(candidates) == 0:
+			result.UnmatchedLocal = append(result.UnmatchedLocal, localPath)
+		case len(candidates) > 1 || localCount[key] > 1:
+			result.Conflicts = append(result.Conflicts, Conflict{
+				LocalPath:  localPath,
+				Candidates: candidates,
+			})
+		default:
 			result.Matched = append(result.Matched, MatchedFile{
 				LocalPath: localPath,
-				Entry:     entry,
+				Entry:     candidates[0],
 			})
-			matched[key] = true
-		} else {
-			result.UnmatchedLocal = append(result.UnmatchedLocal, localPath)
+			matched[candidates[0].PathLower] = true
 		}
 	}
 
-	// Find unmatched Dropbox entries (audio files only)
-	for key, entry := range dbLookup {
-		if !matched[key] {
-			ext := strings.ToLower(filepath.Ext(entry.Name))
-			if audioExtensions[ext] {
-				result.UnmatchedDropbox = append(result.UnmatchedDropbox, entry)
-			}
+	result.UnmatchedDropbox = unmatchedAudio(entries, matched)
+	return result
+}
+
+// unmatchedAudio returns the audio entries whose path_lower is not in matched.
+func unmatchedAudio(entries []dropbox.Entry, matched map[string]bool) []dropbox.Entry {
+	var unmatched []dropbox.Entry
+	for _, entry := range entries {
+		if !matched[entry.PathLower] && IsAudioFile(entry.Name) {
+			unmatched = append(unmatched, entry)
 		}
 	}
-
-	return result
+	return unmatched
 }
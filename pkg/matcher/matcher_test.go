@@ -1,6 +1,12 @@
 package matcher
 
 import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -21,7 +27,7 @@ func TestMatch_CaseInsensitive(t *testing.T) {
 		{Tag: "file", Name: "Song.MP3", PathLower: "/music/song.mp3", PathDisplay: "/Music/Song.MP3"},
 	}
 
-	result := Match(localDir, remotePath, localFiles, entries)
+	result := Match(localDir, remotePath, localFiles, entries, MatchOptions{})
 
 	require.Len(t, result.Matched, 1)
 	assert.Empty(t, result.UnmatchedLocal)
@@ -43,11 +49,35 @@ func TestMatch_NFCNormalization(t *testing.T) {
 		{Tag: "file", Name: nfcName, PathLower: "/music/" + nfcName, PathDisplay: "/Music/" + nfcName},
 	}
 
-	result := Match(localDir, remotePath, localFiles, entries)
+	result := Match(localDir, remotePath, localFiles, entries, MatchOptions{})
 
 	require.Len(t, result.Matched, 1)
 }
 
+func TestKeyWithSeparator(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		prefix string
+		rel    string
+		sep    rune
+		want   string
+	}{
+		{"windows nested", "/music", `Artist\Album\01 Track.MP3`, '\\', "/music/artist/album/01 track.mp3"},
+		{"windows root prefix", "", `Artist\Song.flac`, '\\', "/artist/song.flac"},
+		{"windows nfd", "/music", `Bj` + norm.NFD.String("\u00f6") + `rk\Caf` + norm.NFD.String("\u00e9") + `.mp3`, '\\', "/music/bj\u00f6rk/caf\u00e9.mp3"},
+		{"unix nested", "/music", "Artist/Album/01.mp3", '/', "/music/artist/album/01.mp3"},
+		{"unix keeps backslash", "/music", `AC\DC/Back.mp3`, '/', `/music/ac\dc/back.mp3`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.want, keyWithSeparator(test.prefix, test.rel, test.sep))
+		})
+	}
+}
+
 func TestMatch_UnmatchedFilterAudioOnly(t *testing.T) {
 	t.Parallel()
 
@@ -60,12 +90,277 @@ func TestMatch_UnmatchedFilterAudioOnly(t *testing.T) {
 		{Tag: "file", Name: ".DS_Store", PathLower: "/music/.ds_store", PathDisplay: "/Music/.DS_Store"},
 	}
 
-	result := Match(localDir, remotePath, nil, entries)
+	result := Match(localDir, remotePath, nil, entries, MatchOptions{})
 
 	require.Len(t, result.UnmatchedDropbox, 1)
 	assert.Equal(t, "song.mp3", result.UnmatchedDropbox[0].Name)
 }
 
+func TestMatch_ExtraRemotePaths(t *testing.T) {
+	t.Parallel()
+
+	localFiles := []string{
+		"/music/Rock/a.mp3",
+		"/music/Jazz/b.mp3",
+		"/music/Both/c.mp3",
+		"/music/Nowhere/d.mp3",
+	}
+	entries := []dropbox.Entry{
+		// Personal folder listing
+		{Tag: "file", ID: "id:a", Name: "a.mp3", PathLower: "/music/rock/a.mp3"},
+		{Tag: "file", ID: "id:c1", Name: "c.mp3", PathLower: "/music/both/c.mp3"},
+		// Shared folder listing
+		{Tag: "file", ID: "id:b", Name: "b.mp3", PathLower: "/shared music/jazz/b.mp3"},
+		{Tag: "file", ID: "id:c2", Name: "c.mp3", PathLower: "/shared music/both/c.mp3"},
+	}
+
+	result := Match("/music", "/Music", localFiles, entries, MatchOptions{ExtraRemotePaths: []string{"/Shared Music"}})
+
+	got := make(map[string]string, len(result.Matched))
+	for _, m := range result.Matched {
+		got[m.LocalPath] = m.Entry.ID
+	}
+	assert.Equal(t, map[string]string{
+		"/music/Rock/a.mp3": "id:a",
+		"/music/Jazz/b.mp3": "id:b",
+		"/music/Both/c.mp3": "id:c1", // remotePath wins over extra prefixes
+	}, got)
+	assert.Equal(t, []string{"/music/Nowhere/d.mp3"}, result.UnmatchedLocal)
+	require.Len(t, result.UnmatchedDropbox, 1)
+	assert.Equal(t, "id:c2", result.UnmatchedDropbox[0].ID)
+}
+
+func TestMatch_Symlinks(t *testing.T) {
+	t.Parallel()
+
+	// Dropbox/Music is scanned; Dropbox/Archive and outside/ are not
+	base := t.TempDir()
+	root := filepath.Join(base, "Dropbox")
+	music := filepath.Join(root, "Music")
+	for _, dir := range []string{music, filepath.Join(root, "Archive"), filepath.Join(base, "outside")} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+	for _, f := range []string{
+		filepath.Join(music, "real.mp3"),
+		filepath.Join(root, "Archive", "Old Song.mp3"),
+		filepath.Join(base, "outside", "elsewhere.mp3"),
+	} {
+		require.NoError(t, os.WriteFile(f, []byte("audio"), 0o644))
+	}
+	links := map[string]string{
+		"archived.mp3": filepath.Join(root, "Archive", "Old Song.mp3"),
+		"again.mp3":    filepath.Join(music, "real.mp3"),
+		"outside.mp3":  filepath.Join(base, "outside", "elsewhere.mp3"),
+		"dangling.mp3": filepath.Join(music, "gone.mp3"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(music, name)); err != nil {
+			t.Skipf("symlinks are not available: %v", err)
+		}
+	}
+
+	localFiles, stats, err := ScanLocalStats(music, ScanOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(music, "again.mp3"),
+		filepath.Join(music, "archived.mp3"),
+		filepath.Join(music, "dangling.mp3"),
+		filepath.Join(music, "outside.mp3"),
+		filepath.Join(music, "real.mp3"),
+	}, localFiles)
+	assert.Len(t, stats.Symlinks, len(links), "the scan records which files are symlinks")
+	assert.False(t, stats.Symlinks[filepath.Join(music, "real.mp3")])
+	entries := []dropbox.Entry{
+		{Tag: "file", ID: "id:real", Name: "real.mp3", PathLower: "/music/real.mp3"},
+		{Tag: "file", ID: "id:old", Name: "Old Song.mp3", PathLower: "/archive/old song.mp3"},
+		{Tag: "file", ID: "id:archived", Name: "archived.mp3", PathLower: "/music/archived.mp3"},
+		{Tag: "file", ID: "id:outside", Name: "outside.mp3", PathLower: "/music/outside.mp3"},
+	}
+
+	t.Run("resolved", func(t *testing.T) {
+		t.Parallel()
+
+		result := Match(music, "/Music", localFiles, entries, MatchOptions{DropboxRoot: root, Symlinks: stats.Symlinks})
+
+		got := make(map[string]string, len(result.Matched))
+		for _, m := range result.Matched {
+			got[filepath.Base(m.LocalPath)] = m.Entry.ID
+		}
+		assert.Equal(t, map[string]string{
+			"archived.mp3": "id:old", // the target's path, not the link's
+			"real.mp3":     "id:real",
+		}, got)
+		assert.Equal(t, []string{
+			filepath.Join(music, "again.mp3"), // the real file claims its entry
+			filepath.Join(music, "dangling.mp3"),
+			filepath.Join(music, "outside.mp3"), // the target is outside the Dropbox folder
+		}, result.UnmatchedLocal)
+	})
+
+	t.Run("only listed symlinks resolved", func(t *testing.T) {
+		t.Parallel()
+
+		result := Match(music, "/Music", localFiles, entries, MatchOptions{DropboxRoot: root})
+
+		got := make(map[string]string, len(result.Matched))
+		for _, m := range result.Matched {
+			got[filepath.Base(m.LocalPath)] = m.Entry.ID
+		}
+		assert.Equal(t, map[string]string{
+			"archived.mp3": "id:archived",
+			"outside.mp3":  "id:outside",
+			"real.mp3":     "id:real",
+		}, got)
+	})
+
+	t.Run("not resolved without DropboxRoot", func(t *testing.T) {
+		t.Parallel()
+
+		result := Match(music, "/Music", localFiles, entries, MatchOptions{})
+
+		got := make(map[string]string, len(result.Matched))
+		for _, m := range result.Matched {
+			got[filepath.Base(m.LocalPath)] = m.Entry.ID
+		}
+		assert.Equal(t, map[string]string{
+			"archived.mp3": "id:archived",
+			"outside.mp3":  "id:outside",
+			"real.mp3":     "id:real",
+		}, got)
+	})
+}
+
+func TestMatch_Transform(t *testing.T) {
+	t.Parallel()
+
+	// Local library keeps each album under a format folder; Dropbox does not.
+	localFiles := []string{
+		"/music/FLAC/Artist/Album/01.flac",
+		"/music/MP3/Artist/Album/02.mp3",
+		"/music/Scratch/draft.mp3",
+	}
+	entries := []dropbox.Entry{
+		{Tag: "file", ID: "id:1", Name: "01.flac", PathLower: "/music/artist/album/01.flac"},
+		{Tag: "file", ID: "id:2", Name: "02.mp3", PathLower: "/music/artist/album/02.mp3"},
+		{Tag: "file", ID: "id:3", Name: "draft.mp3", PathLower: "/music/scratch/draft.mp3"},
+	}
+	var seen []string
+	stripFormat := func(rel string) string {
+		seen = append(seen, rel)
+		if strings.HasPrefix(rel, "Scratch/") {
+			return ""
+		}
+		_, rest, _ := strings.Cut(rel, "/")
+		return rest
+	}
+
+	result := Match("/music", "/Music", localFiles, entries, MatchOptions{Transform: stripFormat})
+
+	got := make(map[string]string, len(result.Matched))
+	for _, m := range result.Matched {
+		got[m.LocalPath] = m.Entry.ID
+	}
+	assert.Equal(t, map[string]string{
+		"/music/FLAC/Artist/Album/01.flac": "id:1",
+		"/music/MP3/Artist/Album/02.mp3":   "id:2",
+	}, got)
+	assert.Equal(t, []string{"/music/Scratch/draft.mp3"}, result.UnmatchedLocal, "an empty transform result is left unmatched")
+	assert.Equal(t, []string{"FLAC/Artist/Album/01.flac", "MP3/Artist/Album/02.mp3", "Scratch/draft.mp3"}, seen,
+		"the transform sees slash-separated paths relative to localDir")
+
+	// Without a transform only the file outside a format folder matches.
+	result = Match("/music", "/Music", localFiles, entries, MatchOptions{})
+	require.Len(t, result.Matched, 1)
+	assert.Equal(t, "id:3", result.Matched[0].Entry.ID)
+}
+
+func TestMatch_TransformByFilename(t *testing.T) {
+	t.Parallel()
+
+	// Local copies carry a quality suffix the Dropbox names lack.
+	localFiles := []string{"/flat/intro [hq].mp3", "/flat/outro [hq].mp3", "/flat/skip.mp3"}
+	entries := []dropbox.Entry{
+		{Tag: "file", ID: "id:1", Name: "intro.mp3", PathLower: "/a/intro.mp3"},
+		{Tag: "file", ID: "id:2", Name: "outro.mp3", PathLower: "/b/outro.mp3"},
+		{Tag: "file", ID: "id:3", Name: "skip.mp3", PathLower: "/c/skip.mp3"},
+	}
+	transform := func(rel string) string {
+		if rel == "skip.mp3" {
+			return ""
+		}
+		return strings.Replace(rel, " [hq]", "", 1)
+	}
+
+	result := Match("/flat", "", localFiles, entries, MatchOptions{Mode: MatchByFilename, Transform: transform})
+
+	require.Len(t, result.Matched, 2)
+	assert.Equal(t, "id:1", result.Matched[0].Entry.ID)
+	assert.Equal(t, "id:2", result.Matched[1].Entry.ID)
+	assert.Equal(t, []string{"/flat/skip.mp3"}, result.UnmatchedLocal)
+	assert.Empty(t, result.Conflicts, "dropped files do not collide with each other")
+}
+
+func TestMatch_ByFilename(t *testing.T) {
+	t.Parallel()
+
+	// Flat local folder against a nested Dropbox layout.
+	localFiles := []string{"/flat/Intro.mp3", "/flat/outro.mp3", "/flat/bonus.mp3"}
+	entries := []dropbox.Entry{
+		{Tag: "file", ID: "id:1", Name: "intro.mp3", PathLower: "/music/artist/album/intro.mp3"},
+		{Tag: "file", ID: "id:2", Name: "Outro.mp3", PathLower: "/music/artist/album/outro.mp3"},
+		{Tag: "file", ID: "id:3", Name: "extra.mp3", PathLower: "/music/artist/extra.mp3"},
+	}
+
+	result := Match("/flat", "/Music", localFiles, entries, MatchOptions{Mode: MatchByFilename})
+
+	require.Len(t, result.Matched, 2)
+	assert.Equal(t, "id:1", result.Matched[0].Entry.ID)
+	assert.Equal(t, "id:2", result.Matched[1].Entry.ID)
+	assert.Equal(t, []string{"/flat/bonus.mp3"}, result.UnmatchedLocal)
+	require.Len(t, result.UnmatchedDropbox, 1)
+	assert.Equal(t, "id:3", result.UnmatchedDropbox[0].ID)
+	assert.Empty(t, result.Conflicts)
+}
+
+func TestMatch_ByFilenameAmbiguous(t *testing.T) {
+	t.Parallel()
+
+	localFiles := []string{"/flat/01.mp3", "/flat/a/track.mp3", "/flat/b/track.mp3"}
+	entries := []dropbox.Entry{
+		{Tag: "file", ID: "id:1", Name: "01.mp3", PathLower: "/music/album a/01.mp3"},
+		{Tag: "file", ID: "id:2", Name: "01.mp3", PathLower: "/music/album b/01.mp3"},
+		{Tag: "file", ID: "id:3", Name: "track.mp3", PathLower: "/music/track.mp3"},
+	}
+
+	result := Match("/flat", "/Music", localFiles, entries, MatchOptions{Mode: MatchByFilename})
+
+	assert.Empty(t, result.Matched)
+	assert.Empty(t, result.UnmatchedLocal)
+	require.Len(t, result.Conflicts, 3)
+
+	// Two Dropbox files share the local basename.
+	assert.Equal(t, "/flat/01.mp3", result.Conflicts[0].LocalPath)
+	assert.Len(t, result.Conflicts[0].Candidates, 2)
+
+	// Two local files share the basename of a single Dropbox file.
+	assert.Equal(t, "/flat/a/track.mp3", result.Conflicts[1].LocalPath)
+	assert.Equal(t, "/flat/b/track.mp3", result.Conflicts[2].LocalPath)
+	assert.Len(t, result.Conflicts[1].Candidates, 1)
+
+	assert.Len(t, result.UnmatchedDropbox, 3)
+}
+
+func TestParseMatchMode(t *testing.T) {
+	t.Parallel()
+
+	mode, err := ParseMatchMode("filename")
+	require.NoError(t, err)
+	assert.Equal(t, MatchByFilename, mode)
+
+	_, err = ParseMatchMode("name")
+	require.Error(t, err)
+}
+
 func TestIsAudioFile(t *testing.T) {
 	t.Parallel()
 
@@ -79,6 +374,7 @@ func TestIsAudioFile(t *testing.T) {
 		{"jpg", "cover.jpg", false},
 		{"no extension", "README", false},
 		{"flac", "track.flac", true},
+		{"m4b audiobook", "book.m4b", true},
 	}
 
 	for _, test := range tests {
@@ -89,3 +385,207 @@ func TestIsAudioFile(t *testing.T) {
 		})
 	}
 }
+
+func TestScanLocal_MaxDepth(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	rels := []string{
+		"root.mp3",
+		"cover.jpg",
+		"a/one.mp3",
+		"a/b/two.mp3",
+		"a/b/c/three.mp3",
+	}
+	for _, rel := range rels {
+		path := filepath.Join(root, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		want     []string
+	}{
+		{"unlimited", 0, []string{"a/b/c/three.mp3", "a/b/two.mp3", "a/one.mp3", "root.mp3"}},
+		{"depth 1", 1, []string{"a/one.mp3", "root.mp3"}},
+		{"depth 2", 2, []string{"a/b/two.mp3", "a/one.mp3", "root.mp3"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := ScanOptions{MaxDepth: test.maxDepth}
+			files, err := ScanLocal(root, opts)
+			require.NoError(t, err)
+
+			got := make([]string, len(files))
+			for i, f := range files {
+				rel, err := filepath.Rel(root, f)
+				require.NoError(t, err)
+				got[i] = filepath.ToSlash(rel)
+			}
+			assert.Equal(t, test.want, got)
+
+			for _, rel := range rels {
+				if IsAudioFile(rel) {
+					assert.Equal(t, slices.Contains(test.want, rel), opts.Includes(rel), rel)
+				}
+			}
+		})
+	}
+}
+
+func TestScanLocal_Hidden(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	rels := []string{
+		"track.mp3",
+		"._track.mp3",
+		".hidden.flac",
+		"Album/song.mp3",
+		"Album/._song.mp3",
+		".Trash/deleted.mp3",
+	}
+	for _, rel := range rels {
+		path := filepath.Join(root, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	tests := []struct {
+		name          string
+		includeHidden bool
+		want          []string
+	}{
+		{"hidden skipped by default", false, []string{"Album/song.mp3", "track.mp3"}},
+		{"include hidden", true, []string{
+			".Trash/deleted.mp3", "._track.mp3", ".hidden.flac",
+			"Album/._song.mp3", "Album/song.mp3", "track.mp3",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := ScanOptions{IncludeHidden: test.includeHidden}
+			files, err := ScanLocal(root, opts)
+			require.NoError(t, err)
+
+			got := make([]string, len(files))
+			for i, f := range files {
+				rel, err := filepath.Rel(root, f)
+				require.NoError(t, err)
+				got[i] = filepath.ToSlash(rel)
+			}
+			assert.Equal(t, test.want, got)
+
+			for _, rel := range rels {
+				if IsAudioFile(rel) {
+					assert.Equal(t, slices.Contains(test.want, rel), opts.Includes(rel), rel)
+				}
+			}
+		})
+	}
+}
+
+func TestScanLocalStats(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, rel := range []string{
+		"a.mp3",
+		"cover.jpg",
+		"Album/back.JPG",
+		"Album/booklet.pdf",
+		"Album/old.mp2",
+		"Album/old2.mp2",
+		"README",
+		"._a.mp3",
+	} {
+		path := filepath.Join(root, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	files, stats, err := ScanLocalStats(root, ScanOptions{})
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, map[string]int{".jpg": 2, ".mp2": 2, ".pdf": 1, "": 1}, stats.SkippedExtensions)
+
+	assert.Equal(t, []ExtensionCount{{".jpg", 2}, {".mp2", 2}}, stats.TopSkipped(2))
+	assert.Len(t, stats.TopSkipped(0), 4)
+}
+
+func TestScanLocal_TransientErrors(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for _, rel := range []string{"a.mp3", "gone.mp3", "locked/b.mp3", "z.mp3"} {
+		path := filepath.Join(root, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+	}
+
+	t.Run("entries are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		var skipped []string
+		files, err := ScanLocal(root, ScanOptions{
+			OnSkip: func(path string, _ error) {
+				skipped = append(skipped, filepath.Base(path))
+			},
+			walkDir: func(dir string, fn fs.WalkDirFunc) error {
+				return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+					switch filepath.Base(path) {
+					case "gone.mp3":
+						// Deleted between the directory listing and the visit
+						return fn(path, d, &fs.PathError{Op: "lstat", Path: path, Err: fs.ErrNotExist})
+					case "locked":
+						// Directory listing denied
+						if err := fn(path, d, nil); err != nil {
+							return err
+						}
+						return fn(path, d, &fs.PathError{Op: "open", Path: path, Err: fs.ErrPermission})
+					}
+					return fn(path, d, err)
+				})
+			},
+		})
+		require.NoError(t, err)
+
+		got := make([]string, len(files))
+		for i, f := range files {
+			got[i] = filepath.Base(f)
+		}
+		assert.Equal(t, []string{"a.mp3", "z.mp3"}, got)
+		assert.Equal(t, []string{"gone.mp3", "locked"}, skipped)
+	})
+
+	t.Run("root error fails", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ScanLocal(filepath.Join(root, "missing"), ScanOptions{})
+		require.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("other errors fail", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := ScanLocal(root, ScanOptions{
+			walkDir: func(dir string, fn fs.WalkDirFunc) error {
+				return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+					if filepath.Base(path) == "a.mp3" {
+						return fn(path, d, errors.New("i/o error"))
+					}
+					return fn(path, d, err)
+				})
+			},
+		})
+		require.EqualError(t, err, "i/o error")
+	})
+}
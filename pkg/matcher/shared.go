@@ -0,0 +1,35 @@
+package matcher
+
+// SkipShared moves matched files that live in a Dropbox shared folder from
+// r.Matched to r.Shared, and drops shared entries from r.UnmatchedDropbox, for
+// CloudBeats accounts that only see their owner's own files.
+func (r *ScanResult) SkipShared() {
+	kept := r.Matched[:0]
+	for _, mf := range r.Matched {
+		if mf.Entry.Shared() {
+			r.Shared = append(r.Shared, mf)
+			continue
+		}
+		kept = append(kept, mf)
+	}
+	r.Matched = kept
+
+	unmatched := r.UnmatchedDropbox[:0]
+	for _, e := range r.UnmatchedDropbox {
+		if !e.Shared() {
+			unmatched = append(unmatched, e)
+		}
+	}
+	r.UnmatchedDropbox = unmatched
+}
+
+// CountShared returns how many matched files live in a shared folder.
+func (r *ScanResult) CountShared() int {
+	n := 0
+	for _, mf := range r.Matched {
+		if mf.Entry.Shared() {
+			n++
+		}
+	}
+	return n
+}
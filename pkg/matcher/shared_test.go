@@ -0,0 +1,31 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+)
+
+func TestSkipShared(t *testing.T) {
+	t.Parallel()
+
+	shared := &dropbox.SharingInfo{ParentSharedFolderID: "84528192421"}
+	own := MatchedFile{LocalPath: "/local/own.mp3", Entry: dropbox.Entry{ID: "id:1"}}
+	theirs := MatchedFile{LocalPath: "/local/shared/theirs.mp3", Entry: dropbox.Entry{ID: "id:2", SharingInfo: shared}}
+	remoteOwn := dropbox.Entry{ID: "id:3"}
+	remoteShared := dropbox.Entry{ID: "id:4", SharingInfo: shared}
+
+	r := ScanResult{
+		Matched:          []MatchedFile{own, theirs},
+		UnmatchedDropbox: []dropbox.Entry{remoteOwn, remoteShared},
+	}
+	assert.Equal(t, 1, r.CountShared())
+
+	r.SkipShared()
+	assert.Equal(t, []MatchedFile{own}, r.Matched)
+	assert.Equal(t, []MatchedFile{theirs}, r.Shared)
+	assert.Equal(t, []dropbox.Entry{remoteOwn}, r.UnmatchedDropbox)
+	assert.Zero(t, r.CountShared())
+}
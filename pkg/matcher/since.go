@@ -0,0 +1,23 @@
+package matcher
+
+import (
+	"os"
+	"time"
+)
+
+// SkipOutOfRange moves the local files modified before cutoff from
+// r.UnmatchedLocal to r.OutOfRange, for a Dropbox listing filtered by
+// modification date: those files are expected to have no match there, so they
+// are not unmatched. Files modified since, or that cannot be stat'ed, stay
+// unmatched.
+func (r *ScanResult) SkipOutOfRange(cutoff time.Time) {
+	kept := r.UnmatchedLocal[:0]
+	for _, path := range r.UnmatchedLocal {
+		if info, err := os.Stat(path); err == nil && info.ModTime().Before(cutoff) {
+			r.OutOfRange = append(r.OutOfRange, path)
+			continue
+		}
+		kept = append(kept, path)
+	}
+	r.UnmatchedLocal = kept
+}
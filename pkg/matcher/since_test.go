@@ -0,0 +1,41 @@
+package matcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkipOutOfRange(t *testing.T) {
+	t.Parallel()
+
+	cutoff := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	old := filepath.Join(dir, "old.mp3")
+	older := filepath.Join(dir, "older.mp3")
+	recent := filepath.Join(dir, "recent.mp3")
+	for path, mtime := range map[string]time.Time{
+		old:    cutoff.Add(-time.Hour),
+		older:  cutoff.AddDate(-1, 0, 0),
+		recent: cutoff.Add(time.Hour),
+	} {
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+	missing := filepath.Join(dir, "missing.mp3")
+
+	matched := []MatchedFile{{LocalPath: filepath.Join(dir, "new.mp3")}}
+	r := ScanResult{
+		Matched:        matched,
+		UnmatchedLocal: []string{old, older, recent, missing},
+	}
+
+	r.SkipOutOfRange(cutoff)
+	assert.Equal(t, []string{recent, missing}, r.UnmatchedLocal, "changed since the cutoff yet missing from Dropbox")
+	assert.Equal(t, []string{old, older}, r.OutOfRange)
+	assert.Equal(t, matched, r.Matched)
+}
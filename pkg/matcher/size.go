@@ -0,0 +1,45 @@
+package matcher
+
+import "os"
+
+// SizeMismatch is a matched file whose local size differs from its Dropbox entry.
+type SizeMismatch struct {
+	LocalPath  string
+	LocalSize  int64
+	RemoteSize int64
+}
+
+// CheckSizes compares each matched file's local size with its Dropbox entry and
+// moves mismatches from r.Matched to r.SizeMismatches. A mismatch usually means a
+// partial download or a file Dropbox is still syncing, whose tags and duration
+// cannot be trusted yet. Files that cannot be stat'ed are left matched: reading
+// their tags reports the error.
+func (r *ScanResult) CheckSizes() {
+	r.CheckSizesAgainst(func(path string) (int64, bool) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size(), true
+	})
+}
+
+// CheckSizesAgainst is like CheckSizes but takes each local size from size
+// instead of the disk, e.g. as a manifest recorded it. Files whose size is
+// unknown are left matched.
+func (r *ScanResult) CheckSizesAgainst(size func(path string) (int64, bool)) {
+	kept := r.Matched[:0]
+	for _, mf := range r.Matched {
+		local, ok := size(mf.LocalPath)
+		if !ok || local == mf.Entry.Size {
+			kept = append(kept, mf)
+			continue
+		}
+		r.SizeMismatches = append(r.SizeMismatches, SizeMismatch{
+			LocalPath:  mf.LocalPath,
+			LocalSize:  local,
+			RemoteSize: mf.Entry.Size,
+		})
+	}
+	r.Matched = kept
+}
@@ -0,0 +1,55 @@
+package matcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/dropbox"
+)
+
+func TestCheckSizes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	complete := filepath.Join(dir, "complete.flac")
+	partial := filepath.Join(dir, "partial.flac")
+	missing := filepath.Join(dir, "missing.flac")
+	require.NoError(t, os.WriteFile(complete, make([]byte, 100), 0o644))
+	require.NoError(t, os.WriteFile(partial, make([]byte, 40), 0o644))
+
+	result := ScanResult{Matched: []MatchedFile{
+		{LocalPath: complete, Entry: dropbox.Entry{Size: 100}},
+		{LocalPath: partial, Entry: dropbox.Entry{Size: 100}},
+		{LocalPath: missing, Entry: dropbox.Entry{Size: 100}},
+	}}
+	result.CheckSizes()
+
+	require.Len(t, result.Matched, 2)
+	assert.Equal(t, complete, result.Matched[0].LocalPath)
+	assert.Equal(t, missing, result.Matched[1].LocalPath)
+	assert.Equal(t, []SizeMismatch{{LocalPath: partial, LocalSize: 40, RemoteSize: 100}}, result.SizeMismatches)
+}
+
+func TestCheckSizesAgainst(t *testing.T) {
+	t.Parallel()
+
+	recorded := map[string]int64{"/music/same.flac": 100, "/music/stale.flac": 90}
+	result := ScanResult{Matched: []MatchedFile{
+		{LocalPath: "/music/same.flac", Entry: dropbox.Entry{Size: 100}},
+		{LocalPath: "/music/stale.flac", Entry: dropbox.Entry{Size: 100}},
+		{LocalPath: "/music/unrecorded.flac", Entry: dropbox.Entry{Size: 100}},
+	}}
+	result.CheckSizesAgainst(func(path string) (int64, bool) {
+		size, ok := recorded[path]
+		return size, ok
+	})
+
+	require.Len(t, result.Matched, 2)
+	assert.Equal(t, "/music/same.flac", result.Matched[0].LocalPath)
+	assert.Equal(t, "/music/unrecorded.flac", result.Matched[1].LocalPath)
+	assert.Equal(t, []SizeMismatch{{LocalPath: "/music/stale.flac", LocalSize: 90, RemoteSize: 100}}, result.SizeMismatches)
+}
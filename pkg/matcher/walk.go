@@ -0,0 +1,118 @@
+package matcher
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// walkDirParallel is filepath.WalkDir with directory listings spread over up to
+// workers goroutines, for network mounts where each listing is a round trip. fn
+// sees the same calls as with WalkDir, in no particular order, but never two at
+// once, so it needs no locking of its own. fs.SkipDir works as with WalkDir;
+// fs.SkipAll is not supported. Directories are listed with readDir (os.ReadDir
+// if nil).
+func walkDirParallel(root string, workers int, readDir func(string) ([]os.DirEntry, error), fn fs.WalkDirFunc) error {
+	if readDir == nil {
+		readDir = os.ReadDir
+	}
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		w := &parallelWalker{fn: fn, readDir: readDir, sem: make(chan struct{}, workers-1)}
+		w.walk(root, fs.FileInfoToDirEntry(info))
+		w.wg.Wait()
+		err = w.err
+	}
+	if errors.Is(err, fs.SkipDir) {
+		return nil
+	}
+	return err
+}
+
+type parallelWalker struct {
+	fn      fs.WalkDirFunc
+	readDir func(string) ([]os.DirEntry, error)
+	sem     chan struct{} // one slot per extra goroutine
+	wg      sync.WaitGroup
+
+	mu  sync.Mutex // serializes fn and guards err
+	err error
+}
+
+// visit calls fn unless the walk has already failed, recording a failure.
+// It reports whether to continue with path (false for fs.SkipDir or an error).
+func (w *parallelWalker) visit(path string, d fs.DirEntry, err error) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return false
+	}
+	switch err := w.fn(path, d, err); {
+	case err == nil:
+		return true
+	case errors.Is(err, fs.SkipDir) && d != nil:
+		return false
+	default:
+		w.err = err
+		return false
+	}
+}
+
+func (w *parallelWalker) walk(path string, d fs.DirEntry) {
+	if !w.visit(path, d, nil) || !d.IsDir() {
+		return
+	}
+
+	entries, err := w.readDir(path)
+	if err != nil && !w.visit(path, d, err) {
+		return
+	}
+
+	for _, e := range entries {
+		child := filepath.Join(path, e.Name())
+		if !e.IsDir() {
+			if !w.visit(child, e, nil) {
+				// With WalkDir, SkipDir on a file skips the rest of its directory
+				return
+			}
+			continue
+		}
+		select {
+		case w.sem <- struct{}{}:
+			w.wg.Add(1)
+			go func() {
+				defer func() { <-w.sem; w.wg.Done() }()
+				w.walk(child, e)
+			}()
+		default:
+			// Every goroutine is busy: list this subtree here instead of waiting
+			w.walk(child, e)
+		}
+	}
+}
+
+// sortWalkOrder sorts paths into the order filepath.WalkDir visits them:
+// lexically by path element, so "a/b" comes before "a-c" as it does on disk.
+func sortWalkOrder(paths []string) {
+	keys := make([]string, len(paths))
+	for i, p := range paths {
+		keys[i] = strings.ReplaceAll(p, string(filepath.Separator), "\x00")
+	}
+	sort.Sort(walkOrder{paths, keys})
+}
+
+// walkOrder sorts paths by their precomputed keys.
+type walkOrder struct{ paths, keys []string }
+
+func (o walkOrder) Len() int           { return len(o.paths) }
+func (o walkOrder) Less(i, j int) bool { return o.keys[i] < o.keys[j] }
+func (o walkOrder) Swap(i, j int) {
+	o.paths[i], o.paths[j] = o.paths[j], o.paths[i]
+	o.keys[i], o.keys[j] = o.keys[j], o.keys[i]
+}
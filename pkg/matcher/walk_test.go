@@ -0,0 +1,159 @@
+package matcher
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTree creates an empty file at each of rels below a new temp dir.
+func makeTree(tb testing.TB, rels []string) string {
+	tb.Helper()
+	root := tb.TempDir()
+	for _, rel := range rels {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		require.NoError(tb, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(tb, os.WriteFile(path, nil, 0o644))
+	}
+	return root
+}
+
+func TestScanLocal_ParallelMatchesSerial(t *testing.T) {
+	t.Parallel()
+
+	rels := []string{
+		"root.mp3", "cover.jpg", ".hidden.mp3", "._root.mp3",
+		"a/b/1.flac", "a/b/c/d/deep.mp3", "a-c/2.flac", "a.b/3.ogg", "a/4.mp3",
+		".Trash/old.mp3", "Artist/Album/notes.txt",
+	}
+	for i := range 20 {
+		for j := range 5 {
+			rels = append(rels, fmt.Sprintf("Artist %02d/Album %d/%02d - Track.mp3", i, j%2, j))
+		}
+	}
+	root := makeTree(t, rels)
+
+	for _, opts := range []ScanOptions{{}, {MaxDepth: 2}, {IncludeHidden: true}} {
+		serialFiles, serialStats, err := ScanLocalStats(root, opts)
+		require.NoError(t, err)
+		require.NotEmpty(t, serialFiles)
+
+		for _, concurrency := range []int{2, 4, 32} {
+			t.Run(fmt.Sprintf("%+v/concurrency=%d", opts, concurrency), func(t *testing.T) {
+				t.Parallel()
+
+				parallel := opts
+				parallel.Concurrency = concurrency
+				files, stats, err := ScanLocalStats(root, parallel)
+				require.NoError(t, err)
+				assert.Equal(t, serialFiles, files, "same files in the same order")
+				assert.Equal(t, serialStats, stats)
+			})
+		}
+	}
+}
+
+func TestScanLocal_ParallelRootErrors(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	_, err := ScanLocal(filepath.Join(root, "missing"), ScanOptions{Concurrency: 4})
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	file := filepath.Join(root, "song.mp3")
+	require.NoError(t, os.WriteFile(file, nil, 0o644))
+	files, err := ScanLocal(file, ScanOptions{Concurrency: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []string{file}, files, "like WalkDir, a file root is visited itself")
+}
+
+func TestScanLocal_ParallelTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	root := makeTree(t, []string{"a.mp3", "locked/b.mp3", "open/c.mp3", "open/sub/d.mp3"})
+
+	var skipped []string
+	files, err := ScanLocal(root, ScanOptions{
+		Concurrency: 4,
+		OnSkip: func(path string, _ error) {
+			skipped = append(skipped, filepath.Base(path))
+		},
+		readDir: func(name string) ([]os.DirEntry, error) {
+			if filepath.Base(name) == "locked" {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+			}
+			return os.ReadDir(name)
+		},
+	})
+	require.NoError(t, err)
+
+	got := make([]string, len(files))
+	for i, f := range files {
+		got[i] = filepath.ToSlash(f[len(root)+1:])
+	}
+	assert.Equal(t, []string{"a.mp3", "open/c.mp3", "open/sub/d.mp3"}, got)
+	assert.Equal(t, []string{"locked"}, skipped)
+
+	_, err = ScanLocal(root, ScanOptions{
+		Concurrency: 4,
+		readDir: func(name string) ([]os.DirEntry, error) {
+			if filepath.Base(name) == "sub" {
+				return nil, fmt.Errorf("i/o error")
+			}
+			return os.ReadDir(name)
+		},
+	})
+	require.EqualError(t, err, "i/o error")
+}
+
+func TestSortWalkOrder(t *testing.T) {
+	t.Parallel()
+
+	sep := string(filepath.Separator)
+	paths := []string{"a-c" + sep + "x", "a" + sep + "z", "a.b", "a" + sep + "b" + sep + "y", "B"}
+	sortWalkOrder(paths)
+	assert.Equal(t, []string{"B", "a" + sep + "b" + sep + "y", "a" + sep + "z", "a-c" + sep + "x", "a.b"}, paths)
+}
+
+// BenchmarkScanLocal compares serial and parallel scans, with and without a
+// simulated network-mount round trip per directory listing.
+func BenchmarkScanLocal(b *testing.B) {
+	var rels []string
+	for i := range 50 {
+		for j := range 20 {
+			rels = append(rels, fmt.Sprintf("Artist %02d/Album %d/%02d.mp3", i, j%4, j))
+		}
+	}
+	root := makeTree(b, rels)
+
+	slow := func(name string) ([]os.DirEntry, error) {
+		time.Sleep(time.Millisecond)
+		return os.ReadDir(name)
+	}
+	// With one worker the parallel walker is serial, but lists through slow.
+	serialReadDir := func(root string, fn fs.WalkDirFunc) error {
+		return walkDirParallel(root, 1, slow, fn)
+	}
+
+	for _, latency := range []bool{false, true} {
+		for _, concurrency := range []int{1, 4, 16} {
+			b.Run(fmt.Sprintf("latency=%t/concurrency=%d", latency, concurrency), func(b *testing.B) {
+				opts := ScanOptions{Concurrency: concurrency}
+				if latency {
+					opts.readDir, opts.walkDir = slow, serialReadDir
+				}
+				for b.Loop() {
+					if _, err := ScanLocal(root, opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
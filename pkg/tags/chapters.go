@@ -0,0 +1,155 @@
+package tags
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Chapter is a named section of a chaptered file (typically an .m4b audiobook).
+type Chapter struct {
+	Title string
+	Start time.Duration
+}
+
+// ErrChapterTrack reports a file whose chapters live in a QuickTime chapter
+// track, which ReadChapters detects but cannot decode yet.
+var ErrChapterTrack = errors.New("chapters are stored in a chapter track, which is not supported")
+
+// chplTimescale is the unit of Nero chapter start times: 100 ns.
+const chplTimescale = 100 * time.Nanosecond
+
+// ReadChapters returns the chapters of an MP4-family file (.m4b, .m4a, .mp4)
+// from its Nero "chpl" atom, in file order. Files without chapters, including
+// non-MP4 files, yield no chapters and no error. Chapters stored only in a
+// QuickTime chapter track yield ErrChapterTrack.
+func ReadChapters(path string) ([]Chapter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	var found chapterAtoms
+	if err := walkAtoms(f, 0, info.Size(), nil, &found); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	switch {
+	case found.chpl != nil:
+		chapters, err := parseChpl(found.chpl)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		return chapters, nil
+	case found.chapterTrack:
+		return nil, ErrChapterTrack
+	default:
+		return nil, nil
+	}
+}
+
+// chapterAtoms collects what walkAtoms finds.
+type chapterAtoms struct {
+	chpl         []byte // payload of moov/udta/chpl
+	chapterTrack bool   // a moov/trak/tref/chap reference exists
+}
+
+// containerAtoms are the atoms walkAtoms descends into on the way to chapters.
+var containerAtoms = map[string]bool{"moov": true, "udta": true, "trak": true, "tref": true}
+
+// walkAtoms scans the atoms in [start, end) of r, descending into containers.
+// parents is the path of enclosing atom types. A file that does not start with
+// a recognizable atom is treated as having none.
+func walkAtoms(r io.ReadSeeker, start, end int64, parents []string, found *chapterAtoms) error {
+	for offset := start; offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:])
+		headerLen := int64(8)
+
+		switch size {
+		case 0: // extends to the end of the enclosing space
+			size = end - offset
+		case 1: // 64-bit size follows
+			var large [8]byte
+			if _, err := io.ReadFull(r, large[:]); err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(large[:]))
+			headerLen = 16
+		}
+		if size < headerLen || offset+size > end {
+			if len(parents) == 0 {
+				return nil // not an MP4 file, or a truncated one
+			}
+			return fmt.Errorf("malformed %q atom at offset %d", typ, offset)
+		}
+
+		path := append(parents[:len(parents):len(parents)], typ)
+		switch {
+		case typ == "chpl" && len(parents) == 2 && parents[0] == "moov" && parents[1] == "udta":
+			payload := make([]byte, size-headerLen)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return err
+			}
+			found.chpl = payload
+		case typ == "chap" && len(parents) == 3 && parents[1] == "trak" && parents[2] == "tref":
+			found.chapterTrack = true
+		case containerAtoms[typ]:
+			if err := walkAtoms(r, offset+headerLen, offset+size, path, found); err != nil {
+				return err
+			}
+		}
+		offset += size
+	}
+	return nil
+}
+
+// parseChpl decodes a Nero chapter list: version, flags, (v1: 4 reserved
+// bytes), a chapter count, then per chapter a 64-bit start in 100 ns units and
+// a length-prefixed UTF-8 title.
+func parseChpl(b []byte) ([]Chapter, error) {
+	errTruncated := errors.New("truncated chapter list")
+	if len(b) < 4 {
+		return nil, errTruncated
+	}
+	pos := 4
+	if b[0] == 1 {
+		pos += 4
+	}
+	if len(b) < pos+1 {
+		return nil, errTruncated
+	}
+	count := int(b[pos])
+	pos++
+
+	chapters := make([]Chapter, 0, count)
+	for range count {
+		if len(b) < pos+9 {
+			return nil, errTruncated
+		}
+		start := time.Duration(binary.BigEndian.Uint64(b[pos:])) * chplTimescale
+		n := int(b[pos+8])
+		pos += 9
+		if len(b) < pos+n {
+			return nil, errTruncated
+		}
+		chapters = append(chapters, Chapter{Title: string(b[pos : pos+n]), Start: start})
+		pos += n
+	}
+	return chapters, nil
+}
@@ -0,0 +1,91 @@
+package tags
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// atom encodes an MP4 atom with the given type and concatenated payloads.
+func atom(typ string, payloads ...[]byte) []byte {
+	var body []byte
+	for _, p := range payloads {
+		body = append(body, p...)
+	}
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// chpl encodes a Nero chapter list atom payload.
+func chpl(version byte, chapters ...Chapter) []byte {
+	out := []byte{version, 0, 0, 0}
+	if version == 1 {
+		out = append(out, 0, 0, 0, 0)
+	}
+	out = append(out, byte(len(chapters)))
+	for _, c := range chapters {
+		out = binary.BigEndian.AppendUint64(out, uint64(c.Start/chplTimescale))
+		out = append(out, byte(len(c.Title)))
+		out = append(out, c.Title...)
+	}
+	return out
+}
+
+func TestReadChapters(t *testing.T) {
+	t.Parallel()
+
+	chapters := []Chapter{
+		{Title: "Opening Credits", Start: 0},
+		{Title: "Chapter 1", Start: 42*time.Second + 500*time.Millisecond},
+		{Title: "Chapitre 2 — Fin", Start: 1*time.Hour + 3*time.Minute},
+	}
+	ftyp := atom("ftyp", []byte("M4B \x00\x00\x02\x00"))
+	mdat := atom("mdat", make([]byte, 64))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []Chapter
+		wantErr error
+	}{
+		{"nero chapters v0", append(ftyp, atom("moov", atom("udta", atom("chpl", chpl(0, chapters...))))...), chapters, nil},
+		{"nero chapters v1 after mdat", append(append(ftyp, mdat...),
+			atom("moov", atom("trak"), atom("udta", atom("chpl", chpl(1, chapters...))))...), chapters, nil},
+		{"chapter track only", append(ftyp, atom("moov", atom("trak", atom("tref", atom("chap", []byte{0, 0, 0, 2}))))...), nil, ErrChapterTrack},
+		{"no chapters", append(ftyp, atom("moov", atom("udta"))...), nil, nil},
+		{"not mp4", []byte("ID3\x03\x00\x00\x00\x00\x00\x00 plus mp3 frames"), nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "book.m4b")
+			require.NoError(t, os.WriteFile(path, test.data, 0o644))
+
+			got, err := ReadChapters(path)
+			if test.wantErr != nil {
+				require.ErrorIs(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestReadChapters_Truncated(t *testing.T) {
+	t.Parallel()
+
+	list := chpl(0, Chapter{Title: "Chapter 1"})
+	path := filepath.Join(t.TempDir(), "book.m4b")
+	require.NoError(t, os.WriteFile(path, atom("moov", atom("udta", atom("chpl", list[:len(list)-3]))), 0o644))
+
+	_, err := ReadChapters(path)
+	assert.ErrorContains(t, err, "truncated chapter list")
+}
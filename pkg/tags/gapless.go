@@ -0,0 +1,35 @@
+package tags
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxGaplessSamples bounds the encoder delay and padding accepted from an
+// iTunSMPB tag. Real values are a few thousand samples; anything near a
+// second's worth at 192 kHz means the tag is not what we think it is.
+const maxGaplessSamples = 192000
+
+// parseITunSMPB extracts the encoder delay and end padding, in samples, from
+// an iTunes gapless tag such as
+// " 00000000 00000840 000001CA 00000000003F31F6 00000000 ...": space-separated
+// hex words where the second is the delay and the third the padding. It
+// returns false for anything that does not look like one.
+func parseITunSMPB(s string) (delay, padding int, ok bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 4 {
+		return 0, 0, false
+	}
+	var words [3]uint64
+	for i := range words {
+		n, err := strconv.ParseUint(fields[i+1], 16, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		words[i] = n
+	}
+	if words[0] > maxGaplessSamples || words[1] > maxGaplessSamples {
+		return 0, 0, false
+	}
+	return int(words[0]), int(words[1]), true
+}
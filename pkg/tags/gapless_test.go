@@ -0,0 +1,61 @@
+package tags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseITunSMPB(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		value       string
+		wantDelay   int
+		wantPadding int
+		wantOK      bool
+	}{
+		{
+			name:        "iTunes AAC encode",
+			value:       " 00000000 00000840 000001CA 00000000003F31F6 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000",
+			wantDelay:   2112,
+			wantPadding: 458,
+			wantOK:      true,
+		},
+		{name: "lowercase and no leading space", value: "00000000 00000840 000001ca 00000000003f31f6", wantDelay: 2112, wantPadding: 458, wantOK: true},
+		{name: "zero delay and padding", value: " 00000000 00000000 00000000 0000000000000000", wantOK: true},
+		{name: "too few words", value: " 00000000 00000840 000001CA"},
+		{name: "not hex", value: " 00000000 0000084G 000001CA 00000000003F31F6"},
+		{name: "implausible delay", value: " 00000000 FFFFFFFF 000001CA 00000000003F31F6"},
+		{name: "empty", value: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			delay, padding, ok := parseITunSMPB(test.value)
+			assert.Equal(t, test.wantOK, ok)
+			assert.Equal(t, test.wantDelay, delay)
+			assert.Equal(t, test.wantPadding, padding)
+		})
+	}
+}
+
+func TestApplyTags_Gapless(t *testing.T) {
+	t.Parallel()
+
+	const smpb = " 00000000 00000840 000001CA 00000000003F31F6 00000000 00000000 00000000 00000000 00000000 00000000 00000000 00000000"
+	for _, key := range []string{"ITUNSMPB", "COMMENT:ITUNSMPB"} {
+		var meta AudioMeta
+		applyTags(&meta, normalizeTags(map[string][]string{key: {smpb}}))
+		assert.Equal(t, 2112, meta.EncoderDelay, key)
+		assert.Equal(t, 458, meta.EncoderPadding, key)
+	}
+
+	var meta AudioMeta
+	applyTags(&meta, normalizeTags(map[string][]string{"ITUNSMPB": {"garbage"}}))
+	assert.Zero(t, meta.EncoderDelay)
+	assert.Zero(t, meta.EncoderPadding)
+}
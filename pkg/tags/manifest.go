@@ -0,0 +1,100 @@
+package tags
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ManifestEntry is one file of a manifest: its identity on disk and the metadata
+// to use in place of its tags. Meta uses the same encoding as the tag cache.
+// Size, if set, must match the file's Dropbox size for Meta to be trusted (see
+// Size); MTime is recorded by the tag cache export for reference only.
+type ManifestEntry struct {
+	Path  string    `json:"path"`
+	Size  int64     `json:"size"`
+	MTime time.Time `json:"mtime"`
+	Meta  AudioMeta `json:"meta"`
+}
+
+// Manifest provides metadata for a fixed set of files without reading them, for
+// offline regeneration, reproducible tests, and hand-curated metadata.
+type Manifest struct {
+	entries []ManifestEntry
+	byPath  map[string]int
+}
+
+// LoadManifest reads a JSON array of ManifestEntry from path. Entry paths are
+// either absolute or relative to the library root (see Resolve). Entries with
+// no path, a negative size, or a path listed twice are rejected.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var entries []ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+
+	m := &Manifest{entries: entries, byPath: make(map[string]int, len(entries))}
+	for i := range m.entries {
+		e := &m.entries[i]
+		if e.Path == "" {
+			return nil, fmt.Errorf("manifest entry %d: missing path", i)
+		}
+		if e.Size < 0 {
+			return nil, fmt.Errorf("manifest entry %d (%s): negative size %d", i, e.Path, e.Size)
+		}
+		e.Path = filepath.Clean(filepath.FromSlash(e.Path))
+		if prev, ok := m.byPath[e.Path]; ok {
+			return nil, fmt.Errorf("manifest entry %d (%s): duplicate of entry %d", i, e.Path, prev)
+		}
+		m.byPath[e.Path] = i
+	}
+	return m, nil
+}
+
+// Resolve makes relative entry paths absolute by joining them to root, so they
+// line up with the paths a scan of root would produce.
+func (m *Manifest) Resolve(root string) {
+	m.byPath = make(map[string]int, len(m.entries))
+	for i := range m.entries {
+		e := &m.entries[i]
+		if !filepath.IsAbs(e.Path) {
+			e.Path = filepath.Join(root, e.Path)
+		}
+		m.byPath[e.Path] = i
+	}
+}
+
+// Paths returns the entry paths in manifest order.
+func (m *Manifest) Paths() []string {
+	paths := make([]string, len(m.entries))
+	for i, e := range m.entries {
+		paths[i] = e.Path
+	}
+	return paths
+}
+
+// Lookup returns the metadata recorded for path.
+func (m *Manifest) Lookup(path string) (AudioMeta, bool) {
+	i, ok := m.byPath[path]
+	if !ok {
+		return AudioMeta{}, false
+	}
+	return m.entries[i].Meta, true
+}
+
+// Size returns the size recorded for path, or false if path is not in the
+// manifest or its entry records no size.
+func (m *Manifest) Size(path string) (int64, bool) {
+	i, ok := m.byPath[path]
+	if !ok || m.entries[i].Size == 0 {
+		return 0, false
+	}
+	return m.entries[i].Size, true
+}
@@ -0,0 +1,87 @@
+package tags
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadManifest(t *testing.T) {
+	t.Parallel()
+
+	path := writeManifest(t, `[
+		{"path": "Artist/Album/01 Song.flac", "size": 1024, "mtime": "2024-05-01T10:00:00Z",
+		 "meta": {"Title": "Song", "Artist": "Artist", "Album": "Album", "TrackNumber": 1, "Duration": 180000000000}},
+		{"path": "/abs/Other.mp3", "meta": {"Title": "Other"}}
+	]`)
+
+	m, err := LoadManifest(path)
+	require.NoError(t, err)
+	m.Resolve("/music")
+
+	assert.Equal(t, []string{
+		filepath.Join("/music", "Artist", "Album", "01 Song.flac"),
+		filepath.FromSlash("/abs/Other.mp3"),
+	}, m.Paths())
+
+	meta, ok := m.Lookup(filepath.Join("/music", "Artist", "Album", "01 Song.flac"))
+	require.True(t, ok)
+	assert.Equal(t, "Song", meta.Title)
+	assert.Equal(t, 1, meta.TrackNumber)
+	assert.Equal(t, 3*time.Minute, meta.Duration)
+
+	_, ok = m.Lookup("/music/missing.mp3")
+	assert.False(t, ok)
+
+	size, ok := m.Size(filepath.Join("/music", "Artist", "Album", "01 Song.flac"))
+	require.True(t, ok)
+	assert.Equal(t, int64(1024), size)
+	_, ok = m.Size(filepath.FromSlash("/abs/Other.mp3"))
+	assert.False(t, ok, "no size recorded")
+	_, ok = m.Size("/music/missing.mp3")
+	assert.False(t, ok)
+}
+
+func TestLoadManifest_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"not json", `{`, "parsing manifest"},
+		{"not an array", `{"path": "a.mp3"}`, "parsing manifest"},
+		{"missing path", `[{"size": 1}]`, "entry 0: missing path"},
+		{"negative size", `[{"path": "a.mp3", "size": -1}]`, "negative size"},
+		{"duplicate path", `[{"path": "a.mp3"}, {"path": "./a.mp3"}]`, "duplicate of entry 0"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := LoadManifest(writeManifest(t, test.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.wantErr)
+		})
+	}
+}
+
+func TestLoadManifest_MissingFile(t *testing.T) {
+	t.Parallel()
+
+	_, err := LoadManifest(filepath.Join(t.TempDir(), "nope.json"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,20 @@
+package tags
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize returns meta with its name fields (title, artists, album, genre,
+// and sort names) trimmed of surrounding whitespace and in Unicode NFC, the
+// form most players compare and display. Lyrics and numbers are left alone.
+func Normalize(meta AudioMeta) AudioMeta {
+	for _, s := range []*string{
+		&meta.Title, &meta.Artist, &meta.Album, &meta.AlbumArtist, &meta.Genre,
+		&meta.ArtistSort, &meta.AlbumArtistSort, &meta.AlbumSort,
+	} {
+		*s = norm.NFC.String(strings.TrimSpace(*s))
+	}
+	return meta
+}
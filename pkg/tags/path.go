@@ -0,0 +1,64 @@
+package tags
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// trackPrefix matches a leading track number: "01 Title", "01 - Title", "1. Title".
+	trackPrefix = regexp.MustCompile(`^(\d{1,3})(?:\s*[-.]\s*|\s+)(.+)$`)
+	// discTrackPrefix is trackPrefix that also accepts a disc number: "1-01 Title".
+	discTrackPrefix = regexp.MustCompile(`^(?:\d{1,2}[-.])?\d{1,3}(?:\s*[-.]\s*|\s+)(.+)$`)
+	// discFolder matches a per-disc subfolder such as "CD1" or "Disc 2".
+	discFolder = regexp.MustCompile(`(?i)^(?:cd|disc|disk)\s*(\d+)$`)
+)
+
+// StripTrackPrefix removes a leading track number, optionally preceded by a disc
+// number, from a filename stem: "01 - Title", "01. Title", and "1-01 Title" all
+// become "Title". Names without such a prefix are returned unchanged.
+func StripTrackPrefix(name string) string {
+	if m := discTrackPrefix.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	return name
+}
+
+// FromPath infers metadata from a file's location below root without opening it,
+// for libraries laid out as Artist/Album/[Disc N/]NN Title.ext. Parts the layout
+// does not provide keep ReadFile's defaults; Duration is always zero.
+func FromPath(root, path string) AudioMeta {
+	meta := defaultMeta(path)
+
+	if m := trackPrefix.FindStringSubmatch(meta.Title); m != nil {
+		meta.TrackNumber, _ = strconv.Atoi(m[1])
+		meta.Title = m[2]
+		meta.Sources.TrackNumber = SourcePath
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return meta
+	}
+	dirs := strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/")
+	if len(dirs) == 1 && dirs[0] == "." {
+		return meta
+	}
+
+	if m := discFolder.FindStringSubmatch(dirs[len(dirs)-1]); m != nil && len(dirs) > 1 {
+		meta.DiskNumber, _ = strconv.Atoi(m[1])
+		meta.Sources.DiskNumber = SourcePath
+		dirs = dirs[:len(dirs)-1]
+	}
+	meta.Album = dirs[len(dirs)-1]
+	meta.Sources.Album = SourcePath
+	if len(dirs) > 1 {
+		meta.Artist = dirs[len(dirs)-2]
+		meta.AlbumArtist = meta.Artist
+		meta.Sources.Artist = SourcePath
+		meta.Sources.AlbumArtist = SourcePath
+	}
+	return meta
+}
@@ -0,0 +1,77 @@
+package tags
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromPath(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		path string
+		want AudioMeta
+	}{
+		{
+			name: "artist and album folders",
+			path: "/music/Miles Davis/Kind of Blue/01 - So What.flac",
+			want: AudioMeta{Title: "So What", Artist: "Miles Davis", Album: "Kind of Blue", AlbumArtist: "Miles Davis", TrackNumber: 1, DiskNumber: 1},
+		},
+		{
+			name: "disc subfolder",
+			path: "/music/Pink Floyd/The Wall/CD2/3. Hey You.mp3",
+			want: AudioMeta{Title: "Hey You", Artist: "Pink Floyd", Album: "The Wall", AlbumArtist: "Pink Floyd", TrackNumber: 3, DiskNumber: 2},
+		},
+		{
+			name: "album folder only",
+			path: "/music/Soundtracks/Intro.mp3",
+			want: AudioMeta{Title: "Intro", Artist: Unknown, Album: "Soundtracks", AlbumArtist: Unknown, TrackNumber: -1, DiskNumber: 1},
+		},
+		{
+			name: "file in root",
+			path: "/music/07 Loose Track.mp3",
+			want: AudioMeta{Title: "Loose Track", Artist: Unknown, Album: Unknown, AlbumArtist: Unknown, TrackNumber: 7, DiskNumber: 1},
+		},
+		{
+			name: "year is not a track number",
+			path: "/music/1999.mp3",
+			want: AudioMeta{Title: "1999", Artist: Unknown, Album: Unknown, AlbumArtist: Unknown, TrackNumber: -1, DiskNumber: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := FromPath("/music", test.path)
+			got.Sources = FieldSources{} // checked in TestFieldSources
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestStripTrackPrefix(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"01 - Song Name", "Song Name"},
+		{"01. Song Name", "Song Name"},
+		{"01 Song Name", "Song Name"},
+		{"1-01 Song Name", "Song Name"},
+		{"2.05 - Song Name", "Song Name"},
+		{"Song Name", "Song Name"},
+		{"2001", "2001"},
+		{"1999 Remix", "1999 Remix"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.want, StripTrackPrefix(test.name))
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package tags
+
+import "fmt"
+
+// ErrorPolicy decides what happens to a file whose tags could not be read.
+type ErrorPolicy string
+
+// Supported error policies.
+const (
+	// ErrorPolicySkip leaves the file out of the output.
+	ErrorPolicySkip ErrorPolicy = "skip"
+	// ErrorPolicyDefault keeps the file with filename-derived defaults.
+	ErrorPolicyDefault ErrorPolicy = "default"
+	// ErrorPolicyAbort stops the run.
+	ErrorPolicyAbort ErrorPolicy = "abort"
+)
+
+// ParseErrorPolicy validates s as an ErrorPolicy.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	switch p := ErrorPolicy(s); p {
+	case ErrorPolicySkip, ErrorPolicyDefault, ErrorPolicyAbort:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown tag error policy %q (want skip, default, or abort)", s)
+	}
+}
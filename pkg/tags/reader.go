@@ -4,6 +4,7 @@ package tags
 import (
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -11,6 +12,9 @@ import (
 	"github.com/sentriz/audiotags"
 )
 
+// Unknown is the placeholder used for artist and album fields when tags are absent.
+const Unknown = "Unknown"
+
 // AudioMeta holds extracted metadata from an audio file.
 type AudioMeta struct {
 	Title       string
@@ -21,21 +25,103 @@ type AudioMeta struct {
 	Year        int
 	TrackNumber int // -1 means absent
 	DiskNumber  int
+	TrackTotal  int `json:",omitempty"` // 0 means absent
+	DiscTotal   int `json:",omitempty"` // 0 means absent
 	Duration    time.Duration
+	// Lyrics holds unsynced (or LRC-formatted) embedded lyrics, only when requested via ReadOptions.
+	Lyrics string `json:",omitempty"`
+	// ArtistSort, AlbumArtistSort, and AlbumSort are the sort-name tags
+	// ("Beatles, The"), empty when absent.
+	ArtistSort      string `json:",omitempty"`
+	AlbumArtistSort string `json:",omitempty"`
+	AlbumSort       string `json:",omitempty"`
+
+	// Work, Movement, and MovementNumber are the classical work a track is
+	// part of ("Symphony No. 5"), its movement name ("Andante"), and the
+	// movement's number (0 when absent). Grouping is the content group, which
+	// older taggers also use for the work.
+	Work           string `json:",omitempty"`
+	Movement       string `json:",omitempty"`
+	MovementNumber int    `json:",omitempty"`
+	Grouping       string `json:",omitempty"`
+
+	// EncoderDelay and EncoderPadding are the silent samples an encoder added
+	// at the start and end of the track, from the iTunes gapless tag
+	// (iTunSMPB). 0 means absent.
+	EncoderDelay   int `json:",omitempty"`
+	EncoderPadding int `json:",omitempty"`
+
+	// Sources tells where each field came from. It is zero for metadata that
+	// was not read by ReadFile or FromPath, such as manifest entries.
+	Sources FieldSources `json:",omitzero"`
+}
+
+// ReadOptions selects optional, costly metadata for ReadFile.
+type ReadOptions struct {
+	// Lyrics extracts embedded lyrics (ID3 USLT, Vorbis LYRICS/UNSYNCEDLYRICS) into AudioMeta.Lyrics.
+	Lyrics bool
 }
 
 // ReadFile extracts audio metadata from the file at path.
 // On failure, returns defaults ("Unknown" for artist/album, filename for title, 0 for duration).
-func ReadFile(path string) (meta AudioMeta, err error) {
-	meta = AudioMeta{
+func ReadFile(path string, opts ReadOptions) (AudioMeta, error) {
+	meta, _, err := ReadFileRaw(path)
+	if !opts.Lyrics {
+		meta.Lyrics = ""
+	}
+	return meta, err
+}
+
+// ReadFileRaw is like ReadFile but also returns every tag taglib found, including
+// ones AudioMeta does not model (e.g. "grouping", "isrc", "label").
+// Keys are taglib property names normalized to lowercase ("ALBUMARTIST" becomes
+// "albumartist"); values keep their original order and case.
+// The map is nil if the file could not be opened. Lyrics are always extracted.
+func ReadFileRaw(path string) (meta AudioMeta, raw map[string][]string, err error) {
+	meta = defaultMeta(path)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("taglib panicked: %v", r)
+		}
+	}()
+
+	f, openErr := audiotags.Open(path)
+	if openErr != nil || f == nil {
+		return meta, nil, nil
+	}
+	defer f.Close()
+
+	raw = normalizeTags(f.ReadTags())
+	props := f.ReadAudioProperties()
+
+	applyTags(&meta, raw)
+
+	if props != nil {
+		meta.Duration = time.Duration(props.LengthMs) * time.Millisecond
+	}
+
+	return meta, raw, nil
+}
+
+// defaultMeta is what ReadFile returns for a file without tags: the file name
+// as title and placeholders for the rest.
+func defaultMeta(path string) AudioMeta {
+	return AudioMeta{
 		Title:       filenameWithoutExt(path),
-		Artist:      "Unknown",
-		Album:       "Unknown",
-		AlbumArtist: "Unknown",
+		Artist:      Unknown,
+		Album:       Unknown,
+		AlbumArtist: Unknown,
 		TrackNumber: -1,
 		DiskNumber:  1,
+		Sources:     defaultSources(),
 	}
+}
 
+// ReadDurationOnly reads just the audio properties of the file at path, skipping
+// the tag map, for runs that infer everything else from the path. Files taglib
+// cannot open have a zero duration and no error, as with ReadFile.
+func ReadDurationOnly(path string) (d time.Duration, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("taglib panicked: %v", r)
@@ -44,50 +130,138 @@ func ReadFile(path string) (meta AudioMeta, err error) {
 
 	f, openErr := audiotags.Open(path)
 	if openErr != nil || f == nil {
-		return meta, nil
+		return 0, nil
 	}
 	defer f.Close()
 
-	tags := f.ReadTags()
-	props := f.ReadAudioProperties()
+	if props := f.ReadAudioProperties(); props != nil {
+		d = time.Duration(props.LengthMs) * time.Millisecond
+	}
+	return d, nil
+}
 
+// normalizeTags lowercases tag keys, merging values of keys that differ only by case
+// (in sorted key order, so the result is deterministic).
+func normalizeTags(tags map[string][]string) map[string][]string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(map[string][]string, len(tags))
+	for _, k := range keys {
+		key := strings.ToLower(k)
+		out[key] = append(out[key], tags[k]...)
+	}
+	return out
+}
+
+// applyTags overrides meta's defaults with the modeled fields present in tags,
+// marking them in meta.Sources.
+func applyTags(meta *AudioMeta, tags map[string][]string) {
 	if v := firstTag(tags, "title"); v != "" {
 		meta.Title = v
+		meta.Sources.Title = SourceTag
 	}
 	if v := firstTag(tags, "artist"); v != "" {
 		meta.Artist = v
+		meta.Sources.Artist = SourceTag
 	}
 	if v := firstTag(tags, "album"); v != "" {
 		meta.Album = v
+		meta.Sources.Album = SourceTag
 	}
 	if v := firstTag(tags, "albumartist"); v != "" {
 		meta.AlbumArtist = v
+		meta.Sources.AlbumArtist = SourceTag
+	}
+	meta.ArtistSort = firstTag(tags, "artistsort")
+	meta.AlbumArtistSort = firstTag(tags, "albumartistsort")
+	meta.AlbumSort = firstTag(tags, "albumsort")
+	meta.Work = firstTag(tags, "work")
+	meta.Movement = firstTag(tags, "movementname", "movement")
+	if v := firstTag(tags, "movementnumber"); v != "" {
+		meta.MovementNumber = max(parseSlashNumber(v, 0), 0)
 	}
-	if v := firstTag(tags, "genre"); v != "" {
+	meta.Grouping = firstTag(tags, "grouping", "contentgroup")
+	if v := joinTag(tags, "genre"); v != "" {
 		meta.Genre = v
+		meta.Sources.Genre = SourceTag
 	}
 	if v := firstTag(tags, "date"); v != "" {
 		meta.Year = parseYear(v)
+		if meta.Year > 0 {
+			meta.Sources.Year = SourceTag
+		}
 	}
-	if v := firstTag(tags, "tracknumber"); v != "" {
+	if v := firstTag(tags, "tracknumber", "track"); v != "" {
 		meta.TrackNumber = parseSlashNumber(v, -1)
+		meta.TrackTotal = parseSlashTotal(v)
+		if meta.TrackNumber >= 0 {
+			meta.Sources.TrackNumber = SourceTag
+		}
 	}
-	if v := firstTag(tags, "discnumber"); v != "" {
+	if meta.TrackTotal == 0 {
+		meta.TrackTotal = parseTotalTag(tags, "tracktotal", "totaltracks")
+	}
+	if v := firstTag(tags, "discnumber", "disc"); v != "" {
 		meta.DiskNumber = parseSlashNumber(v, 1)
+		meta.DiscTotal = parseSlashTotal(v)
+		if parseSlashNumber(v, -1) >= 0 {
+			meta.Sources.DiskNumber = SourceTag
+		}
 	}
+	if meta.DiscTotal == 0 {
+		meta.DiscTotal = parseTotalTag(tags, "disctotal", "totaldiscs")
+	}
+	// MP4 files carry it as a freeform atom, MP3s as an ID3 comment
+	if v := firstTag(tags, "itunsmpb", "comment:itunsmpb"); v != "" {
+		if delay, padding, ok := parseITunSMPB(v); ok {
+			meta.EncoderDelay, meta.EncoderPadding = delay, padding
+		}
+	}
+	if v := firstTag(tags, "lyrics"); v != "" {
+		meta.Lyrics = v
+	} else if v := firstTag(tags, "unsyncedlyrics"); v != "" {
+		meta.Lyrics = v
+	}
+}
 
-	if props != nil {
-		meta.Duration = time.Duration(props.LengthMs) * time.Millisecond
+// firstTag returns the first value of the first of keys that has a non-empty
+// one. Later keys are fallbacks for encoders that use a less common name, such
+// as TRACK instead of TRACKNUMBER.
+func firstTag(tags map[string][]string, keys ...string) string {
+	for _, key := range keys {
+		if vals, ok := tags[key]; ok && len(vals) > 0 && vals[0] != "" {
+			return vals[0]
+		}
 	}
+	return ""
+}
 
-	return meta, nil
+// joinTag joins all non-empty values of a multi-value tag with GenreSeparator.
+func joinTag(tags map[string][]string, key string) string {
+	var vals []string
+	for _, v := range tags[key] {
+		if v != "" {
+			vals = append(vals, v)
+		}
+	}
+	return strings.Join(vals, GenreSeparator)
 }
 
-func firstTag(tags map[string][]string, key string) string {
-	if vals, ok := tags[key]; ok && len(vals) > 0 && vals[0] != "" {
-		return vals[0]
+// GenreSeparator joins the values of a multi-value genre tag.
+const GenreSeparator = "; "
+
+// PrimaryGenre returns the first genre of a delimited genre string such as
+// "Electronic; House; Deep House". Semicolons and NUL (the ID3v2.4 multi-value
+// separator) are treated as delimiters.
+func PrimaryGenre(genre string) string {
+	if i := strings.IndexAny(genre, ";\x00"); i >= 0 {
+		genre = genre[:i]
 	}
-	return ""
+	return strings.TrimSpace(genre)
 }
 
 // parseYear extracts a 4-digit year from a string that may be a full ISO date.
@@ -110,6 +284,30 @@ func parseSlashNumber(s string, fallback int) int {
 	return fallback
 }
 
+// parseSlashTotal parses "3/12" format, returning the total after the slash, or 0.
+func parseSlashTotal(s string) int {
+	_, total, ok := strings.Cut(s, "/")
+	if !ok {
+		return 0
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(total)); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// parseTotalTag returns the first positive total found in the given standalone
+// tags (Vorbis TRACKTOTAL, TOTALTRACKS, ...), or 0. A "3/12" number tag takes
+// precedence over these, as it is written together with the number it counts.
+func parseTotalTag(tags map[string][]string, keys ...string) int {
+	for _, key := range keys {
+		if n, err := strconv.Atoi(strings.TrimSpace(firstTag(tags, key))); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
 func filenameWithoutExt(path string) string {
 	name := filepath.Base(path)
 	return strings.TrimSuffix(name, filepath.Ext(name))
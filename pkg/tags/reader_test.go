@@ -1,9 +1,15 @@
 package tags
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags/tagstest"
 )
 
 func TestParseYear(t *testing.T) {
@@ -77,3 +83,273 @@ func TestFilenameWithoutExt(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeAndApplyTags(t *testing.T) {
+	t.Parallel()
+
+	raw := normalizeTags(map[string][]string{
+		"TITLE":       {"Song"},
+		"AlbumArtist": {"Band"},
+		"GROUPING":    {"Side A"},
+		"isrc":        {"USABC1234567"},
+		"Label":       {"Indie"},
+		"LABEL":       {"Major"},
+		"TRACKNUMBER": {"4/12"},
+	})
+
+	assert.Equal(t, map[string][]string{
+		"title":       {"Song"},
+		"albumartist": {"Band"},
+		"grouping":    {"Side A"},
+		"isrc":        {"USABC1234567"},
+		"label":       {"Major", "Indie"},
+		"tracknumber": {"4/12"},
+	}, raw)
+
+	meta := AudioMeta{Artist: Unknown, TrackNumber: -1}
+	applyTags(&meta, raw)
+
+	assert.Equal(t, "Song", meta.Title)
+	assert.Equal(t, "Band", meta.AlbumArtist)
+	assert.Equal(t, Unknown, meta.Artist)
+	assert.Equal(t, 4, meta.TrackNumber)
+}
+
+func TestPrimaryGenre(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		genre string
+		want  string
+	}{
+		{"single", "Jazz", "Jazz"},
+		{"semicolon list", "Electronic; House; Deep House", "Electronic"},
+		{"no space", "Rock;Pop", "Rock"},
+		{"ID3v2.4 NUL separator", "Metal\x00Doom", "Metal"},
+		{"slash is kept", "Hip-Hop/Rap", "Hip-Hop/Rap"},
+		{"empty", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, PrimaryGenre(test.genre))
+		})
+	}
+}
+
+func TestApplyTags_MultiValueGenre(t *testing.T) {
+	t.Parallel()
+
+	var meta AudioMeta
+	applyTags(&meta, map[string][]string{"genre": {"Electronic", "", "House"}})
+
+	assert.Equal(t, "Electronic; House", meta.Genre)
+}
+
+func TestApplyTags_Lyrics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		tags map[string][]string
+		want string
+	}{
+		{"ID3 USLT frame", map[string][]string{"lyrics": {"First line\nSecond line"}}, "First line\nSecond line"},
+		{"Vorbis UNSYNCEDLYRICS", map[string][]string{"unsyncedlyrics": {"Hello"}}, "Hello"},
+		{"LYRICS wins", map[string][]string{"lyrics": {"A"}, "unsyncedlyrics": {"B"}}, "A"},
+		{"none", map[string][]string{"title": {"Song"}}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var meta AudioMeta
+			applyTags(&meta, normalizeTags(test.tags))
+			assert.Equal(t, test.want, meta.Lyrics)
+		})
+	}
+}
+
+func TestApplyTags_Totals(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		tags           map[string][]string
+		wantTrack      int
+		wantTrackTotal int
+		wantDisc       int
+		wantDiscTotal  int
+	}{
+		{"slash totals", map[string][]string{"tracknumber": {"3/12"}, "discnumber": {"1/2"}}, 3, 12, 1, 2},
+		{"separate total tags", map[string][]string{
+			"tracknumber": {"3"}, "tracktotal": {"12"}, "discnumber": {"2"}, "disctotal": {"3"},
+		}, 3, 12, 2, 3},
+		{"alternate total tag names", map[string][]string{
+			"tracknumber": {"3"}, "totaltracks": {"10"}, "discnumber": {"1"}, "totaldiscs": {"2"},
+		}, 3, 10, 1, 2},
+		{"slash total wins over a conflicting tag", map[string][]string{
+			"tracknumber": {"3/12"}, "tracktotal": {"14"}, "discnumber": {"1/2"}, "disctotal": {"5"},
+		}, 3, 12, 1, 2},
+		{"unparsable slash total falls back to the tag", map[string][]string{
+			"tracknumber": {"3/?"}, "tracktotal": {"12"},
+		}, 3, 12, 0, 0},
+		{"total without number", map[string][]string{"tracktotal": {"12"}}, 0, 12, 0, 0},
+		{"no totals", map[string][]string{"tracknumber": {"3"}, "tracktotal": {"0"}}, 3, 0, 0, 0},
+		{"track and disc keys", map[string][]string{"TRACK": {"5/9"}, "DISC": {"2/2"}}, 5, 9, 2, 2},
+		{"track key with separate totals", map[string][]string{
+			"track": {"5"}, "tracktotal": {"9"}, "disc": {"2"}, "disctotal": {"3"},
+		}, 5, 9, 2, 3},
+		{"tracknumber wins over track", map[string][]string{
+			"tracknumber": {"4"}, "track": {"7"}, "discnumber": {"1"}, "disc": {"2"},
+		}, 4, 0, 1, 0},
+		{"empty tracknumber falls back to track", map[string][]string{
+			"tracknumber": {""}, "track": {"7"}, "discnumber": {""}, "disc": {"2"},
+		}, 7, 0, 2, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var meta AudioMeta
+			applyTags(&meta, normalizeTags(test.tags))
+			assert.Equal(t, test.wantTrack, meta.TrackNumber)
+			assert.Equal(t, test.wantTrackTotal, meta.TrackTotal)
+			assert.Equal(t, test.wantDisc, meta.DiskNumber)
+			assert.Equal(t, test.wantDiscTotal, meta.DiscTotal)
+		})
+	}
+}
+
+func TestApplyTags_SortNames(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name                string
+		tags                map[string][]string
+		wantArtistSort      string
+		wantAlbumArtistSort string
+		wantAlbumSort       string
+	}{
+		{"all sort names", map[string][]string{
+			"ARTISTSORT": {"Beatles, The"}, "ALBUMARTISTSORT": {"Beatles, The"}, "ALBUMSORT": {"White Album, The"},
+		}, "Beatles, The", "Beatles, The", "White Album, The"},
+		{"artist sort only", map[string][]string{"artistsort": {"Bach, Johann Sebastian"}}, "Bach, Johann Sebastian", "", ""},
+		{"empty value", map[string][]string{"albumsort": {""}}, "", "", ""},
+		{"absent", map[string][]string{"artist": {"The Beatles"}}, "", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var meta AudioMeta
+			applyTags(&meta, normalizeTags(test.tags))
+			assert.Equal(t, test.wantArtistSort, meta.ArtistSort)
+			assert.Equal(t, test.wantAlbumArtistSort, meta.AlbumArtistSort)
+			assert.Equal(t, test.wantAlbumSort, meta.AlbumSort)
+		})
+	}
+}
+
+func TestApplyTags_Classical(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		tags map[string][]string
+		want AudioMeta
+	}{
+		{
+			// As taglib reports an MP4 tagged by iTunes (©wrk, ©mvn, ©mvi, ©mvc, ©grp)
+			name: "MP4 work and movement",
+			tags: map[string][]string{
+				"TITLE": {"Andante con moto"}, "WORK": {"Symphony No. 5 in C minor, Op. 67"},
+				"MOVEMENTNAME": {"Andante con moto"}, "MOVEMENTNUMBER": {"2"}, "MOVEMENTCOUNT": {"4"},
+				"GROUPING": {"Beethoven Symphonies"},
+			},
+			want: AudioMeta{
+				Title: "Andante con moto", Work: "Symphony No. 5 in C minor, Op. 67",
+				Movement: "Andante con moto", MovementNumber: 2, Grouping: "Beethoven Symphonies",
+			},
+		},
+		{
+			name: "Vorbis comments with MOVEMENT and a slash number",
+			tags: map[string][]string{
+				"work": {"Goldberg Variations, BWV 988"}, "movement": {"Aria"}, "movementnumber": {"1/32"},
+			},
+			want: AudioMeta{Work: "Goldberg Variations, BWV 988", Movement: "Aria", MovementNumber: 1},
+		},
+		{
+			name: "older ID3 content group",
+			tags: map[string][]string{"CONTENTGROUP": {"Piano Sonatas"}},
+			want: AudioMeta{Grouping: "Piano Sonatas"},
+		},
+		{
+			name: "unparsable movement number",
+			tags: map[string][]string{"WORK": {"Requiem"}, "MOVEMENTNAME": {"Lacrimosa"}, "MOVEMENTNUMBER": {"viii"}},
+			want: AudioMeta{Work: "Requiem", Movement: "Lacrimosa"},
+		},
+		{
+			name: "absent",
+			tags: map[string][]string{"ARTIST": {"Band"}},
+			want: AudioMeta{Artist: "Band"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var meta AudioMeta
+			applyTags(&meta, normalizeTags(test.tags))
+			meta.Sources = FieldSources{}
+			assert.Equal(t, test.want, meta)
+		})
+	}
+}
+
+func TestReadDurationOnly_MatchesReadFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "silence.wav")
+	garbage := filepath.Join(dir, "garbage.flac")
+	tagstest.WriteWAV(t, wav, 3*time.Second)
+	require.NoError(t, os.WriteFile(garbage, []byte("not really audio"), 0o644))
+
+	meta, err := ReadFile(garbage, ReadOptions{})
+	require.NoError(t, err)
+	d, err := ReadDurationOnly(garbage)
+	require.NoError(t, err)
+	assert.Equal(t, meta.Duration, d, "an unreadable file has the same duration either way")
+
+	meta, err = ReadFile(wav, ReadOptions{})
+	require.NoError(t, err)
+	if meta.Duration == 0 {
+		t.Skip("this taglib build does not read the WAV fixture's duration")
+	}
+	assert.Equal(t, 3*time.Second, meta.Duration)
+	d, err = ReadDurationOnly(wav)
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, d)
+}
+
+func BenchmarkReadFile(b *testing.B) {
+	path := tagstest.Fixtures(b, 1)[0]
+	for b.Loop() {
+		_, _ = ReadFile(path, ReadOptions{})
+	}
+}
+
+func BenchmarkReadDurationOnly(b *testing.B) {
+	path := tagstest.Fixtures(b, 1)[0]
+	for b.Loop() {
+		_, _ = ReadDurationOnly(path)
+	}
+}
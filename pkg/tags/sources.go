@@ -0,0 +1,44 @@
+package tags
+
+// Source is where a field of AudioMeta came from.
+type Source string
+
+// Field sources.
+const (
+	// SourceTag is the file's own tags.
+	SourceTag Source = "tag"
+	// SourcePath is the file's name or the folders above it.
+	SourcePath Source = "path"
+	// SourceDefault means nothing provided the field: it holds its placeholder
+	// ("Unknown", 0, -1 for TrackNumber, 1 for DiskNumber).
+	SourceDefault Source = "default"
+)
+
+// FieldSources records where ReadFile or FromPath took each modeled field of
+// an AudioMeta from. Sort names, totals, lyrics, and gapless values are only
+// ever read from tags and are not tracked.
+type FieldSources struct {
+	Title       Source `json:"title"`
+	Artist      Source `json:"artist"`
+	Album       Source `json:"album"`
+	AlbumArtist Source `json:"album_artist"`
+	Genre       Source `json:"genre"`
+	Year        Source `json:"year"`
+	TrackNumber Source `json:"track_number"`
+	DiskNumber  Source `json:"disk_number"`
+}
+
+// defaultSources are the sources of ReadFile's defaults: the title is the
+// file name, everything else a placeholder.
+func defaultSources() FieldSources {
+	return FieldSources{
+		Title:       SourcePath,
+		Artist:      SourceDefault,
+		Album:       SourceDefault,
+		AlbumArtist: SourceDefault,
+		Genre:       SourceDefault,
+		Year:        SourceDefault,
+		TrackNumber: SourceDefault,
+		DiskNumber:  SourceDefault,
+	}
+}
@@ -0,0 +1,103 @@
+package tags
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags/tagstest"
+)
+
+func TestFieldSources(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		meta func() AudioMeta
+		want FieldSources
+	}{
+		{
+			name: "tagged",
+			meta: func() AudioMeta {
+				meta := defaultMeta("/music/01 Song.flac")
+				applyTags(&meta, normalizeTags(map[string][]string{
+					"TITLE":       {"Song"},
+					"ARTIST":      {"Band"},
+					"ALBUM":       {"Record"},
+					"DATE":        {"2001-05-01"},
+					"TRACKNUMBER": {"1/10"},
+				}))
+				return meta
+			},
+			want: FieldSources{
+				Title: SourceTag, Artist: SourceTag, Album: SourceTag, AlbumArtist: SourceDefault,
+				Genre: SourceDefault, Year: SourceTag, TrackNumber: SourceTag, DiskNumber: SourceDefault,
+			},
+		},
+		{
+			name: "unparsable tags keep the default",
+			meta: func() AudioMeta {
+				meta := defaultMeta("/music/Song.flac")
+				applyTags(&meta, normalizeTags(map[string][]string{
+					"DATE":        {"unknown"},
+					"TRACKNUMBER": {"A1"},
+					"DISCNUMBER":  {"side B"},
+				}))
+				return meta
+			},
+			want: defaultSources(),
+		},
+		{
+			name: "inferred from the path",
+			meta: func() AudioMeta { return FromPath("/music", "/music/Band/Record/CD2/03 Song.flac") },
+			want: FieldSources{
+				Title: SourcePath, Artist: SourcePath, Album: SourcePath, AlbumArtist: SourcePath,
+				Genre: SourceDefault, Year: SourceDefault, TrackNumber: SourcePath, DiskNumber: SourcePath,
+			},
+		},
+		{
+			name: "path without folders",
+			meta: func() AudioMeta { return FromPath("/music", "/music/Song.flac") },
+			want: defaultSources(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.want, test.meta().Sources)
+		})
+	}
+}
+
+func TestFieldSources_ReadFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tagless := filepath.Join(dir, "garbage.flac")
+	require.NoError(t, os.WriteFile(tagless, []byte("not really audio"), 0o644))
+	meta, err := ReadFile(tagless, ReadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, FieldSources{
+		Title: SourcePath, Artist: SourceDefault, Album: SourceDefault, AlbumArtist: SourceDefault,
+		Genre: SourceDefault, Year: SourceDefault, TrackNumber: SourceDefault, DiskNumber: SourceDefault,
+	}, meta.Sources)
+
+	tagged := filepath.Join(dir, "silence.wav")
+	tagstest.WriteWAV(t, tagged, time.Second)
+	if _, raw, _ := ReadFileRaw(tagged); raw == nil {
+		t.Skip("taglib cannot open WAV fixtures in this build")
+	}
+	require.NoError(t, WriteTags(tagged, AudioMeta{Artist: "Band", Album: "Record", TrackNumber: 3}))
+	meta, err = ReadFile(tagged, ReadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, FieldSources{
+		Title: SourcePath, Artist: SourceTag, Album: SourceTag, AlbumArtist: SourceDefault,
+		Genre: SourceDefault, Year: SourceDefault, TrackNumber: SourceTag, DiskNumber: SourceDefault,
+	}, meta.Sources)
+}
@@ -0,0 +1,89 @@
+// Package tagstest generates small audio fixture files for tests and benchmarks.
+package tagstest
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// FixtureDirEnv names an environment variable pointing at a directory of real
+// audio files; Fixtures returns that directory's files instead of generating any.
+const FixtureDirEnv = "CLOUDBEATS_FIXTURE_DIR"
+
+// WAV format of generated fixtures: 8 kHz mono 8-bit PCM keeps files tiny.
+const (
+	sampleRate    = 8000
+	channels      = 1
+	bitsPerSample = 8
+)
+
+// WriteWAV writes a silent PCM WAV file of duration d to path.
+func WriteWAV(tb testing.TB, path string, d time.Duration) {
+	tb.Helper()
+
+	dataSize := uint32(d.Seconds() * sampleRate * channels * bitsPerSample / 8)
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'}, 36 + dataSize, [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), uint16(1), uint16(channels), uint32(sampleRate),
+		uint32(sampleRate * channels * bitsPerSample / 8), uint16(channels * bitsPerSample / 8), uint16(bitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'}, dataSize,
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		tb.Fatalf("creating fixture: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	for _, v := range header {
+		if err := binary.Write(f, binary.LittleEndian, v); err != nil {
+			tb.Fatalf("writing fixture header: %v", err)
+		}
+	}
+	silence := make([]byte, dataSize)
+	for i := range silence {
+		silence[i] = 0x80 // 8-bit PCM is unsigned; 0x80 is the zero level
+	}
+	if _, err := f.Write(silence); err != nil {
+		tb.Fatalf("writing fixture data: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		tb.Fatalf("closing fixture: %v", err)
+	}
+}
+
+// Fixtures returns n one-second WAV files generated in a temporary directory, or
+// every regular file in the directory named by FixtureDirEnv when it is set.
+// It skips the test or benchmark if that directory holds no files.
+func Fixtures(tb testing.TB, n int) []string {
+	tb.Helper()
+
+	if dir := os.Getenv(FixtureDirEnv); dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			tb.Fatalf("reading %s: %v", FixtureDirEnv, err)
+		}
+		var paths []string
+		for _, e := range entries {
+			if e.Type().IsRegular() {
+				paths = append(paths, filepath.Join(dir, e.Name()))
+			}
+		}
+		if len(paths) == 0 {
+			tb.Skipf("%s (%s) holds no files", FixtureDirEnv, dir)
+		}
+		return paths
+	}
+
+	dir := tb.TempDir()
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%03d.wav", i))
+		WriteWAV(tb, paths[i], time.Second)
+	}
+	return paths
+}
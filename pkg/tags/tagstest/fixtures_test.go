@@ -0,0 +1,25 @@
+package tagstest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteWAV(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "two.wav")
+	WriteWAV(t, path, 2*time.Second)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, data, 44+2*sampleRate)
+	assert.Equal(t, "RIFF", string(data[:4]))
+	assert.Equal(t, "WAVE", string(data[8:12]))
+	assert.Equal(t, "data", string(data[36:40]))
+}
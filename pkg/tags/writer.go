@@ -0,0 +1,117 @@
+package tags
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sentriz/audiotags"
+)
+
+// ErrWriteFailed is returned when taglib cannot save the tags of a file, e.g.
+// because the format does not support them or the file is read-only.
+var ErrWriteFailed = errors.New("taglib could not save the tags")
+
+// WriteTags writes meta's modeled fields to the file at path. Only fields
+// that differ from what ReadFile would return are rewritten, so a full DATE
+// keeps its month and day when Year is unchanged. Fields at their absent value
+// (empty, Unknown, 0, or -1 for TrackNumber) are left as the file has them,
+// and tags AudioMeta does not model are preserved. Duration, the gapless
+// values, and the classical work fields are ignored.
+func WriteTags(path string, meta AudioMeta) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("taglib panicked: %v", r)
+		}
+	}()
+
+	f, openErr := audiotags.Open(path)
+	if openErr != nil || f == nil {
+		return fmt.Errorf("opening %s for writing: %w", path, openErr)
+	}
+	defer f.Close()
+
+	props, changed := mergeTags(f.ReadTags(), meta, filenameWithoutExt(path))
+	if !changed {
+		return nil
+	}
+	// audiotags replaces every property, so props holds the untouched ones too.
+	if !f.WriteTags(props) {
+		return fmt.Errorf("writing %s: %w", path, ErrWriteFailed)
+	}
+	return nil
+}
+
+// mergeTags returns props, as read from a file, with the fields of meta that
+// differ from it, and whether anything changed. defaultTitle is the title
+// ReadFile falls back to when the file has none.
+func mergeTags(props map[string][]string, meta AudioMeta, defaultTitle string) (map[string][]string, bool) {
+	current := AudioMeta{
+		Title:       defaultTitle,
+		Artist:      Unknown,
+		Album:       Unknown,
+		AlbumArtist: Unknown,
+		TrackNumber: -1,
+		DiskNumber:  1,
+	}
+	applyTags(&current, normalizeTags(props))
+
+	out := maps.Clone(props)
+	if out == nil {
+		out = make(map[string][]string)
+	}
+	changed := false
+	set := func(key string, values []string, replaces ...string) {
+		for k := range out {
+			lower := strings.ToLower(k)
+			if lower == strings.ToLower(key) || slices.Contains(replaces, lower) {
+				delete(out, k)
+			}
+		}
+		out[key] = values
+		changed = true
+	}
+
+	setText := func(key, value, current string) {
+		if value != "" && value != Unknown && value != current {
+			set(key, []string{value})
+		}
+	}
+	setText("TITLE", meta.Title, current.Title)
+	setText("ARTIST", meta.Artist, current.Artist)
+	setText("ALBUM", meta.Album, current.Album)
+	setText("ALBUMARTIST", meta.AlbumArtist, current.AlbumArtist)
+	setText("ARTISTSORT", meta.ArtistSort, current.ArtistSort)
+	setText("ALBUMARTISTSORT", meta.AlbumArtistSort, current.AlbumArtistSort)
+	setText("ALBUMSORT", meta.AlbumSort, current.AlbumSort)
+	setText("LYRICS", meta.Lyrics, current.Lyrics)
+
+	if meta.Genre != "" && meta.Genre != current.Genre {
+		set("GENRE", strings.Split(meta.Genre, GenreSeparator))
+	}
+	if meta.Year > 0 && meta.Year != current.Year {
+		set("DATE", []string{strconv.Itoa(meta.Year)})
+	}
+	trackTotal := cmp.Or(meta.TrackTotal, current.TrackTotal)
+	if meta.TrackNumber >= 0 && (meta.TrackNumber != current.TrackNumber || trackTotal != current.TrackTotal) {
+		set("TRACKNUMBER", []string{slashNumber(meta.TrackNumber, trackTotal)}, "track", "tracktotal", "totaltracks")
+	}
+	discTotal := cmp.Or(meta.DiscTotal, current.DiscTotal)
+	if meta.DiskNumber > 0 && (meta.DiskNumber != current.DiskNumber || discTotal != current.DiscTotal) {
+		set("DISCNUMBER", []string{slashNumber(meta.DiskNumber, discTotal)}, "disc", "disctotal", "totaldiscs")
+	}
+
+	return out, changed
+}
+
+// slashNumber formats a track or disc number as "3" or, with a total, "3/12".
+func slashNumber(n, total int) string {
+	if total > 0 {
+		return fmt.Sprintf("%d/%d", n, total)
+	}
+	return strconv.Itoa(n)
+}
@@ -0,0 +1,194 @@
+package tags
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sdelicata/cloudbeats-backup-generator/pkg/tags/tagstest"
+)
+
+func TestMergeTags(t *testing.T) {
+	t.Parallel()
+
+	file := map[string][]string{
+		"TITLE":       {"Song"},
+		"ARTIST":      {"Band"},
+		"ALBUM":       {"Record"},
+		"AlbumArtist": {"Band"},
+		"DATE":        {"2001-05-03"},
+		"TRACK":       {"3"},
+		"TRACKTOTAL":  {"12"},
+		"ISRC":        {"USABC1234567"},
+	}
+	unchanged := func() AudioMeta {
+		var meta AudioMeta
+		meta.Title, meta.Artist, meta.Album, meta.AlbumArtist = "Song", "Band", "Record", "Band"
+		meta.Year, meta.TrackNumber, meta.TrackTotal, meta.DiskNumber = 2001, 3, 12, 1
+		return meta
+	}
+
+	tests := []struct {
+		name        string
+		meta        func(AudioMeta) AudioMeta
+		wantChanged bool
+		want        map[string][]string
+	}{
+		{
+			name: "nothing to change",
+			meta: func(m AudioMeta) AudioMeta { return m },
+			want: file,
+		},
+		{
+			name:        "album artist replaces a differently cased key",
+			meta:        func(m AudioMeta) AudioMeta { m.AlbumArtist = "Various Artists"; return m },
+			wantChanged: true,
+			want: map[string][]string{
+				"TITLE": {"Song"}, "ARTIST": {"Band"}, "ALBUM": {"Record"}, "ALBUMARTIST": {"Various Artists"},
+				"DATE": {"2001-05-03"}, "TRACK": {"3"}, "TRACKTOTAL": {"12"}, "ISRC": {"USABC1234567"},
+			},
+		},
+		{
+			name:        "year replaces the full date",
+			meta:        func(m AudioMeta) AudioMeta { m.Year = 1999; return m },
+			wantChanged: true,
+			want: map[string][]string{
+				"TITLE": {"Song"}, "ARTIST": {"Band"}, "ALBUM": {"Record"}, "AlbumArtist": {"Band"},
+				"DATE": {"1999"}, "TRACK": {"3"}, "TRACKTOTAL": {"12"}, "ISRC": {"USABC1234567"},
+			},
+		},
+		{
+			name:        "track number keeps the file's total and replaces the fallback keys",
+			meta:        func(m AudioMeta) AudioMeta { m.TrackNumber, m.TrackTotal = 4, 0; return m },
+			wantChanged: true,
+			want: map[string][]string{
+				"TITLE": {"Song"}, "ARTIST": {"Band"}, "ALBUM": {"Record"}, "AlbumArtist": {"Band"},
+				"DATE": {"2001-05-03"}, "TRACKNUMBER": {"4/12"}, "ISRC": {"USABC1234567"},
+			},
+		},
+		{
+			name: "absent values leave the file alone",
+			meta: func(m AudioMeta) AudioMeta {
+				m.Artist, m.Album, m.AlbumArtist, m.Title = Unknown, "", Unknown, ""
+				m.Year, m.TrackNumber, m.DiskNumber = 0, -1, 0
+				return m
+			},
+			want: file,
+		},
+		{
+			name:        "genre list is split into values",
+			meta:        func(m AudioMeta) AudioMeta { m.Genre = "Rock" + GenreSeparator + "Pop"; return m },
+			wantChanged: true,
+			want: map[string][]string{
+				"TITLE": {"Song"}, "ARTIST": {"Band"}, "ALBUM": {"Record"}, "AlbumArtist": {"Band"},
+				"DATE": {"2001-05-03"}, "TRACK": {"3"}, "TRACKTOTAL": {"12"}, "ISRC": {"USABC1234567"},
+				"GENRE": {"Rock", "Pop"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, changed := mergeTags(file, test.meta(unchanged()), "01 Song")
+			assert.Equal(t, test.wantChanged, changed)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestWriteTags_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "silence.wav")
+	tagstest.WriteWAV(t, path, time.Second)
+	if _, raw, _ := ReadFileRaw(path); raw == nil {
+		t.Skip("taglib cannot open WAV fixtures in this build")
+	}
+
+	meta, err := ReadFile(path, ReadOptions{})
+	require.NoError(t, err)
+	meta.Album = "Record"
+	meta.AlbumArtist = "Band"
+	meta.Year = 2001
+	meta.TrackNumber, meta.TrackTotal = 3, 12
+	require.NoError(t, WriteTags(path, meta))
+
+	got, err := ReadFile(path, ReadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Record", got.Album)
+	assert.Equal(t, "Band", got.AlbumArtist)
+	assert.Equal(t, 2001, got.Year)
+	assert.Equal(t, 3, got.TrackNumber)
+	assert.Equal(t, 12, got.TrackTotal)
+	assert.Equal(t, meta.Duration, got.Duration, "writing tags keeps the audio")
+
+	// Changing one field keeps the others
+	got.AlbumArtist = "Various Artists"
+	require.NoError(t, WriteTags(path, got))
+	again, err := ReadFile(path, ReadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Various Artists", again.AlbumArtist)
+	assert.Equal(t, "Record", again.Album)
+	assert.Equal(t, 2001, again.Year)
+}
+
+func TestWriteTags_UnreadableFile(t *testing.T) {
+	t.Parallel()
+
+	err := WriteTags(filepath.Join(t.TempDir(), "missing.mp3"), AudioMeta{Album: "Record"})
+	assert.Error(t, err)
+}
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	meta := AudioMeta{
+		Title:       "  Cafe\u0301 del Mar ",
+		Artist:      "Bjo\u0308rk\t",
+		Album:       "Debut",
+		AlbumArtist: " Bjo\u0308rk",
+		Genre:       "Pop; Electronic ",
+		Year:        1993,
+		TrackNumber: 1,
+		Lyrics:      "  keep as is  ",
+	}
+	got := Normalize(meta)
+
+	assert.Equal(t, "Caf\u00e9 del Mar", got.Title, "decomposed accents are composed")
+	assert.Equal(t, "Bj\u00f6rk", got.Artist)
+	assert.Equal(t, "Debut", got.Album)
+	assert.Equal(t, "Bj\u00f6rk", got.AlbumArtist)
+	assert.Equal(t, "Pop; Electronic", got.Genre)
+	assert.Equal(t, 1993, got.Year)
+	assert.Equal(t, "  keep as is  ", got.Lyrics)
+	assert.Equal(t, got, Normalize(got), "normalizing twice changes nothing")
+}
+
+func TestWriteTags_NormalizedRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "silence.wav")
+	tagstest.WriteWAV(t, path, time.Second)
+	if _, raw, _ := ReadFileRaw(path); raw == nil {
+		t.Skip("taglib cannot open WAV fixtures in this build")
+	}
+
+	meta, err := ReadFile(path, ReadOptions{})
+	require.NoError(t, err)
+	meta.Artist = " Björk "
+	require.NoError(t, WriteTags(path, meta))
+
+	read, err := ReadFile(path, ReadOptions{})
+	require.NoError(t, err)
+	require.NoError(t, WriteTags(path, Normalize(read)))
+
+	got, err := ReadFile(path, ReadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "Björk", got.Artist)
+	assert.Equal(t, got, Normalize(got), "a normalized file reads back normalized")
+}
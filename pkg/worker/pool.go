@@ -3,16 +3,32 @@ package worker
 
 import (
 	"context"
+	"fmt"
 	"sync"
-	"sync/atomic"
 )
 
 // ProgressFunc is called after each item is processed with (done, total).
 type ProgressFunc func(done, total int)
 
-// Process runs fn on each item using n concurrent goroutines.
+// ItemProgressFunc is like ProgressFunc but also receives the index in items of
+// the item just completed, so callers can show what is being worked on.
+// It may be called from several goroutines at once.
+type ItemProgressFunc func(done, total, index int)
+
+// Process runs fn on each item using n concurrent goroutines (at least one).
 // Results are returned in the same order as items. Errors are collected per-item.
+// If ctx is canceled, items that were never started get ctx.Err() as their error.
+// A panic in fn is recovered and recorded as that item's error.
 func Process[T any, R any](ctx context.Context, items []T, n int, fn func(context.Context, T) (R, error), progress ProgressFunc) ([]R, []error) {
+	var itemProgress ItemProgressFunc
+	if progress != nil {
+		itemProgress = func(done, total, _ int) { progress(done, total) }
+	}
+	return ProcessWithItemProgress(ctx, items, n, fn, itemProgress)
+}
+
+// ProcessWithItemProgress is like Process but reports progress with the index of each completed item.
+func ProcessWithItemProgress[T any, R any](ctx context.Context, items []T, n int, fn func(context.Context, T) (R, error), progress ItemProgressFunc) ([]R, []error) {
 	total := len(items)
 	if total == 0 {
 		return nil, nil
@@ -20,35 +36,91 @@ func Process[T any, R any](ctx context.Context, items []T, n int, fn func(contex
 
 	results := make([]R, total)
 	errors := make([]error, total)
+	finished := make([]bool, total)
 
-	var done atomic.Int64
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, n)
+	done := 0
+	for r := range ProcessStream(ctx, items, n, fn) {
+		results[r.Index] = r.Value
+		errors[r.Index] = r.Err
+		finished[r.Index] = true
 
-	for i, item := range items {
-		if ctx.Err() != nil {
-			break
+		done++
+		if progress != nil {
+			progress(done, total, r.Index)
 		}
+	}
 
-		wg.Add(1)
-		sem <- struct{}{}
+	for i, ok := range finished {
+		if !ok {
+			errors[i] = ctx.Err()
+		}
+	}
+	return results, errors
+}
+
+// Result is an item finished by ProcessStream: its index in items, and what
+// fn returned for it.
+type Result[R any] struct {
+	Index int
+	Value R
+	Err   error
+}
 
-		go func(idx int, it T) {
-			defer wg.Done()
-			defer func() { <-sem }()
+// ProcessStream runs fn on each item using n concurrent goroutines (at least
+// one) and sends each result on the returned channel as soon as it is ready, in
+// completion order, so callers can consume results without holding them all.
+// The channel is closed once every started item has been sent. Workers wait
+// while the channel is full, so at most about 2n results are pending; the
+// caller must drain it. If ctx is canceled, items that were never started are
+// not sent. A panic in fn is recovered and sent as that item's error.
+func ProcessStream[T any, R any](ctx context.Context, items []T, n int, fn func(context.Context, T) (R, error)) <-chan Result[R] {
+	n = max(n, 1)
+	out := make(chan Result[R], n)
 
-			r, err := fn(ctx, it)
-			results[idx] = r
-			errors[idx] = err
+	go func() {
+		defer close(out)
 
-			current := int(done.Add(1))
-			if progress != nil {
-				progress(current, total)
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, n)
+
+		for i, item := range items {
+			acquired := false
+			select {
+			case sem <- struct{}{}:
+				acquired = true
+			case <-ctx.Done():
+			}
+			// Re-checked after acquiring, since select picks randomly when both cases are ready.
+			if ctx.Err() != nil {
+				if acquired {
+					<-sem
+				}
+				break
 			}
-		}(i, item)
-	}
 
-	wg.Wait()
+			wg.Add(1)
+			go func(idx int, it T) {
+				defer wg.Done()
+				defer func() { <-sem }()
 
-	return results, errors
+				r, err := safeCall(ctx, fn, it)
+				out <- Result[R]{Index: idx, Value: r, Err: err}
+			}(i, item)
+		}
+
+		wg.Wait()
+	}()
+
+	return out
+}
+
+// safeCall invokes fn, converting a panic into an error.
+func safeCall[T any, R any](ctx context.Context, fn func(context.Context, T) (R, error), it T) (r R, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			var zero R
+			r, err = zero, fmt.Errorf("worker panicked: %v", p)
+		}
+	}()
+	return fn(ctx, it)
 }
@@ -0,0 +1,248 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess(t *testing.T) {
+	t.Parallel()
+
+	items := []int{1, 2, 3, 4, 5}
+	var calls atomic.Int64
+	results, errs := Process(context.Background(), items, 2,
+		func(_ context.Context, n int) (int, error) {
+			return n * n, nil
+		},
+		func(done, total int) {
+			calls.Add(1)
+			assert.Equal(t, len(items), total)
+		},
+	)
+
+	assert.Equal(t, []int{1, 4, 9, 16, 25}, results)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int64(len(items)), calls.Load())
+}
+
+func TestProcess_CanceledMarksUnstartedItems(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	items := []int{1, 2, 3, 4, 5}
+	results, errs := Process(ctx, items, 1,
+		func(_ context.Context, n int) (int, error) {
+			if n == 2 {
+				cancel()
+			}
+			return n * 10, nil
+		},
+		nil,
+	)
+
+	require.Len(t, errs, len(items))
+	assert.NoError(t, errs[0])
+	assert.Equal(t, 10, results[0])
+
+	// Item 2 was in flight when the context was canceled, so it completes.
+	// Everything after it may or may not have started, but any item that
+	// did not run must report the cancellation.
+	for i := 2; i < len(items); i++ {
+		if errs[i] != nil {
+			assert.True(t, errors.Is(errs[i], context.Canceled))
+			assert.Zero(t, results[i])
+		}
+	}
+	assert.True(t, errors.Is(errs[len(items)-1], context.Canceled))
+}
+
+func TestProcess_RecoversPanics(t *testing.T) {
+	t.Parallel()
+
+	items := []int{1, 2, 3, 4}
+	results, errs := Process(context.Background(), items, 2,
+		func(_ context.Context, n int) (int, error) {
+			if n == 3 {
+				panic("boom")
+			}
+			return n * 10, nil
+		},
+		nil,
+	)
+
+	require.Error(t, errs[2])
+	assert.Contains(t, errs[2].Error(), "boom")
+	assert.Zero(t, results[2])
+
+	for _, i := range []int{0, 1, 3} {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, items[i]*10, results[i])
+	}
+}
+
+func TestProcess_NonPositiveConcurrency(t *testing.T) {
+	t.Parallel()
+
+	for _, n := range []int{0, -1} {
+		results, errs := Process(context.Background(), []int{1, 2, 3}, n,
+			func(_ context.Context, n int) (int, error) {
+				return n * 2, nil
+			},
+			nil,
+		)
+		assert.Equal(t, []int{2, 4, 6}, results, "n=%d runs one worker", n)
+		assert.Equal(t, []error{nil, nil, nil}, errs)
+	}
+}
+
+func TestProcess_CancelUnblocksSubmission(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls atomic.Int64
+	items := make([]int, 10)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	_, errs := Process(ctx, items, 1,
+		func(_ context.Context, _ int) (int, error) {
+			// Simulates a stuck task that ignores ctx.
+			calls.Add(1)
+			time.Sleep(200 * time.Millisecond)
+			return 0, nil
+		},
+		nil,
+	)
+
+	assert.Less(t, time.Since(start), 350*time.Millisecond)
+	assert.Equal(t, int64(1), calls.Load())
+	assert.NoError(t, errs[0])
+	for _, err := range errs[1:] {
+		assert.True(t, errors.Is(err, context.Canceled))
+	}
+}
+
+func TestProcessWithItemProgress(t *testing.T) {
+	t.Parallel()
+
+	items := []string{"a", "b", "c", "d"}
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	var last int
+
+	_, errs := ProcessWithItemProgress(context.Background(), items, 2,
+		func(_ context.Context, s string) (string, error) {
+			return s, nil
+		},
+		func(done, total, index int) {
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, len(items), total)
+			assert.False(t, seen[index], "index %d reported twice", index)
+			seen[index] = true
+			last = max(last, done)
+		},
+	)
+
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Len(t, seen, len(items))
+	assert.Equal(t, len(items), last)
+}
+
+func TestProcessStream_CompletionOrder(t *testing.T) {
+	t.Parallel()
+
+	// Item 0 finishes only after item 1 has been received
+	release := make(chan struct{})
+	items := []int{0, 1, 2}
+	results := ProcessStream(context.Background(), items, 2,
+		func(_ context.Context, n int) (string, error) {
+			if n == 0 {
+				<-release
+			}
+			if n == 2 {
+				return "", errors.New("unreadable")
+			}
+			return fmt.Sprint(n), nil
+		},
+	)
+
+	first := <-results
+	assert.Equal(t, Result[string]{Index: 1, Value: "1"}, first)
+	close(release)
+
+	got := map[int]Result[string]{first.Index: first}
+	for r := range results {
+		_, dup := got[r.Index]
+		assert.False(t, dup, "index %d sent twice", r.Index)
+		got[r.Index] = r
+	}
+	require.Len(t, got, len(items))
+	assert.Equal(t, "0", got[0].Value)
+	assert.NoError(t, got[0].Err)
+	assert.EqualError(t, got[2].Err, "unreadable")
+}
+
+func TestProcessStream_Backpressure(t *testing.T) {
+	t.Parallel()
+
+	var started atomic.Int64
+	items := make([]int, 20)
+	results := ProcessStream(context.Background(), items, 1,
+		func(context.Context, int) (int, error) {
+			started.Add(1)
+			return 0, nil
+		},
+	)
+
+	// Nobody reads: one result fills the channel and the next worker waits to send
+	assert.Eventually(t, func() bool { return started.Load() == 2 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, int64(2), started.Load(), "no more work starts while results are not consumed")
+
+	received := 0
+	for range results {
+		received++
+	}
+	assert.Equal(t, len(items), received)
+}
+
+func TestProcessStream_CanceledSkipsUnstartedItems(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	items := []int{1, 2, 3, 4, 5}
+	var indexes []int
+	for r := range ProcessStream(ctx, items, 1,
+		func(_ context.Context, n int) (int, error) {
+			if n == 2 {
+				cancel()
+			}
+			return n, nil
+		},
+	) {
+		indexes = append(indexes, r.Index)
+	}
+	assert.Equal(t, []int{0, 1}, indexes, "the channel closes without the items never started")
+}